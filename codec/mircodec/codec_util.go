@@ -177,6 +177,9 @@ func decodeValue(f reflect.Value, bytes []byte) []byte {
 	case reflect.Struct:
 		l := f.NumField()
 		for i := 0; i < l; i++ {
+			if f.Type().Field(i).Tag.Get("codec") == "-" {
+				continue
+			}
 			bytes = decodeValue(f.Field(i), bytes)
 		}
 	case reflect.String:
@@ -835,3 +835,39 @@ func TestDecodeEncodeNPCGoods(t *testing.T) {
 	codec := new(MirCodec)
 	encodeDecode(t, bytes, msg, codec)
 }
+
+func TestEncodeDecodeUserStorage(t *testing.T) {
+	msg := &server.UserStorage{Storage: make([]common.UserItem, 3)}
+	msg.Storage[1] = common.UserItem{ID: 5, ItemID: 1235, Count: 3}
+	codec := new(MirUserStorageCodec)
+	obj, err := codec.Encode(msg, *new(cellnet.ContextSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := new(server.UserStorage)
+	if err := codec.Decode(obj, res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg, res) {
+		t.Errorf("%v != %v", msg, res)
+	}
+}
+
+func TestEncodeDecodeAwakeningNeedMaterials(t *testing.T) {
+	msg := &server.AwakeningNeedMaterials{
+		Materials:      []common.ItemInfo{{ID: 1, Name: "BlackStone", StackSize: 100}, {ID: 2, Name: "GoldBar"}},
+		MaterialsCount: []int{5, 1},
+	}
+	codec := new(MirCodec)
+	obj, err := codec.Encode(msg, *new(cellnet.ContextSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := new(server.AwakeningNeedMaterials)
+	if err := codec.Decode(obj, res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(msg, res) {
+		t.Errorf("%v != %v", msg, res)
+	}
+}
@@ -0,0 +1,70 @@
+package mircodec
+
+import (
+	"reflect"
+
+	"github.com/davyxu/cellnet"
+	"github.com/davyxu/cellnet/codec"
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+func init() {
+	codec.RegisterCodec(new(MirUserStorageCodec))
+}
+
+// MirUserStorageCodec 仓库里有空格子，每个格子前面要写是否有物品
+type MirUserStorageCodec struct{}
+
+// Name 编码器的名字
+func (*MirUserStorageCodec) Name() string {
+	return "MirUserStorageCodec"
+}
+
+// MimeType 兼容http类型
+func (*MirUserStorageCodec) MimeType() string {
+	return "application/binary"
+}
+
+// Encode 将数据转换为字节数组
+func (*MirUserStorageCodec) Encode(msgObj interface{}, ctx cellnet.ContextSet) (data interface{}, err error) {
+	var bytes []byte
+	us := msgObj.(*server.UserStorage)
+	writer := &BytesWrapper{Bytes: &bytes}
+	hasStorage := len(us.Storage) != 0
+	writer.Write(hasStorage)
+	if !hasStorage {
+		return *writer.Bytes, nil
+	}
+	l := len(us.Storage)
+	writer.Write(int32(l))
+	for i := 0; i < l; i++ {
+		hasUserItem := !IsNull(us.Storage[i])
+		writer.Write(hasUserItem)
+		if !hasUserItem {
+			continue
+		}
+		writer.Write(&us.Storage[i])
+	}
+	return *writer.Bytes, nil
+}
+
+// Decode 将字节数组转换为数据
+func (*MirUserStorageCodec) Decode(data interface{}, msgObj interface{}) error {
+	us := msgObj.(*server.UserStorage)
+	bytes := data.([]byte)
+	reader := &BytesWrapper{Bytes: &bytes}
+	if !reader.ReadBoolean() {
+		return nil
+	}
+	count := reader.ReadInt32()
+	us.Storage = make([]common.UserItem, count)
+	for i := 0; i < int(count); i++ {
+		if reader.ReadBoolean() {
+			last := reader.Last()
+			item := &us.Storage[i]
+			*reader.Bytes = decodeValue(reflect.ValueOf(item), last)
+		}
+	}
+	return nil
+}
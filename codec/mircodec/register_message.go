@@ -687,6 +687,7 @@ func initServerMessage() {
 	mirCodec := new(MirCodec)
 	mirUserInformationCodec := new(MirUserInformationCodec)
 	mirPlayerInspectCodec := new(MirPlayerInspectCodec)
+	mirUserStorageCodec := new(MirUserStorageCodec)
 	mirObjectPlayerCodec := new(MirObjectPlayerCodec)
 	mirObjectNPCCodec := new(MirObjectNPCCodec)
 	mirNPCResponseCodec := new(MirNPCResponseCodec)
@@ -1252,7 +1253,7 @@ func initServerMessage() {
 		ID:    server.OBJECT_NAME,
 	})
 	cellnet.RegisterMessageMeta(&cellnet.MessageMeta{
-		Codec: mirCodec,
+		Codec: mirUserStorageCodec,
 		Type:  reflect.TypeOf((*server.UserStorage)(nil)).Elem(),
 		ID:    server.USER_STORAGE,
 	})
@@ -393,6 +393,50 @@ const (
 	UserItemTypeInventory      UserItemType = 0
 	UserItemTypeEquipment                   = 1
 	UserItemTypeQuestInventory              = 2
+	UserItemTypeStorage                     = 3
+)
+
+// EquipmentSlot 装备栏格子
+type EquipmentSlot int32
+
+const (
+	EquipmentSlotWeapon    EquipmentSlot = 0
+	EquipmentSlotArmour                  = 1
+	EquipmentSlotHelmet                  = 2
+	EquipmentSlotTorch                   = 3
+	EquipmentSlotNecklace                = 4
+	EquipmentSlotBraceletL               = 5
+	EquipmentSlotBraceletR               = 6
+	EquipmentSlotRingL                   = 7
+	EquipmentSlotRingR                   = 8
+	EquipmentSlotAmulet                  = 9
+	EquipmentSlotBelt                    = 10
+	EquipmentSlotBoots                   = 11
+	EquipmentSlotStone                   = 12
+	EquipmentSlotMount                   = 13
+)
+
+// BindMode 物品绑定限制，对应 ItemInfo.Bind
+type BindMode int16
+
+const (
+	BindModeNone                BindMode = 0
+	BindModeDontDeathdrop                = 1
+	BindModeDontDrop                     = 2
+	BindModeDontSell                     = 4
+	BindModeDontStore                    = 8
+	BindModeDontTrade                    = 16
+	BindModeDontRepair                   = 32
+	BindModeDontUpgrade                  = 64
+	BindModeDisableNpc                   = 128
+	BindModeBindOnEquip                  = 256
+	BindModeBreakOnDeath                 = 512
+	BindModeDestroyOnDrop                = 1024
+	BindModeNoSRepair                    = 2048
+	BindModeNoWeddingRing                = 4096
+	BindModeUnableToRent                 = 8192
+	BindModeUnableToDisassemble          = 16384
+	BindModeNoMail                       = 32768
 )
 
 type PoisonType uint16
@@ -966,3 +1010,41 @@ const (
 	DefenceTypeRepulsion
 	DefenceTypeNone
 )
+
+type AwakeType uint8
+
+const (
+	AwakeTypeNone AwakeType = iota
+	AwakeTypeDC
+	AwakeTypeMC
+	AwakeTypeSC
+	AwakeTypeAC
+	AwakeTypeMAC
+	AwakeTypeHPMP
+)
+
+// SpecialItemMode 宝石(ItemInfo.UniqueItem)可以镶嵌的装备类型
+type SpecialItemMode int16
+
+const (
+	SpecialItemModeNone       SpecialItemMode = 0
+	SpecialItemModeParalize                   = 0x0001 // 武器
+	SpecialItemModeTeleport                   = 0x0002 // 衣服
+	SpecialItemModeClearRing                  = 0x0004 // 头盔
+	SpecialItemModeProtection                 = 0x0008 // 项链
+	SpecialItemModeRevival                    = 0x0010 // 手镯
+	SpecialItemModeMuscle                     = 0x0020 // 戒指
+	SpecialItemModeFlame                      = 0x0040 // 护身符
+	SpecialItemModeHealing                    = 0x0080 // 腰带
+	SpecialItemModeProbe                      = 0x0100 // 鞋子
+	SpecialItemModeSkill                      = 0x0200 // 宝石
+	SpecialItemModeNoDuraLoss                 = 0x0400 // 火把
+)
+
+// NPCTradeType NPC 交易记录的类型
+type NPCTradeType int
+
+const (
+	NPCTradeTypeBuy     NPCTradeType = iota // 玩家购买
+	NPCTradeTypeRestock                     // 限量商品补货
+)
@@ -0,0 +1,123 @@
+package common
+
+import "math/rand"
+
+// RandomStat 一项附加属性的随机规则，1/Chance 的概率获得该属性，
+// 属性值为 MaxStat 次 1/StatChance 判定中成功的次数，Chance 为 0 时不会获得
+type RandomStat struct {
+	Chance     int
+	StatChance int
+	MaxStat    int
+}
+
+// RandomItemStat 一类物品的附加属性随机规则，对应 ItemInfo.RandomStatsId
+type RandomItemStat struct {
+	MaxDura        RandomStat // 每点增加 1000 持久
+	AC             RandomStat
+	MAC            RandomStat
+	DC             RandomStat
+	MC             RandomStat
+	SC             RandomStat
+	Accuracy       RandomStat
+	Agility        RandomStat
+	HP             RandomStat
+	MP             RandomStat
+	AttackSpeed    RandomStat
+	Luck           RandomStat
+	Strong         RandomStat
+	MagicResist    RandomStat
+	PoisonResist   RandomStat
+	HealthRecovery RandomStat
+	ManaRecovery   RandomStat
+	PoisonRecovery RandomStat
+	CriticalRate   RandomStat
+	CriticalDamage RandomStat
+	Freezing       RandomStat
+	PoisonAttack   RandomStat
+}
+
+// randomRange count 次 1/rate 的判定，返回成功的次数
+func randomRange(r *rand.Rand, count, rate int) int {
+	if rate <= 0 {
+		return 0
+	}
+	x := 0
+	for i := 0; i < count; i++ {
+		if r.Intn(rate) == 0 {
+			x++
+		}
+	}
+	return x
+}
+
+// roll 判定是否获得属性，获得时属性值至少为 1
+func (s RandomStat) roll(r *rand.Rand) int {
+	if s.Chance <= 0 || r.Intn(s.Chance) != 0 {
+		return 0
+	}
+	return randomRange(r, s.MaxStat-1, s.StatChance) + 1
+}
+
+func rollUint8(r *rand.Rand, s RandomStat, v *uint8) {
+	if n := s.roll(r); n > 0 {
+		*v = uint8(n)
+	}
+}
+
+func rollInt8(r *rand.Rand, s RandomStat, v *int8) {
+	if n := s.roll(r); n > 0 {
+		*v = int8(n)
+	}
+}
+
+// RandomDura 掉落物品的当前持久在 [1000, Durability] 之间随机
+func (u *UserItem) RandomDura(r *rand.Rand, info *ItemInfo) {
+	if info.Durability == 0 {
+		return
+	}
+	dura := r.Intn(int(info.Durability)) + 1000
+	if dura > int(info.Durability) {
+		dura = int(info.Durability)
+	}
+	u.CurrentDura = uint16(dura)
+}
+
+// RandomStats 按规则随机物品的附加属性和最大持久
+func (u *UserItem) RandomStats(r *rand.Rand, stat *RandomItemStat) {
+	if stat == nil {
+		return
+	}
+	if stat.MaxDura.Chance > 0 && r.Intn(stat.MaxDura.Chance) == 0 {
+		dura := randomRange(r, stat.MaxDura.MaxStat, stat.MaxDura.StatChance) * 1000
+		u.MaxDura = uint16(minInt(int(u.MaxDura)+dura, 0xFFFF))
+		u.CurrentDura = uint16(minInt(int(u.CurrentDura)+dura, 0xFFFF))
+	}
+	rollUint8(r, stat.AC, &u.AC)
+	rollUint8(r, stat.MAC, &u.MAC)
+	rollUint8(r, stat.DC, &u.DC)
+	rollUint8(r, stat.MC, &u.MC)
+	rollUint8(r, stat.SC, &u.SC)
+	rollUint8(r, stat.Accuracy, &u.Accuracy)
+	rollUint8(r, stat.Agility, &u.Agility)
+	rollUint8(r, stat.HP, &u.HP)
+	rollUint8(r, stat.MP, &u.MP)
+	rollInt8(r, stat.AttackSpeed, &u.AttackSpeed)
+	rollInt8(r, stat.Luck, &u.Luck)
+	rollUint8(r, stat.Strong, &u.Strong)
+	rollUint8(r, stat.MagicResist, &u.MagicResist)
+	rollUint8(r, stat.PoisonResist, &u.PoisonResist)
+	rollUint8(r, stat.HealthRecovery, &u.HealthRecovery)
+	rollUint8(r, stat.ManaRecovery, &u.ManaRecovery)
+	rollUint8(r, stat.PoisonRecovery, &u.PoisonRecovery)
+	rollUint8(r, stat.CriticalRate, &u.CriticalRate)
+	rollUint8(r, stat.CriticalDamage, &u.CriticalDamage)
+	rollUint8(r, stat.Freezing, &u.Freezing)
+	rollUint8(r, stat.PoisonAttack, &u.PoisonAttack)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestUserItemRandomStats(t *testing.T) {
+	info := &ItemInfo{Durability: 5000}
+	stat := &RandomItemStat{
+		MaxDura: RandomStat{Chance: 1, StatChance: 1, MaxStat: 2},
+		DC:      RandomStat{Chance: 1, StatChance: 1, MaxStat: 3},
+		Luck:    RandomStat{Chance: 1, StatChance: 1000000, MaxStat: 5},
+	}
+	u := &UserItem{MaxDura: info.Durability, CurrentDura: info.Durability}
+	u.RandomStats(rand.New(rand.NewSource(1)), stat)
+	if u.MaxDura != 7000 || u.CurrentDura != 7000 {
+		t.Errorf("max dura error: %d/%d", u.CurrentDura, u.MaxDura)
+	}
+	if u.DC != 3 || u.Luck != 1 || u.AC != 0 {
+		t.Errorf("added stats error: DC %d, Luck %d, AC %d", u.DC, u.Luck, u.AC)
+	}
+
+	// 相同种子结果相同
+	weapon := &RandomItemStat{
+		DC:          RandomStat{Chance: 2, StatChance: 3, MaxStat: 10},
+		AttackSpeed: RandomStat{Chance: 2, StatChance: 3, MaxStat: 3},
+	}
+	a, b := &UserItem{}, &UserItem{}
+	a.RandomStats(rand.New(rand.NewSource(42)), weapon)
+	b.RandomStats(rand.New(rand.NewSource(42)), weapon)
+	if *a != *b {
+		t.Errorf("same seed should roll same stats: %+v %+v", a, b)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		u.RandomDura(r, info)
+		if u.CurrentDura < 1000 || u.CurrentDura > info.Durability {
+			t.Fatalf("random dura out of range: %d", u.CurrentDura)
+		}
+	}
+}
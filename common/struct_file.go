@@ -60,3 +60,173 @@ func GetDropInfosByMonsterName(dropDirPath, monsterName string) (res []DropInfo,
 	}
 	return res, nil
 }
+
+// RecipeIngredient 合成配方中的一项材料或工具
+type RecipeIngredient struct {
+	ItemName string // ItemInfo.Name
+	Count    uint32
+	Dura     uint16 // 需要的最低持久，0 表示不检查
+}
+
+// RecipeInfo 一个 RecipeInfo 对象对应 database/Envir/Recipe 文件夹内的一个文件，文件名即合成出的物品名
+type RecipeInfo struct {
+	ItemName    string // 合成出的物品 ItemInfo.Name
+	Amount      uint32 // 每次合成得到的数量
+	Chance      int    // 成功率 0-100
+	Gold        uint64 // 每次合成消耗的金币
+	Tools       []RecipeIngredient
+	Ingredients []RecipeIngredient
+}
+
+// NewRecipeInfo 解析配方文件内容
+// [Recipe]
+// Amount 1
+// Chance 80
+// Gold 1000
+// [Tools]
+// Hammer
+// [Ingredients]
+// BlackIronOre 5 3000
+func NewRecipeInfo(itemName string, lines []string) (*RecipeInfo, error) {
+	res := &RecipeInfo{ItemName: itemName, Amount: 1, Chance: 100}
+	section := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToUpper(line)
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "[RECIPE]":
+			if len(fields) != 2 {
+				return nil, errors.New("NewRecipeInfo 格式不正确: [" + line + "]")
+			}
+			v, err := strconv.Atoi(fields[1])
+			if err != nil || v < 0 {
+				return nil, errors.New("NewRecipeInfo 格式不正确: [" + line + "]")
+			}
+			switch strings.ToUpper(fields[0]) {
+			case "AMOUNT":
+				res.Amount = uint32(v)
+			case "CHANCE":
+				if v > 100 {
+					v = 100
+				}
+				res.Chance = v
+			case "GOLD":
+				res.Gold = uint64(v)
+			}
+		case "[TOOLS]", "[INGREDIENTS]":
+			ing := RecipeIngredient{ItemName: fields[0], Count: 1}
+			if len(fields) > 1 {
+				c, err := strconv.Atoi(fields[1])
+				if err != nil || c <= 0 {
+					return nil, errors.New("NewRecipeInfo 格式不正确: [" + line + "]")
+				}
+				ing.Count = uint32(c)
+			}
+			if len(fields) > 2 {
+				d, err := strconv.Atoi(fields[2])
+				if err != nil || d < 0 {
+					return nil, errors.New("NewRecipeInfo 格式不正确: [" + line + "]")
+				}
+				ing.Dura = uint16(d)
+			}
+			if section == "[TOOLS]" {
+				res.Tools = append(res.Tools, ing)
+			} else {
+				res.Ingredients = append(res.Ingredients, ing)
+			}
+		}
+	}
+	if res.Amount == 0 {
+		return nil, errors.New("NewRecipeInfo 合成数量不能为 0: " + itemName)
+	}
+	if len(res.Ingredients) == 0 {
+		return nil, errors.New("NewRecipeInfo 没有合成材料: " + itemName)
+	}
+	return res, nil
+}
+
+// GetRecipeInfoByItemName 加载物品的合成配方
+func GetRecipeInfoByItemName(recipeDirPath, itemName string) (*RecipeInfo, error) {
+	file, err := os.Open(recipeDirPath + itemName + ".txt")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := make([]string, 0)
+	fscanner := bufio.NewScanner(file)
+	for fscanner.Scan() {
+		lines = append(lines, fscanner.Text())
+	}
+	return NewRecipeInfo(itemName, lines)
+}
+
+// NewExpList 解析 ExpList.ini，[Exp] 下 LevelN=经验，从 Level1 开始连续读取，遇到缺失的等级停止
+func NewExpList(lines []string) ([]int64, error) {
+	values := make(map[int]int64)
+	section := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToUpper(line[1 : len(line)-1])
+			continue
+		}
+		if section != "EXP" {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.ToUpper(strings.TrimSpace(kv[0]))
+		if len(kv) != 2 || !strings.HasPrefix(key, "LEVEL") {
+			return nil, errors.New("NewExpList 格式不正确: [" + line + "]")
+		}
+		level, err := strconv.Atoi(key[len("LEVEL"):])
+		if err != nil {
+			return nil, errors.New("NewExpList 等级不正确: [" + line + "]")
+		}
+		exp, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil || exp <= 0 {
+			return nil, errors.New("NewExpList 经验不正确: [" + line + "]")
+		}
+		if _, ok := values[level]; ok {
+			return nil, errors.New("NewExpList 等级重复: [" + line + "]")
+		}
+		values[level] = exp
+	}
+	// 等级必须从 1 开始连续，中间缺少的等级说明数据有误
+	res := make([]int64, 0, len(values))
+	for i := 1; i <= len(values); i++ {
+		exp, ok := values[i]
+		if !ok {
+			return nil, errors.New("NewExpList 缺少等级 " + strconv.Itoa(i) + " 的经验")
+		}
+		res = append(res, exp)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("NewExpList 没有等级经验")
+	}
+	return res, nil
+}
+
+// GetExpList 加载升级经验表，下标 0 是 1 级升到 2 级需要的经验
+func GetExpList(filename string) ([]int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lines := make([]string, 0)
+	fscanner := bufio.NewScanner(file)
+	for fscanner.Scan() {
+		lines = append(lines, fscanner.Text())
+	}
+	return NewExpList(lines)
+}
@@ -29,3 +29,62 @@ func TestGetDropInfosByMonsterName(t *testing.T) {
 		t.Log(drops)
 	}
 }
+
+func TestNewRecipeInfo(t *testing.T) {
+	lines := []string{
+		"[Recipe]",
+		"Amount 2",
+		"Chance 60",
+		"Gold 1000",
+		"",
+		"; 注释",
+		"[Tools]",
+		"Hammer",
+		"[Ingredients]",
+		"BlackIronOre 5 3000",
+		"Candle",
+	}
+	ri, err := NewRecipeInfo("Bolt", lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ri.Amount != 2 || ri.Chance != 60 || ri.Gold != 1000 {
+		t.Errorf("recipe header parse error: %+v", ri)
+	}
+	if len(ri.Tools) != 1 || ri.Tools[0].ItemName != "Hammer" || ri.Tools[0].Count != 1 {
+		t.Errorf("recipe tools parse error: %+v", ri.Tools)
+	}
+	if len(ri.Ingredients) != 2 || ri.Ingredients[0].Count != 5 || ri.Ingredients[0].Dura != 3000 {
+		t.Errorf("recipe ingredients parse error: %+v", ri.Ingredients)
+	}
+	if _, err := NewRecipeInfo("Bolt", []string{"[Recipe]", "Gold 10"}); err == nil {
+		t.Error("recipe without ingredients should fail")
+	}
+}
+
+func TestNewExpList(t *testing.T) {
+	lines := []string{
+		"[Exp]",
+		"Level1=100",
+		"Level2=200",
+		"; 注释",
+		"Level3=300",
+		"Level4=600",
+	}
+	list, err := NewExpList(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 || list[0] != 100 || list[3] != 600 {
+		t.Errorf("exp list parse error: %v", list)
+	}
+	if _, err := NewExpList([]string{"[Exp]", "Level1=abc"}); err == nil {
+		t.Error("invalid exp should fail")
+	}
+	if _, err := NewExpList([]string{"[Exp]", "Level1=100", "Level2=200", "Level5=600"}); err == nil {
+		t.Error("missing level should fail")
+	}
+	if _, err := NewExpList([]string{"[Exp]", "Level1=100", "Level1=200"}); err == nil {
+		t.Error("duplicate level should fail")
+	}
+}
@@ -71,3 +71,30 @@ func (c Color) ToInt32() int32 {
 func (c Color) ToUint32() uint32 {
 	return BytesToUint32([]uint8{c.R, c.G, c.B, 255})
 }
+
+// ClientRecipeInfo 客户端显示的合成配方
+type ClientRecipeInfo struct {
+	Gold        uint32
+	Chance      uint8
+	Item        UserItem
+	Tools       []UserItem
+	Ingredients []UserItem
+}
+
+// ClientFriend 客户端显示的好友
+type ClientFriend struct {
+	Index   int32
+	Name    string
+	Memo    string
+	Blocked bool
+	Online  bool
+}
+
+// RankCharacterInfo 排行榜中的角色
+type RankCharacterInfo struct {
+	PlayerID   int64
+	Name       string
+	Class      MirClass
+	Level      int32
+	Experience int64
+}
@@ -1,12 +1,19 @@
 package common
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
 
 // Account 账号
 type Account struct {
 	ID       int `gorm:"primary_key"`
 	Username string
 	Password string
+	Credit   uint32 // 商城元宝
+	Pearls   uint32 // 珍珠
 }
 
 // AccountCharacter 账号角色关系
@@ -31,22 +38,23 @@ type Basic struct {
 
 // Character 角色
 type Character struct {
-	ID               int32 `gorm:"primary_key"`
-	Name             string
-	Level            uint16
-	Class            MirClass
-	Gender           MirGender
-	Hair             uint8
-	CurrentMapID     int32
-	CurrentLocationX int32
-	CurrentLocationY int32
-	Direction        MirDirection
-	HP               uint16
-	MP               uint16
-	Experience       int64
-	AttackMode       AttackMode
-	PetMode          PetMode
-	Gold             uint64 `codec:"-"` // 编码时，忽略这个字段，只用在数据库查询
+	ID                 int32 `gorm:"primary_key"`
+	Name               string
+	Level              uint16
+	Class              MirClass
+	Gender             MirGender
+	Hair               uint8
+	CurrentMapID       int32
+	CurrentLocationX   int32
+	CurrentLocationY   int32
+	Direction          MirDirection
+	HP                 uint16
+	MP                 uint16
+	Experience         int64
+	AttackMode         AttackMode
+	PetMode            PetMode
+	Gold               uint64 `codec:"-"` // 编码时，忽略这个字段，只用在数据库查询
+	HasExpandedStorage bool   `codec:"-"` // 仓库是否已扩展
 }
 
 // CharacterUserItem 角色物品关系
@@ -83,6 +91,65 @@ type GameShopItem struct {
 	//CreateDate
 }
 
+// Friend 好友和黑名单
+type Friend struct {
+	ID          int `gorm:"primary_key"`
+	CharacterID int
+	FriendID    int
+	Memo        string
+	Blocked     bool
+}
+
+// CharacterPet 下线时保存的宠物，上线时重新召唤
+type CharacterPet struct {
+	ID          int `gorm:"primary_key"`
+	CharacterID int
+	MonsterID   int
+	HP          uint32
+	Experience  int
+	Level       uint16
+	MaxLevel    uint16
+}
+
+// GameShopLog 商城购买记录
+type GameShopLog struct {
+	ID             int `gorm:"primary_key"`
+	AccountID      int
+	CharacterID    int
+	GameShopItemID int
+	Count          int
+	CreditCost     int
+	GoldCost       int
+	CreateTime     int64
+}
+
+// NPCTradeLog NPC 交易记录，补货记录的 CharacterID 为 0，Count 为补充的数量
+type NPCTradeLog struct {
+	ID          int `gorm:"primary_key"`
+	Type        NPCTradeType
+	NPCName     string
+	MapID       int
+	CharacterID int
+	ItemID      int
+	Count       int
+	GoldCost    int
+	PearlCost   int
+	CreateTime  int64
+}
+
+// Mail 邮件，背包满时商城购买的物品通过邮件发送
+type Mail struct {
+	ID          int `gorm:"primary_key"`
+	CharacterID int
+	Sender      string
+	Message     string
+	ItemID      int32
+	Count       uint32
+	Gold        uint64
+	Collected   bool
+	CreateTime  int64
+}
+
 type ItemInfo struct {
 	ID             int32 `gorm:"primary_key"`
 	Name           string
@@ -146,6 +213,8 @@ type ItemInfo struct {
 	CanAwakening   bool
 	IsToolTip      bool
 	ToolTip        string
+
+	ExpRate uint8 `codec:"-"` // 装备增加的经验百分比，只用在服务端，不发给客户端
 }
 
 type MagicInfo struct {
@@ -155,12 +224,12 @@ type MagicInfo struct {
 	BaseCost        int
 	LevelCost       int
 	Icon            int
-	Level1          int
-	Level2          int
-	Level3          int
-	Need1           int
-	Need2           int
-	Need3           int
+	Level1          int `gorm:"Column:level_1"`
+	Level2          int `gorm:"Column:level_2"`
+	Level3          int `gorm:"Column:level_3"`
+	Need1           int `gorm:"Column:need_1"`
+	Need2           int `gorm:"Column:need_2"`
+	Need3           int `gorm:"Column:need_3"`
 	DelayBase       int
 	DelayReduction  int
 	PowerBase       int
@@ -351,12 +420,58 @@ type UserItem struct {
 	CriticalDamage uint8
 	Freezing       uint8
 	PoisonAttack   uint8
+	GemCount       uint8     `codec:"-"` // 已镶嵌宝石数量，以下字段只用在数据库，不发给客户端
+	AwakeType      AwakeType `codec:"-"` // 觉醒类型
+	AwakeLevel     uint8     `codec:"-"` // 觉醒等级
+	AwakeValue     uint8     `codec:"-"` // 觉醒增加的属性总值
 }
 
 func (u UserItem) String() string {
 	return fmt.Sprintf("UserItem ID: %d, ItemID: %d, Count: %d", u.ID, u.ItemID, u.Count)
 }
 
+// AddedStats 附加属性总和
+func (u *UserItem) AddedStats() int {
+	return int(u.AC) + int(u.MAC) + int(u.DC) + int(u.MC) + int(u.SC) + int(u.Accuracy) + int(u.Agility) +
+		int(u.HP) + int(u.MP) + int(u.AttackSpeed) + int(u.Luck) + int(u.Strong) + int(u.MagicResist) +
+		int(u.PoisonResist) + int(u.HealthRecovery) + int(u.ManaRecovery) + int(u.PoisonRecovery) +
+		int(u.CriticalRate) + int(u.CriticalDamage) + int(u.Freezing) + int(u.PoisonAttack)
+}
+
+// Price 物品价值，根据持久和附加属性折算，包含数量
+func (u *UserItem) Price(info *ItemInfo) uint64 {
+	if info == nil {
+		return 0
+	}
+	p := float64(info.Price)
+	if info.Durability > 0 {
+		r := float64(info.Price) / 2 / float64(info.Durability)
+		p = float64(u.MaxDura) * r
+		r = 0
+		if u.MaxDura > 0 {
+			r = float64(u.CurrentDura) / float64(u.MaxDura)
+		}
+		p = math.Floor(p/2 + p/2*r + float64(info.Price)/2)
+	}
+	p = p * (float64(u.AddedStats())*0.1 + 1)
+	return uint64(p) * uint64(u.Count)
+}
+
+// RepairPrice 修理到满持久需要的价格
+func (u *UserItem) RepairPrice(info *ItemInfo) uint64 {
+	if info == nil || info.Durability == 0 {
+		return 0
+	}
+	p := math.Floor(float64(u.MaxDura)*(float64(info.Price)/2/float64(info.Durability)) + float64(info.Price)/2)
+	p = p * (float64(u.AddedStats())*0.1 + 1)
+	full := uint64(p) * uint64(u.Count)
+	price := u.Price(info)
+	if full < price {
+		return 0
+	}
+	return full - price
+}
+
 type UserMagic struct {
 	ID          int `gorm:"primary_key"`
 	CharacterID int
@@ -366,35 +481,115 @@ type UserMagic struct {
 	Key         int `gorm:"Column:magic_key"` // byte
 	Experience  int // uint16
 	IsTempSpell bool
-	CastTime    int // int64
-	//Magic       MagicInfo `gorm:"-"` // orm ignore
+	CastTime    int64      // 上次施法的时间戳 (毫秒)
+	Info        *MagicInfo `gorm:"-"`
+}
+
+// GetMultiplier 伤害倍率，数据库中倍率为 0 时按 1 计算
+func (um *UserMagic) GetMultiplier() float32 {
+	if um.Info == nil {
+		return 1
+	}
+	base := um.Info.MultiplierBase
+	if base == 0 {
+		base = 1
+	}
+	return base + float32(um.Level)*um.Info.MultiplierBonus
 }
 
-// TODO
+// GetDamage 技能伤害 (基础伤害 + 技能威力) * 倍率
 func (um *UserMagic) GetDamage(damageBase int) int {
-	return 0
+	return int(float32(damageBase+um.power()) * um.GetMultiplier())
 }
 
-// TODO
+// GetPower 以 power 为基础计算技能威力
 func (um *UserMagic) GetPower(power int) int {
-	// return (int)Math.Round(power / 4F * (Level + 1) + DefPower());
-	return 0
+	return int(math.Round(float64(power)/4*float64(um.Level+1))) + um.DefPower()
 }
 
+// power 以 MPower 为基础计算技能威力
+func (um *UserMagic) power() int {
+	return um.GetPower(um.MPower())
+}
+
+// MPower 技能随机魔法威力
 func (um *UserMagic) MPower() int {
-	// 	if (Info.MPowerBonus > 0)
-	// 	{
-	// 		return SMain.Envir.Random.Next(Info.MPowerBase, Info.MPowerBonus + Info.MPowerBase);
-	// 	}
-	// 	else
-	// 		return Info.MPowerBase;
-	return 0
+	if um.Info == nil {
+		return 0
+	}
+	return randomBonus(um.Info.MPowerBase, um.Info.MPowerBonus)
+}
+
+// DefPower 技能随机基础威力
+func (um *UserMagic) DefPower() int {
+	if um.Info == nil {
+		return 0
+	}
+	return randomBonus(um.Info.PowerBase, um.Info.PowerBonus)
+}
+
+// GetDelay 技能冷却时间 (毫秒)
+func (um *UserMagic) GetDelay() int {
+	if um.Info == nil {
+		return 0
+	}
+	return um.Info.DelayBase - um.Level*um.Info.DelayReduction
+}
+
+// CastReady 技能冷却是否已经结束，now 为毫秒时间戳
+func (um *UserMagic) CastReady(now int64) bool {
+	return um.CastTime == 0 || now >= um.CastTime+int64(um.GetDelay())
+}
+
+// Train 技能增加 exp 点熟练度，playerLevel 为人物等级，
+// 人物等级和熟练度都达到要求时技能升级。返回熟练度是否增加以及是否升级
+func (um *UserMagic) Train(playerLevel, exp int) (trained, leveled bool) {
+	if um.Info == nil {
+		return false, false
+	}
+	var level, need int
+	switch um.Level {
+	case 0:
+		level, need = um.Info.Level1, um.Info.Need1
+	case 1:
+		level, need = um.Info.Level2, um.Info.Need2
+	case 2:
+		level, need = um.Info.Level3, um.Info.Need3
+	default:
+		return false, false
+	}
+	if playerLevel < level {
+		return false, false
+	}
+	um.Experience += exp
+	if um.Experience >= need {
+		um.Level++
+		um.Experience -= need
+		leveled = true
+	}
+	return true, leveled
+}
+
+// NowMillis 当前毫秒时间戳，用于技能冷却
+func NowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// randomBonus 返回 [base, base+bonus) 之间的随机数，bonus 为 0 时返回 base
+func randomBonus(base, bonus int) int {
+	if bonus <= 0 {
+		return base
+	}
+	return base + rand.Intn(bonus)
 }
 
 func (um *UserMagic) GetClientMagic(info *MagicInfo) ClientMagic {
 	delay := info.DelayBase - (um.Level * info.DelayReduction)
-	//castTime := (CastTime != 0) && (SMain.Envir.Time > CastTime) ? SMain.Envir.Time - CastTime : 0
-	castTime := 0
+	// 客户端用距离上次施法过去的时间计算剩余冷却
+	var castTime int64
+	if now := NowMillis(); um.CastTime != 0 && now > um.CastTime {
+		castTime = now - um.CastTime
+	}
 	return ClientMagic{
 		Spell:      um.Spell,
 		BaseCost:   uint8(info.BaseCost),
@@ -105,3 +105,74 @@ func TestUserMagic(t *testing.T) {
 	db.Table("user_magic").Where("id = ?", "不存在").Find(&um)
 	t.Log(um)
 }
+
+func TestUserItemPrice(t *testing.T) {
+	info := &ItemInfo{Price: 1000, Durability: 10000}
+	ui := &UserItem{CurrentDura: 10000, MaxDura: 10000, Count: 1}
+	if p := ui.Price(info); p != 1000 {
+		t.Errorf("full dura price expect 1000, got %d", p)
+	}
+	if p := ui.RepairPrice(info); p != 0 {
+		t.Errorf("full dura repair price expect 0, got %d", p)
+	}
+	ui.CurrentDura = 0
+	if p := ui.Price(info); p != 750 {
+		t.Errorf("zero dura price expect 750, got %d", p)
+	}
+	if p := ui.RepairPrice(info); p != 250 {
+		t.Errorf("zero dura repair price expect 250, got %d", p)
+	}
+	ui.DC = 10
+	if p := ui.Price(info); p != 1500 {
+		t.Errorf("added stats price expect 1500, got %d", p)
+	}
+}
+
+func TestUserMagicGetDamage(t *testing.T) {
+	um := &UserMagic{Level: 2}
+	if d := um.GetDamage(10); d != 10 {
+		t.Errorf("damage without info: %d", d)
+	}
+	// 倍率为 0 时按 1 计算，威力 = round(8/4*3) + 3 = 9
+	um.Info = &MagicInfo{PowerBase: 3, MPowerBase: 8}
+	if d := um.GetDamage(10); d != 19 {
+		t.Errorf("damage with default multiplier: %d", d)
+	}
+	um.Info.MultiplierBase = 1.4
+	um.Info.MultiplierBonus = 0.4
+	if m := um.GetMultiplier(); m < 2.19 || m > 2.21 {
+		t.Errorf("multiplier: %f", m)
+	}
+	if d := um.GetDamage(10); d != 41 {
+		t.Errorf("damage with multiplier: %d", d)
+	}
+	um.Info.DelayBase, um.Info.DelayReduction = 1800, 100
+	if d := um.GetDelay(); d != 1600 {
+		t.Errorf("delay: %d", d)
+	}
+}
+
+func TestUserMagicTrain(t *testing.T) {
+	um := &UserMagic{Info: &MagicInfo{Level1: 7, Need1: 50, Level2: 11, Need2: 100, Level3: 16, Need3: 200, DelayBase: 1000}}
+	if trained, _ := um.Train(6, 3); trained {
+		t.Errorf("trained below required level")
+	}
+	if trained, leveled := um.Train(7, 49); !trained || leveled {
+		t.Errorf("train: %v %v", trained, leveled)
+	}
+	if _, leveled := um.Train(7, 3); !leveled || um.Level != 1 || um.Experience != 2 {
+		t.Errorf("level up: %v level %d exp %d", leveled, um.Level, um.Experience)
+	}
+	um.Level = 3
+	if trained, _ := um.Train(50, 3); trained {
+		t.Errorf("trained at max level")
+	}
+
+	if !um.CastReady(100) {
+		t.Errorf("never cast magic should be ready")
+	}
+	um.CastTime = 1000
+	if um.CastReady(1999) || !um.CastReady(2000) {
+		t.Errorf("cast delay not applied")
+	}
+}
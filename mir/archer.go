@@ -0,0 +1,272 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+const (
+	RangeAttackDistance = 9  // 弓箭手远程攻击的最远距离
+	RangeFalloff        = 5  // 距离超过 2 格后每远一格伤害减少的百分比
+	ArrowShape          = 3  // 箭矢: 装备在护身符栏，Shape 为 3 的物品
+	arrowSpeed          = 50 // 箭矢每飞行一格需要的毫秒数
+)
+
+// hasBow 是否装备了弓，只有弓箭手能装备的武器都算作弓
+func (p *Player) hasBow() bool {
+	weapon := p.Equipment[common.EquipmentSlotWeapon]
+	if weapon.ID == 0 {
+		return false
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(weapon.ItemID))
+	return info != nil && info.RequiredClass == common.RequiredClassArcher
+}
+
+// GetArrows 获取玩家身上装备的箭矢
+func (p *Player) GetArrows() *common.UserItem {
+	userItem := &p.Equipment[common.EquipmentSlotAmulet]
+	if userItem.ID == 0 || userItem.Count == 0 {
+		return nil
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(userItem.ItemID))
+	if info == nil || info.Type != common.ItemTypeAmulet || info.Shape != ArrowShape {
+		return nil
+	}
+	return userItem
+}
+
+// rangeDistance 两点之间的格子距离
+func rangeDistance(a, b common.Point) int {
+	dx := AbsInt(int(a.X) - int(b.X))
+	dy := AbsInt(int(a.Y) - int(b.Y))
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// rangeDamage 距离衰减后的伤害，最低保留一半
+func rangeDamage(damage, distance int) int {
+	if distance <= 2 {
+		return damage
+	}
+	percent := 100 - (distance-2)*RangeFalloff
+	if percent < 50 {
+		percent = 50
+	}
+	return damage * percent / 100
+}
+
+// RangeAttack 弓箭手远程攻击，每次消耗一支箭，箭矢飞到目标后才造成伤害
+func (p *Player) RangeAttack(direction common.MirDirection, location common.Point, id uint32) {
+	if !p.CanAttack() || !p.hasBow() || !InRange(p.CurrentLocation, location, RangeAttackDistance) {
+		p.Enqueue(ServerMessage{}.UserLocation(p))
+		return
+	}
+	arrows := p.GetArrows()
+	if arrows == nil {
+		p.ReceiveChat("没有箭矢", common.ChatTypeSystem)
+		p.Enqueue(ServerMessage{}.UserLocation(p))
+		return
+	}
+	var target IMapObject
+	if id != 0 {
+		target = p.Map.GetObjectInAreaByID(id, location)
+	}
+	if target != nil && target.IsAttackTarget(p) {
+		location = target.GetPoint()
+	} else {
+		target, id = nil, 0
+	}
+	p.ConsumeItem(arrows, 1)
+	p.CurrentDirection = direction
+	p.Enqueue(ServerMessage{}.UserLocation(p))
+	p.Broadcast(&server.ObjectRangeAttack{
+		ObjectID:  p.GetID(),
+		Location:  p.CurrentLocation,
+		Direction: direction,
+		TargetID:  id,
+		Target:    location,
+	})
+	distance := rangeDistance(p.CurrentLocation, location)
+	damage := rangeDamage(p.stealthDamage(p.GetAttackPower(int(p.MinDC), int(p.MaxDC))), distance)
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeRangeDamage, NewTask(p.completeRangeAttack, target, location, damage))
+	action.ActionTime = time.Now().Add(time.Duration(distance*arrowSpeed) * time.Millisecond)
+	p.ActionList.Store(action.ID, action)
+}
+
+// completeRangeAttack 箭矢命中，目标已经离开原来的位置时落空
+func (p *Player) completeRangeAttack(args ...interface{}) {
+	location := args[1].(common.Point)
+	damage := args[2].(int)
+	target, _ := args[0].(IMapObject)
+	if target == nil {
+		p.Map.rangeAttackTargets(p, location, func(o IMapObject) {
+			attackObject(o, p, damage, common.DefenceTypeACAgility, true)
+		})
+		return
+	}
+	if target.IsDead() || !target.IsAttackTarget(p) || !InRange(target.GetPoint(), location, 1) {
+		return
+	}
+	if attackObject(target, p, damage, common.DefenceTypeACAgility, true) == 0 {
+		return
+	}
+	if focus := p.GetMagic(common.SpellFocus); focus != nil {
+		p.LevelMagic(focus)
+	}
+}
+
+// shootMagic 弓箭手的射击技能，伤害随距离衰减，count 为射出的箭数
+func (p *Player) shootMagic(target IMapObject, magic *common.UserMagic, count int) bool {
+	if target == nil || !target.IsAttackTarget(p) || !p.hasBow() {
+		return false
+	}
+	distance := rangeDistance(p.CurrentLocation, target.GetPoint())
+	damage := rangeDamage(magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC))), distance)
+	if b := p.GetBuff(common.BuffTypeConcentration); b != nil {
+		damage += damage * b.Values / 100
+	}
+	for i := 0; i < count; i++ {
+		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, damage, target))
+		action.ActionTime = time.Now().Add(time.Duration(distance*arrowSpeed+i*200) * time.Millisecond)
+		p.ActionList.Store(action.ID, action)
+	}
+	return true
+}
+
+// shotEffect 射击技能命中后的附加效果
+func (p *Player) shotEffect(target IMapObject, magic *common.UserMagic, damage int) {
+	switch magic.Spell {
+	case common.SpellVampireShot:
+		p.ChangeHP(damage * (magic.Level + 1) / 4)
+	case common.SpellPoisonShot:
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, damage/5+1, common.PoisonTypeGreen, time.Second, (magic.Level+1)*5), p)
+	case common.SpellCrippleShot:
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeSlow, time.Second, magic.Level+2), p)
+	case common.SpellDelayedExplosion:
+		// 5 秒后以目标为中心爆炸
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeDelayedExplosion, time.Second, 5), p)
+		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, damage, target))
+		action.ActionTime = time.Now().Add(5 * time.Second)
+		p.Map.PushAction(action)
+	}
+}
+
+// BindingShot 束缚射击，使怪物一段时间内不能行动
+func (p *Player) BindingShot(target IMapObject, magic *common.UserMagic) bool {
+	monster, ok := target.(*Monster)
+	if !ok || monster.IsDead() || monster.Master != nil || !monster.IsAttackTarget(p) || !p.hasBow() {
+		return false
+	}
+	if int(monster.Level) > int(p.Level)+2 || monster.IsParalysed() {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, monster))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
+
+// ExplosiveTrap 爆裂陷阱，在身前放置陷阱，敌人踩到时爆炸
+func (p *Player) ExplosiveTrap(magic *common.UserMagic) bool {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	duration := time.Duration(magic.Level+1) * 20 * time.Second
+	if !p.Map.spawnSpell(p, common.SpellExplosiveTrap, damage, p.GetFrontPoint(), duration, time.Second, true) {
+		return false
+	}
+	p.LevelMagic(magic)
+	return true
+}
+
+// BackStep 后跳，面朝前方向后跳开
+func (p *Player) BackStep(magic *common.UserMagic) bool {
+	dir := common.MirDirection((int(p.CurrentDirection) + 4) % 8)
+	moved := 0
+	for ; moved < magic.Level+1; moved++ {
+		n := p.CurrentLocation.NextPoint(dir, 1)
+		if !p.Map.UpdateObject(p, n) {
+			break
+		}
+		p.CurrentLocation = n
+	}
+	if moved == 0 {
+		return false
+	}
+	p.Enqueue(&server.Pushed{Location: p.CurrentLocation, Direction: p.CurrentDirection})
+	p.Broadcast(&server.ObjectPushed{ObjectID: p.GetID(), Location: p.CurrentLocation, Direction: p.CurrentDirection})
+	processSpells(p)
+	p.LevelMagic(magic)
+	return true
+}
+
+// Concentration 凝神，一段时间内射击技能伤害提高
+func (p *Player) Concentration(magic *common.UserMagic) bool {
+	if p.GetBuff(common.BuffTypeConcentration) != nil {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
+
+// ElementalBarrier 元素盾，一段时间内按比例吸收受到的伤害
+func (p *Player) ElementalBarrier(magic *common.UserMagic) bool {
+	if time.Now().Before(p.BarrierTime) {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, magic.GetPower(p.GetAttackPower(int(p.MinMC), int(p.MaxMC))+15)))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
+
+// processBarrier 元素盾到期后通知客户端
+func (p *Player) processBarrier() {
+	if p.Barrier == 0 || time.Now().Before(p.BarrierTime) {
+		return
+	}
+	p.Barrier = 0
+	msg := &server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectElementalBarrierDown}
+	p.Enqueue(msg)
+	p.Broadcast(msg)
+}
+
+// MentalState 心法，在三种射击状态之间切换，状态保存在 Buff 的值中
+func (p *Player) MentalState(magic *common.UserMagic) {
+	state := 0
+	if b := p.GetBuff(common.BuffTypeMentalState); b != nil {
+		state = (b.Values + 1) % 3
+	}
+	buff := NewBuff(p.NewObjectID(), common.BuffTypeMentalState, state, time.Now())
+	buff.Infinite = true
+	buff.Visible = true
+	p.AddBuff(buff)
+	p.LevelMagic(magic)
+}
+
+// OneWithNature 天人合一，对目标周围造成范围伤害
+func (p *Player) OneWithNature(target IMapObject, magic *common.UserMagic, location common.Point) bool {
+	if !p.hasBow() {
+		return false
+	}
+	if target != nil {
+		location = target.GetPoint()
+	}
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	p.pushAreaSpell(magic, damage, location)
+	return true
+}
+
+// NapalmShot 火焰射击，在目标周围燃起火焰
+func (p *Player) NapalmShot(target IMapObject, magic *common.UserMagic, location common.Point) bool {
+	if !p.hasBow() {
+		return false
+	}
+	if target != nil {
+		location = target.GetPoint()
+	}
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	p.pushAreaSpell(magic, damage, location)
+	return true
+}
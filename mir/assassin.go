@@ -0,0 +1,189 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// isStealthBuff 使玩家隐身的 Buff
+func isStealthBuff(typ common.BuffType) bool {
+	switch typ {
+	case common.BuffTypeHiding, common.BuffTypeMoonLight, common.BuffTypeDarkBody:
+		return true
+	}
+	return false
+}
+
+// stealthDuration 月影术和烈火身的持续时间，和防御有关
+func (p *Player) stealthDuration(magic *common.UserMagic) time.Duration {
+	return time.Duration(p.GetAttackPower(int(p.MinAC), int(p.MaxAC))+(magic.Level+1)*5) * 500 * time.Millisecond
+}
+
+// Stealth 月影术、烈火身，隐身直到持续时间结束或者发动攻击
+func (p *Player) Stealth(magic *common.UserMagic) {
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
+	p.ActionList.Store(action.ID, action)
+}
+
+// completeStealth 添加月影术、烈火身的 Buff
+func (p *Player) completeStealth(magic *common.UserMagic, typ common.BuffType) {
+	if p.GetBuff(common.BuffTypeMoonLight) != nil || p.GetBuff(common.BuffTypeDarkBody) != nil {
+		return
+	}
+	buff := NewBuff(p.NewObjectID(), typ, 0, time.Now().Add(p.stealthDuration(magic)))
+	buff.Visible = true
+	p.AddBuff(buff)
+	p.LevelMagic(magic)
+}
+
+// stealthDamage 月影术、烈火身状态下攻击伤害按技能加成，攻击后现身
+func (p *Player) stealthDamage(damage int) int {
+	var magic *common.UserMagic
+	if p.GetBuff(common.BuffTypeDarkBody) != nil {
+		magic = p.GetMagic(common.SpellDarkBody)
+	} else if p.GetBuff(common.BuffTypeMoonLight) != nil {
+		magic = p.GetMagic(common.SpellMoonLight)
+	}
+	if magic == nil {
+		return damage
+	}
+	p.expireBuffs(common.BuffTypeMoonLight, common.BuffTypeDarkBody)
+	return magic.GetDamage(damage)
+}
+
+// expireBuffs 让 Buff 立即过期，下一次 ProcessBuffs 时移除
+func (p *Player) expireBuffs(types ...common.BuffType) {
+	now := time.Now()
+	for _, b := range p.Buffs {
+		for _, typ := range types {
+			if b.BuffType == typ {
+				b.Infinite = false
+				b.ExpireTime = now
+			}
+		}
+	}
+}
+
+// PoisonSword 毒刃，使前方 3x3 范围内的目标中绿毒
+func (p *Player) PoisonSword(magic *common.UserMagic) {
+	front := p.CurrentLocation.NextPoint(p.CurrentDirection, 1)
+	value := magic.GetPower(p.GetAttackPower(int(p.MinDC), int(p.MaxDC)))/5 + 1
+	tickNum := (magic.Level + 1) * 5
+	hit := false
+	p.Map.RangeObject(front, 1, func(o IMapObject) bool {
+		if o == IMapObject(p) || !o.IsAttackTarget(p) {
+			return true
+		}
+		o.ApplyPoison(NewPoison(p.NewObjectID(), p, value, common.PoisonTypeGreen, time.Second, tickNum), p)
+		hit = true
+		return true
+	})
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
+
+// broadcastHidden 隐身状态改变时通知周围玩家
+func (p *Player) broadcastHidden() {
+	p.Broadcast(&server.ObjectHidden{ObjectID: p.GetID(), Hidden: p.IsHidden()})
+}
+
+// FlashDash 拔刀术，向前冲一格，前方的目标有几率被击晕
+func (p *Player) FlashDash(magic *common.UserMagic) {
+	dir := p.CurrentDirection
+	hit := false
+	if n := p.CurrentLocation.NextPoint(dir, 1); p.Map.UpdateObject(p, n) {
+		p.CurrentLocation = n
+		p.Enqueue(&server.UserDash{Location: p.CurrentLocation, Direction: dir})
+		p.Broadcast(&server.ObjectDash{ObjectID: p.GetID(), Location: p.CurrentLocation, Direction: dir})
+		processSpells(p)
+		hit = true
+	}
+	p.Map.rangeAttackTargets(p, p.CurrentLocation.NextPoint(dir, 1), func(o IMapObject) {
+		if RandomNext(20) >= 6+magic.Level*3 {
+			return
+		}
+		o.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeParalysis, time.Second, magic.Level+1), p)
+		o.Broadcast(&server.ObjectEffect{ObjectID: o.GetID(), Effect: common.SpellEffectStunned})
+		hit = true
+	})
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
+
+// Trap 困魔咒，在怪物脚下放置陷阱，站在陷阱上的怪物不能行动
+func (p *Player) Trap(target IMapObject, magic *common.UserMagic) bool {
+	monster, ok := target.(*Monster)
+	if !ok || monster.IsDead() || monster.Master != nil || !monster.IsAttackTarget(p) || int(monster.Level) > int(p.Level)+2 {
+		return false
+	}
+	duration := time.Duration(magic.Level+1) * 5 * time.Second
+	if !p.Map.spawnSpell(p, common.SpellTrap, 0, monster.GetPoint(), duration, time.Second, true) {
+		return false
+	}
+	processSpells(monster)
+	p.LevelMagic(magic)
+	return true
+}
+
+// SwiftFeet 轻身步，一段时间内提高移动速度，跑步的速度由客户端处理
+func (p *Player) SwiftFeet(magic *common.UserMagic) bool {
+	if p.GetBuff(common.BuffTypeSwiftFeet) != nil {
+		return false
+	}
+	buff := NewBuff(p.NewObjectID(), common.BuffTypeSwiftFeet, 1, time.Now().Add(time.Duration(25+magic.Level*5)*time.Second))
+	buff.Visible = true
+	p.AddBuff(buff)
+	p.LevelMagic(magic)
+	return true
+}
+
+// CrescentSlash 月影斩，攻击除身后三格以外的周围五格
+func (p *Player) CrescentSlash(magic *common.UserMagic) {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinDC), int(p.MaxDC)))
+	hit := false
+	for _, d := range []int{6, 7, 0, 1, 2} {
+		dir := common.MirDirection((int(p.CurrentDirection) + d) % 8)
+		if p.attackCell(p.CurrentLocation.NextPoint(dir, 1), damage) {
+			hit = true
+		}
+	}
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
+
+// hemorrhage 血风击，普通攻击有几率造成额外伤害，返回触发的技能
+func (p *Player) hemorrhage() *common.UserMagic {
+	magic := p.GetMagic(common.SpellHemorrhage)
+	if magic == nil || RandomNext(100) >= 10+magic.Level*5 {
+		return nil
+	}
+	return magic
+}
+
+// bleed 血风击命中后使目标流血
+func (p *Player) bleed(location common.Point, magic *common.UserMagic, damage int) {
+	p.Map.rangeAttackTargets(p, location, func(o IMapObject) {
+		o.ApplyPoison(NewPoison(p.NewObjectID(), p, damage/2+1, common.PoisonTypeBleeding, time.Second, 5), p)
+		o.Broadcast(&server.ObjectEffect{ObjectID: o.GetID(), Effect: common.SpellEffectBleeding})
+	})
+	p.Broadcast(&server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectHemorrhage})
+	p.LevelMagic(magic)
+}
+
+// mpEater 吸魔，攻击命中时有几率恢复魔法值
+func (p *Player) mpEater() {
+	magic := p.GetMagic(common.SpellMPEater)
+	if magic == nil || RandomNext(100) >= 10+magic.Level*5 {
+		return
+	}
+	p.ChangeMP(int(p.MaxMP) * (magic.Level + 1) / 20)
+	msg := &server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectMPEater}
+	p.Enqueue(msg)
+	p.Broadcast(msg)
+	p.LevelMagic(magic)
+}
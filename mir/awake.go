@@ -0,0 +1,155 @@
+package mir
+
+import (
+	"strconv"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+const (
+	MaxAwakeLevel        = 5     // 觉醒等级上限
+	AwakeDowngradeGold   = 10000 // 每个觉醒等级降级花费
+	ResetAddedItemGold   = 50000 // 重置附加属性花费
+	DisassembleGoldRate  = 10    // 分解花费为物品价格的 1/10
+	AwakeFailDowngradeIn = 2     // 觉醒失败时 1/2 概率降一级
+)
+
+// 觉醒材料，名字后面加上物品品质 0-3 就是实际物品名，例如 BraveryGlyph0
+var awakeGlyphNames = map[common.AwakeType]string{
+	common.AwakeTypeDC:   "BraveryGlyph",
+	common.AwakeTypeMC:   "MagicGlyph",
+	common.AwakeTypeSC:   "SoulGlyph",
+	common.AwakeTypeAC:   "ProtectionGlyph",
+	common.AwakeTypeMAC:  "EvilSlayerGlyph",
+	common.AwakeTypeHPMP: "BodyGlyph",
+}
+
+const awakeSoulName = "AwakeningSoul"
+
+// 每个觉醒等级的成功率
+var awakeChance = [MaxAwakeLevel]int{90, 70, 50, 30, 15}
+
+// awakeGrade 物品品质对应的材料等级 0-3
+func awakeGrade(info *common.ItemInfo) int {
+	g := int(info.Grade) - 1
+	if g < 0 {
+		g = 0
+	}
+	if g > 3 {
+		g = 3
+	}
+	return g
+}
+
+// CanAwake 物品是否可以觉醒成该类型
+func CanAwake(info *common.ItemInfo, typ common.AwakeType) bool {
+	if !info.CanAwakening {
+		return false
+	}
+	switch info.Type {
+	case common.ItemTypeWeapon:
+		return typ == common.AwakeTypeDC || typ == common.AwakeTypeMC || typ == common.AwakeTypeSC
+	case common.ItemTypeArmour, common.ItemTypeHelmet:
+		return typ == common.AwakeTypeAC || typ == common.AwakeTypeMAC
+	case common.ItemTypeNecklace, common.ItemTypeBracelet, common.ItemTypeRing, common.ItemTypeBelt, common.ItemTypeBoots:
+		return typ == common.AwakeTypeHPMP
+	}
+	return false
+}
+
+// AwakeMaterials 觉醒到下一级需要的材料和数量
+func (db *GameDB) AwakeMaterials(ui *common.UserItem, info *common.ItemInfo, typ common.AwakeType) ([]*common.ItemInfo, []uint32) {
+	name, ok := awakeGlyphNames[typ]
+	if !ok {
+		return nil, nil
+	}
+	grade := strconv.Itoa(awakeGrade(info))
+	glyph := db.GetItemInfoByName(name + grade)
+	soul := db.GetItemInfoByName(awakeSoulName + grade)
+	if glyph == nil || soul == nil {
+		return nil, nil
+	}
+	count := uint32(ui.AwakeLevel) + 1
+	return []*common.ItemInfo{glyph, soul}, []uint32{count, count}
+}
+
+// AwakeValue 觉醒每级增加的属性
+func AwakeValue(info *common.ItemInfo) uint8 {
+	return uint8(RandomInt(1, awakeGrade(info)+2))
+}
+
+// AwakeStats 觉醒增加的属性 ac, mac, dc, mc, sc, hp, mp
+func AwakeStats(ui *common.UserItem) (ac, mac, dc, mc, sc, hp, mp int) {
+	v := int(ui.AwakeValue)
+	switch ui.AwakeType {
+	case common.AwakeTypeDC:
+		dc = v
+	case common.AwakeTypeMC:
+		mc = v
+	case common.AwakeTypeSC:
+		sc = v
+	case common.AwakeTypeAC:
+		ac = v
+	case common.AwakeTypeMAC:
+		mac = v
+	case common.AwakeTypeHPMP:
+		hp = v * 10
+		mp = v * 10
+	}
+	return
+}
+
+// CanGem 宝石是否能镶嵌到该类型的装备上
+func CanGem(gem *common.ItemInfo, to *common.ItemInfo) bool {
+	mode := common.SpecialItemMode(gem.UniqueItem)
+	var need common.SpecialItemMode
+	switch to.Type {
+	case common.ItemTypeWeapon:
+		need = common.SpecialItemModeParalize
+	case common.ItemTypeArmour:
+		need = common.SpecialItemModeTeleport
+	case common.ItemTypeHelmet:
+		need = common.SpecialItemModeClearRing
+	case common.ItemTypeNecklace:
+		need = common.SpecialItemModeProtection
+	case common.ItemTypeBracelet:
+		need = common.SpecialItemModeRevival
+	case common.ItemTypeRing:
+		need = common.SpecialItemModeMuscle
+	case common.ItemTypeAmulet:
+		need = common.SpecialItemModeFlame
+	case common.ItemTypeBelt:
+		need = common.SpecialItemModeHealing
+	case common.ItemTypeBoots:
+		need = common.SpecialItemModeProbe
+	case common.ItemTypeStone:
+		need = common.SpecialItemModeSkill
+	case common.ItemTypeTorch:
+		need = common.SpecialItemModeNoDuraLoss
+	default:
+		return false
+	}
+	return mode&need != 0
+}
+
+// addGemStats 把宝石属性加到装备上
+func addGemStats(to *common.UserItem, gem *common.ItemInfo) {
+	to.AC += gem.MaxAC
+	to.MAC += gem.MaxMAC
+	to.DC += gem.MaxDC
+	to.MC += gem.MaxMC
+	to.SC += gem.MaxSC
+	to.Accuracy += gem.Accuracy
+	to.Agility += gem.Agility
+	to.AttackSpeed += gem.AttackSpeed
+	to.Freezing += gem.Freezing
+	to.PoisonAttack += gem.PoisonAttack
+	to.MagicResist += gem.MagicResist
+	to.PoisonResist += gem.PoisonResist
+	to.Strong += gem.Strong
+	to.HP += uint8(gem.HP)
+	to.MP += uint8(gem.MP)
+	if gem.Durability > 0 {
+		to.MaxDura += gem.Durability
+	}
+}
@@ -11,6 +11,10 @@ func (n *Node) Status() Status {
 	return n.status
 }
 
+func (n *Node) childNodes() []INode {
+	return n.children
+}
+
 func (n *Node) Reset() {
 	if n.status != READY {
 		n.status = READY
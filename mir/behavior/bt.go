@@ -2,6 +2,7 @@ package behavior
 
 import (
 	. "github.com/yenkeia/mirgo/mir"
+	"github.com/yenkeia/mirgo/setting"
 	"time"
 )
 
@@ -25,6 +26,8 @@ type BT struct {
 	timer   time.Duration // 记录从启动开始的时间
 	Root    INode
 	Monster *Monster
+	ai      int
+	lib     *Library // 创建 Root 时使用的行为树，重新加载后需要重新创建
 }
 
 func (c *BT) GetTime() time.Duration {
@@ -32,32 +35,91 @@ func (c *BT) GetTime() time.Duration {
 }
 
 func (c *BT) Process() {
+	if c.Monster.IsDead() {
+		return
+	}
+	if lib := Current(); lib != c.lib {
+		c.lib = lib
+		c.Root = newRoot(lib, c.ai)
+	}
 	c.timer += 1 * time.Second
 	c.Root.Visit(c)
 	c.Root.Step()
 }
 
+// DeathNode 怪物死亡时需要处理的节点
+type DeathNode interface {
+	OnDeath(*BT)
+}
+
+// OnDeath 通知行为树中所有的 DeathNode
+func (c *BT) OnDeath() {
+	walk(c.Root, func(n INode) {
+		if d, ok := n.(DeathNode); ok {
+			d.OnDeath(c)
+		}
+	})
+}
+
+func walk(n INode, fn func(INode)) {
+	fn(n)
+	if p, ok := n.(interface{ childNodes() []INode }); ok {
+		for _, child := range p.childNodes() {
+			walk(child, fn)
+		}
+	}
+}
+
 func init() {
 	SetMonsterBehaviorFactory(NewBehavior)
+	SetMonsterBehaviorLoader(Start)
 }
 
-func NewBehavior(id int, mon *Monster) IBehavior {
+// Start 加载行为树并开始监视文件修改，行为树有错误时返回错误
+func Start() error {
+	dir := setting.Conf.BehaviorDirPath
+	if err := Reload(dir); err != nil {
+		return err
+	}
+	go Watch(dir, ReloadInterval)
+	return nil
+}
 
-	var root INode
+func NewBehavior(id int, mon *Monster) IBehavior {
 
-	switch id {
-	case 2:
-		root = DeerBrain()
-	case 6:
-		root = GuardBrain()
-	default:
-		root = DefaultBrain()
-	}
+	lib := Current()
 
 	bt := &BT{
-		Root:    root,
+		Root:    newRoot(lib, id),
 		Monster: mon,
+		ai:      id,
+		lib:     lib,
 	}
 
 	return bt
 }
+
+// newRoot 优先使用数据文件中的行为树，没有时使用内置行为
+func newRoot(lib *Library, id int) INode {
+	if lib != nil {
+		root, err := lib.NewRoot(id)
+		if err != nil {
+			log.Warnln("创建怪物行为树错误", id, err.Error())
+		} else if root != nil {
+			return root
+		}
+	}
+	return BuiltinBrain(id)
+}
+
+// BuiltinBrain 内置行为，没有加载行为树文件时使用
+func BuiltinBrain(id int) INode {
+	switch id {
+	case 2:
+		return DeerBrain()
+	case 6:
+		return GuardBrain()
+	default:
+		return DefaultBrain()
+	}
+}
@@ -1,12 +1,32 @@
 package behavior
 
+import (
+	. "github.com/yenkeia/mirgo/mir"
+)
+
 // 追杀
 type ChaseAndAttackNode struct {
 	Node
+	inRange func(*BT) bool // 目标是否在攻击范围内
+	attack  func(*BT)      // 攻击目标
 }
 
 func ChaseAndAttack() INode {
-	return &ChaseAndAttackNode{}
+	return &ChaseAndAttackNode{
+		inRange: func(c *BT) bool { return c.Monster.InAttackRange() },
+		attack:  func(c *BT) { c.Monster.Attack() },
+	}
+}
+
+// chaseAndAttackInRange 追击目标，目标进入 distance 格内时用 attack 攻击
+func chaseAndAttackInRange(distance int, attack func(*BT)) *ChaseAndAttackNode {
+	return &ChaseAndAttackNode{
+		inRange: func(c *BT) bool {
+			target := c.Monster.Target.GetPoint()
+			return !target.Equal(c.Monster.CurrentLocation) && InRange(c.Monster.CurrentLocation, target, distance)
+		},
+		attack: attack,
+	}
 }
 
 func (n *ChaseAndAttackNode) Visit(c *BT) {
@@ -29,12 +49,12 @@ func (n *ChaseAndAttackNode) Visit(c *BT) {
 			n.status = SUCCESS
 			c.Monster.Target = nil
 		} else {
-			if c.Monster.InAttackRange() {
+			if n.inRange(c) {
 				if c.Monster.CanAttack() {
-					c.Monster.Attack()
+					n.attack(c)
 				}
 
-				if c.Monster.Target.IsDead() {
+				if c.Monster.Target != nil && c.Monster.Target.IsDead() {
 					c.Monster.Target = nil
 				}
 			} else {
@@ -0,0 +1,80 @@
+package behavior
+
+import (
+	"github.com/yenkeia/mirgo/common"
+	. "github.com/yenkeia/mirgo/mir"
+)
+
+// 逃跑，血量低于 below% 时远离目标，直到和目标相距 distance 格
+type FleeNode struct {
+	Node
+	below    int
+	distance int
+	goal     common.Point
+	hasGoal  bool
+}
+
+func Flee(args Args) (INode, error) {
+	n := &FleeNode{}
+	var err error
+	if n.below, err = args.Int("below", 20); err != nil {
+		return nil, err
+	}
+	if n.distance, err = args.Int("distance", 6); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// awayFrom 背对目标方向 distance 格外的位置
+func awayFrom(mp *Map, cur, target common.Point, distance int) (common.Point, error) {
+	sign := func(a, b uint32) int {
+		switch {
+		case a > b:
+			return 1
+		case a < b:
+			return -1
+		}
+		return 0
+	}
+	dx, dy := sign(cur.X, target.X), sign(cur.Y, target.Y)
+	if dx == 0 && dy == 0 {
+		dx = RandomInt(-1, 1)
+		dy = RandomInt(-1, 1)
+	}
+	x := clamp(int(cur.X)+dx*distance, 0, mp.Width-1)
+	y := clamp(int(cur.Y)+dy*distance, 0, mp.Height-1)
+	return mp.GetValidPoint(x, y, 2)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func (n *FleeNode) Visit(c *BT) {
+	m := c.Monster
+	n.status = FAILED
+	if m.Target == nil || m.MaxHP == 0 || int(m.HP*100/m.MaxHP) >= n.below {
+		n.hasGoal = false
+		return
+	}
+	n.status = SUCCESS
+	target := m.Target.GetPoint()
+	if !InRange(m.CurrentLocation, target, n.distance-1) {
+		return
+	}
+	if !n.hasGoal || m.CurrentLocation.Equal(n.goal) || InRange(n.goal, target, n.distance/2) {
+		goal, err := awayFrom(m.Map, m.CurrentLocation, target, n.distance)
+		if err != nil {
+			return
+		}
+		n.goal, n.hasGoal = goal, true
+	}
+	m.MoveTo(n.goal)
+}
@@ -0,0 +1,39 @@
+package behavior
+
+import "time"
+
+// 自我治疗，血量低于 below% 时每隔 interval 恢复 percent% 的血量
+type HealSelfNode struct {
+	Node
+	below    int
+	percent  int
+	interval time.Duration
+}
+
+func HealSelf(args Args) (INode, error) {
+	n := &HealSelfNode{}
+	var err error
+	if n.below, err = args.Int("below", 50); err != nil {
+		return nil, err
+	}
+	if n.percent, err = args.Int("percent", 10); err != nil {
+		return nil, err
+	}
+	if n.interval, err = args.Duration("interval", 5*time.Second); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *HealSelfNode) Visit(c *BT) {
+	m := c.Monster
+	now := time.Now()
+	n.status = FAILED
+	if now.Before(m.HealTime) || m.MaxHP == 0 || int(m.HP*100/m.MaxHP) >= n.below {
+		return
+	}
+	if m.Heal(int(m.MaxHP) * n.percent / 100) {
+		m.HealTime = now.Add(n.interval)
+		n.status = SUCCESS
+	}
+}
@@ -0,0 +1,275 @@
+package behavior
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davyxu/golog"
+	. "github.com/yenkeia/mirgo/mir"
+)
+
+var log = golog.New("server.behavior")
+
+// DefaultTree 没有配置 AI 映射的怪物使用的行为树名字
+const DefaultTree = "default"
+
+// ReloadInterval 检查行为树文件是否修改的间隔
+const ReloadInterval = 5 * time.Second
+
+// NodeSpec 数据文件中的节点，Type 为组合节点类型或者注册过的叶子节点名字
+type NodeSpec struct {
+	Type     string      `json:"type"`
+	Period   string      `json:"period,omitempty"` // Priority 重新选择子节点的间隔，如 "1s"
+	Cond     string      `json:"cond,omitempty"`   // If、While、Condition 使用的条件
+	Args     Args        `json:"args,omitempty"`   // 叶子节点参数
+	Children []*NodeSpec `json:"children,omitempty"`
+}
+
+// TreeFile 一个行为树文件，trees 为行为树定义，ai 把 MonsterInfo.AI 映射到行为树名字
+type TreeFile struct {
+	Trees map[string]*NodeSpec `json:"trees"`
+	AI    map[int]string       `json:"ai"`
+}
+
+// Library 加载并校验过的全部行为树
+type Library struct {
+	trees map[string]*NodeSpec
+	ai    map[int]string
+}
+
+func NewLibrary() *Library {
+	return &Library{
+		trees: make(map[string]*NodeSpec),
+		ai:    make(map[int]string),
+	}
+}
+
+// Add 合并一个文件的内容，行为树名字和 AI 编号不能在多个文件中重复定义
+func (l *Library) Add(file string, data []byte) error {
+	tf := new(TreeFile)
+	if err := json.Unmarshal(data, tf); err != nil {
+		return fmt.Errorf("%s: %s", file, err.Error())
+	}
+	for name, spec := range tf.Trees {
+		if _, ok := l.trees[name]; ok {
+			return fmt.Errorf("%s: 行为树 %s 重复定义", file, name)
+		}
+		l.trees[name] = spec
+	}
+	for id, name := range tf.AI {
+		if _, ok := l.ai[id]; ok {
+			return fmt.Errorf("%s: AI %d 重复定义", file, id)
+		}
+		l.ai[id] = name
+	}
+	return nil
+}
+
+// Validate 检查所有行为树都能创建，AI 映射的行为树都存在
+func (l *Library) Validate() error {
+	names := make([]string, 0, len(l.trees))
+	for name := range l.trees {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := build(l.trees[name], name); err != nil {
+			return err
+		}
+	}
+	for id, name := range l.ai {
+		if _, ok := l.trees[name]; !ok {
+			return fmt.Errorf("AI %d: 行为树 %s 不存在", id, name)
+		}
+	}
+	return nil
+}
+
+// TreeName AI 编号使用的行为树名字，没有时返回空字符串
+func (l *Library) TreeName(ai int) string {
+	if name, ok := l.ai[ai]; ok {
+		return name
+	}
+	if _, ok := l.trees[DefaultTree]; ok {
+		return DefaultTree
+	}
+	return ""
+}
+
+// NewRoot 为一个怪物创建 AI 编号对应的行为树，没有对应的行为树时返回 nil
+func (l *Library) NewRoot(ai int) (INode, error) {
+	name := l.TreeName(ai)
+	if name == "" {
+		return nil, nil
+	}
+	return build(l.trees[name], name)
+}
+
+// build 按节点定义创建节点，where 为出错时提示的节点位置
+func build(spec *NodeSpec, where string) (INode, error) {
+	if spec == nil {
+		return nil, fmt.Errorf("%s: 节点为空", where)
+	}
+	children := make([]INode, 0, len(spec.Children))
+	for i, child := range spec.Children {
+		node, err := build(child, fmt.Sprintf("%s.children[%d]", where, i))
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	needChildren := func(min, max int) error {
+		if len(children) < min || (max >= 0 && len(children) > max) {
+			return fmt.Errorf("%s: %s 节点的子节点数量不正确: %d", where, spec.Type, len(children))
+		}
+		return nil
+	}
+	cond := func() (ConditionFunc, error) {
+		fn, ok := getCondition(spec.Cond)
+		if !ok {
+			return nil, fmt.Errorf("%s: 条件 %q 不存在", where, spec.Cond)
+		}
+		return fn, nil
+	}
+
+	switch spec.Type {
+	case "Priority":
+		if err := needChildren(1, -1); err != nil {
+			return nil, err
+		}
+		period := time.Duration(0)
+		if spec.Period != "" {
+			d, err := time.ParseDuration(spec.Period)
+			if err != nil {
+				return nil, fmt.Errorf("%s: period 不是有效的时间: %s", where, spec.Period)
+			}
+			period = d
+		}
+		return Priority(period, children...), nil
+	case "Sequence":
+		if err := needChildren(1, -1); err != nil {
+			return nil, err
+		}
+		return Sequence(children...), nil
+	case "Parallel":
+		if err := needChildren(1, -1); err != nil {
+			return nil, err
+		}
+		return Parallel(children...), nil
+	case "If", "While":
+		if err := needChildren(1, 1); err != nil {
+			return nil, err
+		}
+		fn, err := cond()
+		if err != nil {
+			return nil, err
+		}
+		if spec.Type == "If" {
+			return If(fn, children[0]), nil
+		}
+		return While(fn, children[0]), nil
+	case "Condition":
+		if err := needChildren(0, 0); err != nil {
+			return nil, err
+		}
+		fn, err := cond()
+		if err != nil {
+			return nil, err
+		}
+		return Condition(fn), nil
+	}
+
+	factory, ok := getAction(spec.Type)
+	if !ok {
+		return nil, fmt.Errorf("%s: 节点类型 %q 不存在", where, spec.Type)
+	}
+	if err := needChildren(0, 0); err != nil {
+		return nil, err
+	}
+	node, err := factory(spec.Args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s %s", where, spec.Type, err.Error())
+	}
+	return node, nil
+}
+
+// LoadLibrary 加载目录下所有 .json 行为树文件并校验
+func LoadLibrary(dir string) (*Library, error) {
+	files := GetFiles(dir, []string{".json"})
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: 没有行为树文件", dir)
+	}
+	sort.Strings(files)
+	l := NewLibrary()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Add(path.Base(file), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+var current atomic.Value // *Library
+
+// Current 当前使用的行为树，没有加载成功时返回 nil
+func Current() *Library {
+	l, _ := current.Load().(*Library)
+	return l
+}
+
+// Reload 重新加载行为树，出错时继续使用原来的行为树
+// 已经存在的怪物在下一次 Process 时换成新的行为树
+func Reload(dir string) error {
+	l, err := LoadLibrary(dir)
+	if err != nil {
+		return err
+	}
+	current.Store(l)
+	return nil
+}
+
+// filesVersion 目录下行为树文件的名字、大小和修改时间，用于判断文件是否修改
+func filesVersion(dir string) string {
+	files := GetFiles(dir, []string{".json"})
+	sort.Strings(files)
+	var sb strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return sb.String()
+}
+
+// Watch 定时检查行为树文件，修改后自动重新加载
+func Watch(dir string, interval time.Duration) {
+	version := filesVersion(dir)
+	for range time.Tick(interval) {
+		v := filesVersion(dir)
+		if v == version {
+			continue
+		}
+		version = v
+		if err := Reload(dir); err != nil {
+			log.Warnln("重新加载怪物行为树错误, 继续使用原来的行为树", err.Error())
+			continue
+		}
+		log.Infof("重新加载了怪物行为树 %s\n", dir)
+	}
+}
@@ -0,0 +1,96 @@
+package behavior
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadTrees(t *testing.T) {
+	l, err := LoadLibrary("trees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.TreeName(2) != "deer" || l.TreeName(6) != "guard" || l.TreeName(1) != DefaultTree || l.TreeName(12) != "broodmother" {
+		t.Errorf("ai 映射错误: %s %s %s", l.TreeName(2), l.TreeName(6), l.TreeName(1))
+	}
+	if root, err := l.NewRoot(2); err != nil || root == nil {
+		t.Errorf("NewRoot(2) = %v, %v", root, err)
+	}
+}
+
+func TestValidateTrees(t *testing.T) {
+	cases := map[string]string{
+		`{"trees": {"a": {"type": "Wandr"}}}`:                                                      `节点类型 "Wandr" 不存在`,
+		`{"trees": {"a": {"type": "If", "cond": "Nope", "children": [{"type": "Wander"}]}}}`:       `条件 "Nope" 不存在`,
+		`{"trees": {"a": {"type": "While", "cond": "HasTarget"}}}`:                                 "子节点数量不正确",
+		`{"trees": {"a": {"type": "Priority", "period": "1x", "children": [{"type": "Wander"}]}}}`: "period",
+		`{"trees": {"a": {"type": "Wander"}}, "ai": {"3": "b"}}`:                                   "行为树 b 不存在",
+		`{"trees": {"a": {"type": "SplitOnDeath", "args": {"count": 2}}}}`:                         "缺少参数 monster",
+		`{"trees": {"a": {"type": "PoisonAttack", "args": {"poison": "Blue"}}}}`:                   "毒的类型 Blue 不存在",
+		`{"trees": {"a": {"type": "RangeAttack", "args": {"range": "far"}}}}`:                      "参数 range 必须是整数",
+		`{"trees": {"a": {"type": "Route"}}}`:                                                      "缺少参数 route 或 offsets",
+		`{"trees": {"a": {"type": "Route", "args": {"route": [[1, -1]]}}}}`:                        "参数 route 的坐标不正确",
+	}
+	for data, want := range cases {
+		l := NewLibrary()
+		if err := l.Add("test.json", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		err := l.Validate()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: 期望错误 %q, 实际 %v", data, want, err)
+		}
+	}
+
+	l := NewLibrary()
+	l.Add("leaves.json", []byte(`{"trees": {"a": {"type": "Priority", "children": [
+		{"type": "HealSelf", "args": {"below": 30, "interval": "3s"}},
+		{"type": "Teleport"},
+		{"type": "SummonMinions", "args": {"monster": "Hen", "max": 4}},
+		{"type": "SplitOnDeath", "args": {"monster": "Hen"}},
+		{"type": "SpellAttack", "args": {"radius": 0}},
+		{"type": "Route", "args": {"offsets": [[0, 0], [-3, 2]]}}
+	]}}}`))
+	if err := l.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	l = NewLibrary()
+	l.Add("a.json", []byte(`{"trees": {"a": {"type": "Wander"}}}`))
+	if err := l.Add("b.json", []byte(`{"trees": {"a": {"type": "Wander"}}}`)); err == nil {
+		t.Error("重复定义的行为树没有报错")
+	}
+}
+
+// TestTreesReachable 发布的行为树中，每个注册的节点和条件都要被某个 AI 编号用到
+func TestTreesReachable(t *testing.T) {
+	l, err := LoadLibrary("trees")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]bool{}
+	var visit func(spec *NodeSpec)
+	visit = func(spec *NodeSpec) {
+		used[spec.Type] = true
+		if spec.Cond != "" {
+			used[spec.Cond] = true
+		}
+		for _, child := range spec.Children {
+			visit(child)
+		}
+	}
+	visit(l.trees[DefaultTree])
+	for _, name := range l.ai {
+		visit(l.trees[name])
+	}
+	for name := range actions {
+		if !used[name] {
+			t.Errorf("节点 %s 没有被任何 AI 编号使用", name)
+		}
+	}
+	for name := range conditions {
+		if !used[name] {
+			t.Errorf("条件 %s 没有被任何 AI 编号使用", name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package behavior
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	. "github.com/yenkeia/mirgo/mir"
+)
+
+var poisonTypes = map[string]common.PoisonType{
+	"Green":     common.PoisonTypeGreen,
+	"Red":       common.PoisonTypeRed,
+	"Slow":      common.PoisonTypeSlow,
+	"Frozen":    common.PoisonTypeFrozen,
+	"Stun":      common.PoisonTypeStun,
+	"Paralysis": common.PoisonTypeParalysis,
+	"Bleeding":  common.PoisonTypeBleeding,
+}
+
+// 近身攻击命中后有 1/chance 的几率使目标中毒
+// value 为每次中毒伤害，不配置时按怪物道术计算
+func PoisonAttack(args Args) (INode, error) {
+	name, err := args.String("poison", "Green")
+	if err != nil {
+		return nil, err
+	}
+	typ, ok := poisonTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("毒的类型 %s 不存在", name)
+	}
+	chance, err := args.Int("chance", 5)
+	if err != nil {
+		return nil, err
+	}
+	value, err := args.Int("value", 0)
+	if err != nil {
+		return nil, err
+	}
+	ticks, err := args.Int("ticks", 5)
+	if err != nil {
+		return nil, err
+	}
+	tick, err := args.Duration("tick", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if chance < 1 || ticks < 1 {
+		return nil, fmt.Errorf("chance 和 ticks 必须大于 0")
+	}
+	n := ChaseAndAttack().(*ChaseAndAttackNode)
+	n.attack = func(c *BT) {
+		m := c.Monster
+		target := m.Target
+		if m.Attack() <= 0 || RandomNext(chance) != 0 {
+			return
+		}
+		v := value
+		if v == 0 {
+			v = m.GetAttackPower(int(m.MinSC), int(m.MaxSC))
+		}
+		if v < 1 {
+			v = 1
+		}
+		m.PoisonTarget(target, typ, v, tick, ticks)
+	}
+	return n, nil
+}
@@ -0,0 +1,12 @@
+package behavior
+
+// 远程攻击（弓箭手、掷斧骷髅），目标在 range 格内时射击，否则追击
+func RangeAttack(args Args) (INode, error) {
+	distance, err := args.Int("range", 7)
+	if err != nil {
+		return nil, err
+	}
+	return chaseAndAttackInRange(distance, func(c *BT) {
+		c.Monster.RangeAttack(false)
+	}), nil
+}
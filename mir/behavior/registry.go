@@ -0,0 +1,161 @@
+package behavior
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+// Args 叶子节点在数据文件中配置的参数
+type Args map[string]interface{}
+
+// Int 整数参数，没有配置时返回 def
+func (a Args) Int(key string, def int) (int, error) {
+	v, ok := a[key]
+	if !ok {
+		return def, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f != float64(int(f)) {
+		return 0, fmt.Errorf("参数 %s 必须是整数", key)
+	}
+	return int(f), nil
+}
+
+// String 字符串参数，没有配置时返回 def
+func (a Args) String(key string, def string) (string, error) {
+	v, ok := a[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("参数 %s 必须是字符串", key)
+	}
+	return s, nil
+}
+
+// Duration 时间参数，格式如 "1s"、"500ms"
+func (a Args) Duration(key string, def time.Duration) (time.Duration, error) {
+	s, err := a.String(key, "")
+	if err != nil || s == "" {
+		return def, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("参数 %s 不是有效的时间: %s", key, s)
+	}
+	return d, nil
+}
+
+// Points 坐标列表参数，格式如 [[100, 200], [110, 205]]
+func (a Args) Points(key string) ([]common.Point, error) {
+	list, err := a.coords(key, false)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]common.Point, 0, len(list))
+	for _, xy := range list {
+		points = append(points, common.NewPoint(xy[0], xy[1]))
+	}
+	return points, nil
+}
+
+// Offsets 相对坐标列表，格式和 Points 相同，可以是负数
+func (a Args) Offsets(key string) ([][2]int, error) {
+	return a.coords(key, true)
+}
+
+func (a Args) coords(key string, negative bool) ([][2]int, error) {
+	v, ok := a[key]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("参数 %s 必须是坐标列表", key)
+	}
+	res := make([][2]int, 0, len(list))
+	for _, item := range list {
+		xy, ok := item.([]interface{})
+		if !ok || len(xy) != 2 {
+			return nil, fmt.Errorf("参数 %s 必须是坐标列表", key)
+		}
+		x, okx := xy[0].(float64)
+		y, oky := xy[1].(float64)
+		if !okx || !oky || (!negative && (x < 0 || y < 0)) {
+			return nil, fmt.Errorf("参数 %s 的坐标不正确", key)
+		}
+		res = append(res, [2]int{int(x), int(y)})
+	}
+	return res, nil
+}
+
+// ActionFactory 根据参数创建叶子节点，每个怪物都会创建一份新的节点
+type ActionFactory func(args Args) (INode, error)
+
+// Leaf 不需要参数的叶子节点
+func Leaf(fn func() INode) ActionFactory {
+	return func(Args) (INode, error) {
+		return fn(), nil
+	}
+}
+
+var (
+	registryLock sync.RWMutex
+	actions      = map[string]ActionFactory{
+		"AttackWall":     Leaf(AttackWall),
+		"ChaseAndAttack": Leaf(ChaseAndAttack),
+		"Wander":         Leaf(Wander),
+		"GuardAttack":    Leaf(GuardAttack),
+		"RangeAttack":    RangeAttack,
+		"SpellAttack":    SpellAttack,
+		"PoisonAttack":   PoisonAttack,
+		"HealSelf":       HealSelf,
+		"SplitOnDeath":   SplitOnDeath,
+		"Teleport":       Teleport,
+		"SummonMinions":  SummonMinions,
+		"Flee":           Flee,
+		"Route":          Route,
+	}
+	conditions = map[string]ConditionFunc{
+		"HasTarget":              HasTarget,
+		"FindMonsterInViewRange": FindMonsterInViewRange,
+	}
+)
+
+// RegisterAction 注册叶子节点，数据文件中用 name 作为节点类型
+func RegisterAction(name string, fn ActionFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := actions[name]; ok {
+		panic("behavior: 重复注册节点 " + name)
+	}
+	actions[name] = fn
+}
+
+// RegisterCondition 注册条件，数据文件中 If/While/Condition 节点用 name 引用
+func RegisterCondition(name string, fn ConditionFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := conditions[name]; ok {
+		panic("behavior: 重复注册条件 " + name)
+	}
+	conditions[name] = fn
+}
+
+func getAction(name string) (ActionFactory, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	fn, ok := actions[name]
+	return fn, ok
+}
+
+func getCondition(name string) (ConditionFunc, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	fn, ok := conditions[name]
+	return fn, ok
+}
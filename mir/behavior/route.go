@@ -0,0 +1,49 @@
+package behavior
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	. "github.com/yenkeia/mirgo/mir"
+)
+
+// 巡逻，按 route 中的坐标依次行走，走到最后一个点后从头开始
+// 也可以用 offsets 指定相对于开始巡逻时所在位置的坐标，用于不同地图的同一类怪物
+type RouteNode struct {
+	Node
+	route   []common.Point
+	offsets [][2]int
+	idx     int
+}
+
+func Route(args Args) (INode, error) {
+	route, err := args.Points("route")
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := args.Offsets("offsets")
+	if err != nil {
+		return nil, err
+	}
+	if len(route) == 0 && len(offsets) == 0 {
+		return nil, fmt.Errorf("缺少参数 route 或 offsets")
+	}
+	return &RouteNode{route: route, offsets: offsets}, nil
+}
+
+func (n *RouteNode) Visit(c *BT) {
+	m := c.Monster
+	n.status = RUNNING
+	if len(n.route) == 0 {
+		cur := m.CurrentLocation
+		for _, off := range n.offsets {
+			x := clamp(int(cur.X)+off[0], 0, m.Map.Width-1)
+			y := clamp(int(cur.Y)+off[1], 0, m.Map.Height-1)
+			n.route = append(n.route, common.NewPoint(x, y))
+		}
+	}
+	if InRange(m.CurrentLocation, n.route[n.idx], 1) {
+		n.idx = (n.idx + 1) % len(n.route)
+	}
+	m.MoveTo(n.route[n.idx])
+}
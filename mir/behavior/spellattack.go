@@ -0,0 +1,20 @@
+package behavior
+
+// 施法攻击，radius 为 0 时只攻击目标，否则攻击目标周围 radius 格内的所有对象
+func SpellAttack(args Args) (INode, error) {
+	distance, err := args.Int("range", 7)
+	if err != nil {
+		return nil, err
+	}
+	radius, err := args.Int("radius", 1)
+	if err != nil {
+		return nil, err
+	}
+	return chaseAndAttackInRange(distance, func(c *BT) {
+		if radius == 0 {
+			c.Monster.RangeAttack(true)
+		} else {
+			c.Monster.AreaAttack(radius)
+		}
+	}), nil
+}
@@ -0,0 +1,33 @@
+package behavior
+
+import "fmt"
+
+// 死亡时分裂成 count 个名字为 monster 的怪物，平时不做任何事
+type SplitOnDeathNode struct {
+	Node
+	monster string
+	count   int
+}
+
+func SplitOnDeath(args Args) (INode, error) {
+	monster, err := args.String("monster", "")
+	if err != nil {
+		return nil, err
+	}
+	if monster == "" {
+		return nil, fmt.Errorf("缺少参数 monster")
+	}
+	count, err := args.Int("count", 2)
+	if err != nil {
+		return nil, err
+	}
+	return &SplitOnDeathNode{monster: monster, count: count}, nil
+}
+
+func (n *SplitOnDeathNode) Visit(c *BT) {
+	n.status = FAILED
+}
+
+func (n *SplitOnDeathNode) OnDeath(c *BT) {
+	c.Monster.SpawnNear(n.monster, n.count, 1)
+}
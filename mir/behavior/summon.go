@@ -0,0 +1,62 @@
+package behavior
+
+import (
+	"fmt"
+	"time"
+)
+
+// 有目标时每隔 interval 召唤 count 个名字为 monster 的怪物，召唤出来还活着的最多 max 个
+type SummonMinionsNode struct {
+	Node
+	monster  string
+	count    int
+	max      int
+	interval time.Duration
+}
+
+func SummonMinions(args Args) (INode, error) {
+	n := &SummonMinionsNode{}
+	var err error
+	if n.monster, err = args.String("monster", ""); err != nil {
+		return nil, err
+	}
+	if n.monster == "" {
+		return nil, fmt.Errorf("缺少参数 monster")
+	}
+	if n.count, err = args.Int("count", 2); err != nil {
+		return nil, err
+	}
+	if n.max, err = args.Int("max", 6); err != nil {
+		return nil, err
+	}
+	if n.interval, err = args.Duration("interval", 15*time.Second); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *SummonMinionsNode) Visit(c *BT) {
+	m := c.Monster
+	now := time.Now()
+	n.status = FAILED
+	if m.Target == nil || now.Before(m.SummonTime) {
+		return
+	}
+	alive := m.Minions[:0]
+	for _, minion := range m.Minions {
+		if !minion.IsDead() {
+			alive = append(alive, minion)
+		}
+	}
+	m.Minions = alive
+	count := n.count
+	if len(m.Minions)+count > n.max {
+		count = n.max - len(m.Minions)
+	}
+	if count <= 0 {
+		return
+	}
+	m.Minions = append(m.Minions, m.SpawnNear(n.monster, count, 3)...)
+	m.SummonTime = now.Add(n.interval)
+	n.status = SUCCESS
+}
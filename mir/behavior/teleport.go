@@ -0,0 +1,46 @@
+package behavior
+
+import (
+	"time"
+
+	. "github.com/yenkeia/mirgo/mir"
+)
+
+// 目标离开 distance 格后瞬移到目标身边，两次瞬移至少间隔 interval
+type TeleportNode struct {
+	Node
+	distance int
+	interval time.Duration
+}
+
+func Teleport(args Args) (INode, error) {
+	n := &TeleportNode{}
+	var err error
+	if n.distance, err = args.Int("distance", 5); err != nil {
+		return nil, err
+	}
+	if n.interval, err = args.Duration("interval", 10*time.Second); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *TeleportNode) Visit(c *BT) {
+	m := c.Monster
+	now := time.Now()
+	n.status = FAILED
+	if m.Target == nil || now.Before(m.TeleportTime) || !m.CanMove() {
+		return
+	}
+	target := m.Target.GetPoint()
+	if InRange(m.CurrentLocation, target, n.distance) {
+		return
+	}
+	pt, err := m.Map.GetValidPoint(int(target.X), int(target.Y), 2)
+	if err != nil {
+		return
+	}
+	m.TeleportTo(pt)
+	m.TeleportTime = now.Add(n.interval)
+	n.status = SUCCESS
+}
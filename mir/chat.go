@@ -0,0 +1,145 @@
+package mir
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+const (
+	ShoutLevel        = 8                // 地图喊话需要的等级
+	ShoutDelay        = 10 * time.Second // 地图喊话间隔
+	GlobalShoutLevel  = 20               // 全服喊话需要的等级
+	GlobalShoutDelay  = 60 * time.Second // 全服喊话间隔
+	ChatMessageMaxLen = 200              // 聊天内容最大长度
+)
+
+// Whisper 私聊，message 格式为 "/玩家名 内容"
+func (p *Player) Whisper(message string) {
+	parts := strings.SplitN(message[1:], " ", 2)
+	name := parts[0]
+	if name == "" {
+		return
+	}
+	text := ""
+	if len(parts) == 2 {
+		text = parts[1]
+	}
+	o := p.Map.Env.GetPlayerByName(name)
+	if o == nil {
+		c := new(common.Character)
+		p.Map.Env.Game.DB.Table("character").Where("name = ?", name).Find(c)
+		if c.ID == 0 {
+			p.ReceiveChat(fmt.Sprintf("找不到玩家(%s)", name), common.ChatTypeSystem)
+		} else {
+			p.ReceiveChat(fmt.Sprintf("%s 不在线", name), common.ChatTypeSystem)
+		}
+		return
+	}
+	if o == p {
+		return
+	}
+	if o.IsBlocked(p) {
+		p.ReceiveChat(fmt.Sprintf("%s 拒绝接收你的消息", o.Name), common.ChatTypeSystem)
+		return
+	}
+	p.ReceiveChat(fmt.Sprintf("%s=> %s", o.Name, text), common.ChatTypeWhisperOut)
+	o.ReceiveChat(fmt.Sprintf("%s=> %s", p.Name, text), common.ChatTypeWhisperIn)
+}
+
+// GroupChat 组队聊天
+func (p *Player) GroupChat(message string) {
+	if len(p.GroupMembers) == 0 {
+		p.ReceiveChat("你还没有加入组队", common.ChatTypeSystem)
+		return
+	}
+	text := fmt.Sprintf("%s:%s", p.Name, message)
+	for _, o := range p.GroupMembers {
+		o.ReceiveChat(text, common.ChatTypeGroup)
+	}
+}
+
+// Shout 地图喊话
+func (p *Player) Shout(message string) {
+	now := time.Now()
+	if p.Level < ShoutLevel {
+		p.ReceiveChat(fmt.Sprintf("等级达到 %d 级才能喊话", ShoutLevel), common.ChatTypeSystem)
+		return
+	}
+	if now.Before(p.ShoutTime) {
+		p.ReceiveChat(fmt.Sprintf("%d 秒后才能再次喊话", int(p.ShoutTime.Sub(now).Seconds())+1), common.ChatTypeSystem)
+		return
+	}
+	p.ShoutTime = now.Add(ShoutDelay)
+	text := fmt.Sprintf("(!)%s:%s", p.Name, message)
+	for _, o := range p.Map.GetAllPlayers() {
+		if !o.IsBlocked(p) {
+			o.ReceiveChat(text, common.ChatTypeShout)
+		}
+	}
+}
+
+// GlobalShout 全服喊话
+func (p *Player) GlobalShout(message string) {
+	now := time.Now()
+	if p.Level < GlobalShoutLevel {
+		p.ReceiveChat(fmt.Sprintf("等级达到 %d 级才能全服喊话", GlobalShoutLevel), common.ChatTypeSystem)
+		return
+	}
+	if now.Before(p.GlobalShoutTime) {
+		p.ReceiveChat(fmt.Sprintf("%d 秒后才能再次全服喊话", int(p.GlobalShoutTime.Sub(now).Seconds())+1), common.ChatTypeSystem)
+		return
+	}
+	p.GlobalShoutTime = now.Add(GlobalShoutDelay)
+	text := fmt.Sprintf("(*)%s:%s", p.Name, message)
+	for _, o := range p.Map.Env.GetOnlinePlayers() {
+		if !o.IsBlocked(p) {
+			o.ReceiveChat(text, common.ChatTypeShout2)
+		}
+	}
+}
+
+// RequestUserName 客户端根据 ID 查询玩家名字
+func (p *Player) RequestUserName(id uint32) {
+	o := p.Map.Env.GetPlayer(id)
+	if o == nil {
+		return
+	}
+	p.Enqueue(&server.UserName{ID: o.ID, Name: o.Name})
+}
+
+// RequestChatItem 查询聊天中链接的物品，先找在线玩家身上的物品，再查数据库
+func (p *Player) RequestChatItem(id uint64) {
+	env := p.Map.Env
+	var item *common.UserItem
+	for _, o := range env.GetOnlinePlayers() {
+		if item = o.findUserItem(id); item != nil {
+			break
+		}
+	}
+	if item == nil {
+		ui := new(common.UserItem)
+		env.Game.DB.Table("user_item").Where("id = ?", id).Find(ui)
+		if ui.ID == 0 {
+			return
+		}
+		item = ui
+	}
+	p.EnqueueItemInfo(int32(item.ItemID))
+	p.Enqueue(&server.ChatItemStats{ChatItemID: id, Stats: *item})
+}
+
+// findUserItem 在背包和装备中查找物品
+func (p *Player) findUserItem(id uint64) *common.UserItem {
+	for _, arr := range [][]common.UserItem{p.Inventory, p.Equipment} {
+		for i := range arr {
+			if arr[i].ID == id {
+				return &arr[i]
+			}
+		}
+	}
+	return nil
+}
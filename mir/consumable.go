@@ -0,0 +1,205 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+const (
+	MaxWeaponLuck = 7   // 祝福油能加到的最高幸运
+	MinWeaponLuck = -10 // 被诅咒后的最低幸运
+)
+
+// BindLocation 回城点，新角色出生的安全区
+func (p *Player) BindLocation() (*Map, common.Point) {
+	env := p.Map.Env
+	for _, sz := range env.GameDB.SafeZoneInfos {
+		if sz.StartPoint == 0 {
+			continue
+		}
+		if m := env.GetMap(sz.MapID); m != nil {
+			return m, common.NewPoint(sz.LocationX, sz.LocationY)
+		}
+	}
+	return env.GetMap(1), common.NewPoint(284, 608)
+}
+
+// TeleportRandom 在地图上随机传送，尝试 attempts 次
+func (p *Player) TeleportRandom(m *Map, attempts int) bool {
+	for i := 0; i < attempts; i++ {
+		pt := common.NewPoint(RandomNext(m.Width), RandomNext(m.Height))
+		if p.Teleport(m, pt) {
+			return true
+		}
+	}
+	return false
+}
+
+// TeleportEscape 传送到回城点附近
+func (p *Player) TeleportEscape(attempts int) bool {
+	m, bind := p.BindLocation()
+	if m == nil {
+		return false
+	}
+	for i := 0; i < attempts; i++ {
+		pt := common.NewPoint(AbsInt(int(bind.X)+RandomInt(-100, 100)), AbsInt(int(bind.Y)+RandomInt(-100, 100)))
+		if p.Teleport(m, pt) {
+			return true
+		}
+	}
+	return false
+}
+
+// useScroll 使用卷轴和油，成功返回 true
+func (p *Player) useScroll(info *common.ItemInfo) bool {
+	mi := p.Map.Info
+	switch info.Shape {
+	case 0: // 地牢逃脱卷
+		if mi.NoEscape != 0 {
+			p.ReceiveChat("此地图不能使用地牢逃脱卷", common.ChatTypeSystem)
+			return false
+		}
+		return p.TeleportEscape(20)
+	case 1: // 回城卷
+		if mi.NoTownTeleport != 0 || mi.NoTeleport != 0 {
+			p.ReceiveChat("此地图不能使用回城卷", common.ChatTypeSystem)
+			return false
+		}
+		m, bind := p.BindLocation()
+		if m == nil {
+			return false
+		}
+		pt, err := m.GetValidPoint(int(bind.X), int(bind.Y), 10)
+		return err == nil && p.Teleport(m, pt)
+	case 2: // 随机传送卷
+		if mi.NoTeleport != 0 || mi.NoRandom != 0 {
+			p.ReceiveChat("此地图不能随机传送", common.ChatTypeSystem)
+			return false
+		}
+		return p.TeleportRandom(p.Map, 200)
+	case 3: // 祝福油
+		return p.TryLuckWeapon()
+	case 4: // 修复油，修复部分持久，同时减少最大持久
+		return p.repairWeapon(false)
+	case 5: // 战神油，完全修复
+		return p.repairWeapon(true)
+	}
+	return false
+}
+
+// repairWeapon 使用修复油修复武器，full 为 true 时修复到最大持久
+func (p *Player) repairWeapon(full bool) bool {
+	weapon := &p.Equipment[common.EquipmentSlotWeapon]
+	if weapon.ID == 0 || weapon.CurrentDura == weapon.MaxDura {
+		return false
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(weapon.ItemID))
+	if info == nil || common.BindMode(info.Bind)&common.BindModeDontRepair != 0 {
+		p.ReceiveChat("该武器不能修复", common.ChatTypeSystem)
+		return false
+	}
+	if full {
+		weapon.CurrentDura = weapon.MaxDura
+		p.ReceiveChat("武器已完全修复", common.ChatTypeHint)
+	} else {
+		lost := int(weapon.MaxDura - weapon.CurrentDura)
+		if lost > 5000 {
+			lost = 5000
+		}
+		weapon.MaxDura -= uint16(lost / 30)
+		dura := int(weapon.CurrentDura) + 5000
+		if dura > int(weapon.MaxDura) {
+			dura = int(weapon.MaxDura)
+		}
+		weapon.CurrentDura = uint16(dura)
+		p.ReceiveChat("武器已部分修复", common.ChatTypeHint)
+	}
+	p.Enqueue(&server.ItemRepaired{UniqueID: weapon.ID, MaxDura: weapon.MaxDura, CurrentDura: weapon.CurrentDura})
+	return true
+}
+
+// TryLuckWeapon 祝福油，武器幸运越高成功率越低，有一定几率诅咒
+func (p *Player) TryLuckWeapon() bool {
+	weapon := &p.Equipment[common.EquipmentSlotWeapon]
+	if weapon.ID == 0 || weapon.Luck >= MaxWeaponLuck {
+		return false
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(weapon.ItemID))
+	if info == nil || common.BindMode(info.Bind)&common.BindModeDontUpgrade != 0 {
+		return false
+	}
+	switch {
+	case weapon.Luck > MinWeaponLuck && RandomNext(20) == 0:
+		weapon.Luck--
+		p.ReceiveChat("武器被诅咒了", common.ChatTypeSystem)
+	case weapon.Luck <= 0 || RandomNext(10*int(weapon.Luck)) == 0:
+		weapon.Luck++
+		p.ReceiveChat("武器幸运增加了", common.ChatTypeHint)
+	default:
+		p.ReceiveChat("没有效果", common.ChatTypeHint)
+		return true
+	}
+	p.Enqueue(&server.RefreshItem{Item: *weapon})
+	p.RefreshStats()
+	return true
+}
+
+// useBook 使用技能书学习技能，保存到 user_magic
+func (p *Player) useBook(info *common.ItemInfo) bool {
+	spell := common.Spell(info.Shape)
+	magicInfo := p.Map.Env.GameDB.GetMagicInfoBySpell(spell)
+	if magicInfo == nil || p.GetMagic(spell) != nil {
+		return false
+	}
+	um := common.UserMagic{
+		CharacterID: int(p.ID),
+		MagicID:     magicInfo.ID,
+		Spell:       spell,
+		Info:        magicInfo,
+	}
+	p.Map.Env.Game.DB.Table("user_magic").Create(&um)
+	p.Magics = append(p.Magics, um)
+	p.Enqueue(&server.NewMagic{Magic: um.GetClientMagic(magicInfo)})
+	p.RefreshStats()
+	return true
+}
+
+// useBuffPotion 增益药水，持续时间为 Durability 分钟
+func (p *Player) useBuffPotion(item *common.UserItem, info *common.ItemInfo) bool {
+	expire := time.Now().Add(time.Duration(info.Durability) * time.Minute)
+	buffs := []struct {
+		typ   common.BuffType
+		value int
+	}{
+		{common.BuffTypeImpact, int(info.MaxDC) + int(item.DC)},
+		{common.BuffTypeMagic, int(info.MaxMC) + int(item.MC)},
+		{common.BuffTypeTaoist, int(info.MaxSC) + int(item.SC)},
+		{common.BuffTypeStorm, int(info.AttackSpeed) + int(item.AttackSpeed)},
+		{common.BuffTypeHealthAid, int(info.HP) + int(item.HP)},
+		{common.BuffTypeManaAid, int(info.MP) + int(item.MP)},
+		{common.BuffTypeDefence, int(info.MaxAC) + int(item.AC)},
+		{common.BuffTypeMagicDefence, int(info.MaxMAC) + int(item.MAC)},
+		{common.BuffTypeBagWeight, int(info.BagWeight)},
+	}
+	used := false
+	for _, b := range buffs {
+		if b.value > 0 {
+			p.AddBuff(NewBuff(p.NewObjectID(), b.typ, b.value, expire))
+			used = true
+		}
+	}
+	return used
+}
+
+// useExpPotion 经验药水，经验加成百分比为 Luck，持续时间为 Durability 分钟
+func (p *Player) useExpPotion(item *common.UserItem, info *common.ItemInfo) bool {
+	value := int(info.Luck) + int(item.Luck)
+	if value <= 0 {
+		return false
+	}
+	expire := time.Now().Add(time.Duration(info.Durability) * time.Minute)
+	p.AddBuff(NewBuff(p.NewObjectID(), common.BuffTypeExp, value, expire))
+	return true
+}
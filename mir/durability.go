@@ -0,0 +1,77 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// breaksOnZeroDura 持久为 0 时直接损坏消失的物品类型，其他装备持久为 0 时只是不再提供属性
+func breaksOnZeroDura(typ common.ItemType) bool {
+	return typ == common.ItemTypeTorch
+}
+
+// DamageWeapon 攻击时武器减少持久
+func (p *Player) DamageWeapon() {
+	if p.NoDuraLoss {
+		return
+	}
+	p.damageItem(int(common.EquipmentSlotWeapon), RandomInt(1, 4))
+}
+
+// DamageDura 被攻击时武器以外的装备减少持久
+func (p *Player) DamageDura() {
+	if p.NoDuraLoss {
+		return
+	}
+	for i := range p.Equipment {
+		if i == int(common.EquipmentSlotWeapon) {
+			continue
+		}
+		p.damageItem(i, 1)
+	}
+}
+
+// damageItem 装备栏 slot 的物品减少 amount 点持久，Strong 可以减少损耗
+// 客户端显示的持久变化或持久为 0 时才通知客户端，持久为 0 时重新计算属性
+func (p *Player) damageItem(slot int, amount int) {
+	item := &p.Equipment[slot]
+	if item.ID == 0 || item.CurrentDura == 0 {
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil || info.Durability == 0 || info.Type == common.ItemTypeAmulet {
+		return
+	}
+	if strong := int(info.Strong) + int(item.Strong); strong > 0 {
+		amount -= strong
+		if amount < 1 {
+			amount = 1
+		}
+	}
+	old := item.CurrentDura
+	if int(item.CurrentDura) > amount {
+		item.CurrentDura -= uint16(amount)
+	} else {
+		item.CurrentDura = 0
+	}
+	if item.CurrentDura > 0 {
+		if old/1000 != item.CurrentDura/1000 {
+			p.Enqueue(&server.DuraChanged{UniqueID: item.ID, CurrentDura: item.CurrentDura})
+		}
+		return
+	}
+
+	looks := p.getLooks()
+	if breaksOnZeroDura(info.Type) {
+		p.Enqueue(&server.DeleteItem{UniqueID: item.ID, Count: item.Count})
+		*item = common.UserItem{}
+		p.ReceiveChat(fmt.Sprintf("%s 已损坏", info.Name), common.ChatTypeSystem)
+	} else {
+		p.Enqueue(&server.DuraChanged{UniqueID: item.ID, CurrentDura: 0})
+		p.ReceiveChat(fmt.Sprintf("%s 持久为 0，需要修理", info.Name), common.ChatTypeSystem)
+	}
+	p.RefreshStats()
+	p.broadcastLooks(looks)
+}
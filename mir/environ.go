@@ -1,11 +1,14 @@
 package mir
 
 import (
+	"math/rand"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/davyxu/cellnet"
 	_ "github.com/yenkeia/mirgo/codec/mircodec"
@@ -23,6 +26,9 @@ type Environ struct {
 	Maps               *sync.Map // map[int]*Map	// mapID: Map
 	ObjectID           uint32
 	Players            []*Player
+	Ranking            *Ranking
+	Rand               *rand.Rand // 物品附加属性等随机用，不是并发安全的，使用时加 randLock
+	randLock           sync.Mutex
 	lock               *sync.Mutex
 }
 
@@ -30,13 +36,28 @@ type Environ struct {
 func NewEnviron(g *Game) (env *Environ) {
 	env = new(Environ)
 	env.Game = g
+	env.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	env.InitMigrations()
 	env.InitGameDB()
 	env.InitMonsterDrop()
+	env.InitRecipes()
+	env.InitExpList()
+	if err := env.InitBehaviors(); err != nil {
+		panic("加载怪物行为树错误: " + err.Error())
+	}
 	env.InitMaps()
 	env.ObjectID = 100000
+	// 物品 ID 也用 ObjectID 生成，不能和数据库中已有的物品重复
+	var res struct{ MaxID uint32 }
+	g.DB.Table("user_item").Select("max(id) as max_id").Scan(&res)
+	if res.MaxID > env.ObjectID {
+		env.ObjectID = res.MaxID
+	}
 	env.Players = make([]*Player, 0)
 	env.lock = new(sync.Mutex)
 	env.SessionIDPlayerMap = new(sync.Map)
+	env.Ranking = new(Ranking)
+	go env.rankingLoop()
 	PrintEnviron(env)
 	return
 }
@@ -55,6 +76,14 @@ func PrintEnviron(env *Environ) {
 	log.Debugf("共加载了 %d 张地图，%d 怪物，%d NPC\n", mapCount, monsterCount, npcCount)
 }
 
+// InitBehaviors 加载怪物行为，必须在 InitMaps 刷怪之前
+func (e *Environ) InitBehaviors() error {
+	if behaviorLoader == nil {
+		return nil
+	}
+	return behaviorLoader()
+}
+
 // InitGameDB ...
 func (e *Environ) InitGameDB() {
 	gdb := new(GameDB)
@@ -118,6 +147,45 @@ func (e *Environ) InitMonsterDrop() {
 	}
 }
 
+// InitRecipes 加载 Recipe 目录下的合成配方，文件名即合成出的物品名
+func (e *Environ) InitRecipes() {
+	gdb := e.GameDB
+	gdb.RecipeInfoMap = new(sync.Map)
+	for _, file := range GetFiles(setting.Conf.RecipeDirPath, []string{".txt"}) {
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+		if gdb.GetItemInfoByName(name) == nil {
+			log.Warnln("加载合成配方错误, 物品不存在", name)
+			continue
+		}
+		ri, err := common.GetRecipeInfoByItemName(setting.Conf.RecipeDirPath, name)
+		if err != nil {
+			log.Warnln("加载合成配方错误", name, err.Error())
+			continue
+		}
+		valid := true
+		for _, ing := range append(ri.Tools, ri.Ingredients...) {
+			if gdb.GetItemInfoByName(ing.ItemName) == nil {
+				log.Warnln("加载合成配方错误, 材料不存在", name, ing.ItemName)
+				valid = false
+				break
+			}
+		}
+		if valid {
+			gdb.RecipeInfoMap.Store(name, ri)
+		}
+	}
+}
+
+// InitExpList 加载升级经验表，文件不存在时使用默认经验表
+func (e *Environ) InitExpList() {
+	list, err := common.GetExpList(setting.Conf.ExpListPath)
+	if err != nil {
+		log.Warnln("加载升级经验表错误, 使用默认经验表", err.Error())
+		list = setting.DefaultExpList
+	}
+	e.GameDB.ExpList = list
+}
+
 func (e *Environ) CreateDropItem(m *Map, userItem *common.UserItem, gold uint64) *Item {
 	return &Item{
 		MapObject: MapObject{
@@ -131,38 +199,34 @@ func (e *Environ) CreateDropItem(m *Map, userItem *common.UserItem, gold uint64)
 
 func (e *Environ) NewUserItem(i *common.ItemInfo) *common.UserItem {
 	res := &common.UserItem{
-		ID:             uint64(e.NewObjectID()),
-		ItemID:         i.ID,
-		CurrentDura:    100,
-		MaxDura:        100,
-		Count:          1,
-		AC:             i.MinAC,
-		MAC:            i.MinMAC,
-		DC:             i.MinDC,
-		MC:             i.MinMC,
-		SC:             i.MinSC,
-		Accuracy:       i.Accuracy,
-		Agility:        i.Agility,
-		HP:             0,
-		MP:             0,
-		AttackSpeed:    i.AttackSpeed,
-		Luck:           i.Luck,
-		SoulBoundId:    0,
-		Bools:          0,
-		Strong:         0,
-		MagicResist:    0,
-		PoisonResist:   0,
-		HealthRecovery: 0,
-		ManaRecovery:   0,
-		PoisonRecovery: 0,
-		CriticalRate:   0,
-		CriticalDamage: 0,
-		Freezing:       0,
-		PoisonAttack:   0,
+		ID:          uint64(e.NewObjectID()),
+		ItemID:      i.ID,
+		CurrentDura: i.Durability,
+		MaxDura:     i.Durability,
+		Count:       1,
 	}
 	return res
 }
 
+// NewRandomUserItem 生成带随机附加属性的物品，用于合成和 NPC 商品
+func (e *Environ) NewRandomUserItem(i *common.ItemInfo) *common.UserItem {
+	res := e.NewUserItem(i)
+	e.randLock.Lock()
+	res.RandomStats(e.Rand, setting.GetRandomItemStat(i.RandomStatsId))
+	e.randLock.Unlock()
+	return res
+}
+
+// NewDropUserItem 生成怪物掉落的物品，持久和附加属性都是随机的
+func (e *Environ) NewDropUserItem(i *common.ItemInfo) *common.UserItem {
+	res := e.NewUserItem(i)
+	e.randLock.Lock()
+	res.RandomDura(e.Rand, i)
+	res.RandomStats(e.Rand, setting.GetRandomItemStat(i.RandomStatsId))
+	e.randLock.Unlock()
+	return res
+}
+
 // InitMaps ...
 func (e *Environ) InitMaps() {
 	mapDirPath := setting.Conf.MapDirPath
@@ -213,29 +277,30 @@ func (e *Environ) AddPlayer(p *Player) {
 	e.Players = append(e.Players, p)
 	e.lock.Unlock()
 	p.Map.AddObject(p)
+	p.NotifyFriendsStatus(true)
 }
 
 func (e *Environ) GetPlayer(ID uint32) *Player {
 	e.lock.Lock()
+	defer e.lock.Unlock()
 	for i := 0; i < len(e.Players); i++ {
 		o := e.Players[i]
 		if ID == o.ID {
 			return o
 		}
 	}
-	e.lock.Unlock()
 	return nil
 }
 
 func (e *Environ) GetPlayerByName(name string) *Player {
 	e.lock.Lock()
+	defer e.lock.Unlock()
 	for i := 0; i < len(e.Players); i++ {
 		o := e.Players[i]
 		if name == o.Name {
 			return o
 		}
 	}
-	e.lock.Unlock()
 	return nil
 }
 
@@ -254,6 +319,21 @@ func (e *Environ) DeletePlayer(p *Player) {
 	}
 	e.lock.Unlock()
 	p.Map.DeleteObject(p)
+	p.NotifyFriendsStatus(false)
+	p.LeaveGroup()
+}
+
+// GetOnlinePlayers 返回在线玩家列表的副本
+func (e *Environ) GetOnlinePlayers() []*Player {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	res := make([]*Player, 0, len(e.Players))
+	for _, o := range e.Players {
+		if o != nil {
+			res = append(res, o)
+		}
+	}
+	return res
 }
 
 func (e *Environ) GetPlayersCount() int {
@@ -0,0 +1,131 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+// IsCorrectSlot 物品类型是否可以放在装备栏的该格子
+func IsCorrectSlot(typ common.ItemType, slot int32) bool {
+	switch common.EquipmentSlot(slot) {
+	case common.EquipmentSlotWeapon:
+		return typ == common.ItemTypeWeapon
+	case common.EquipmentSlotArmour:
+		return typ == common.ItemTypeArmour
+	case common.EquipmentSlotHelmet:
+		return typ == common.ItemTypeHelmet
+	case common.EquipmentSlotTorch:
+		return typ == common.ItemTypeTorch
+	case common.EquipmentSlotNecklace:
+		return typ == common.ItemTypeNecklace
+	case common.EquipmentSlotBraceletL, common.EquipmentSlotBraceletR:
+		return typ == common.ItemTypeBracelet
+	case common.EquipmentSlotRingL, common.EquipmentSlotRingR:
+		return typ == common.ItemTypeRing
+	case common.EquipmentSlotAmulet:
+		return typ == common.ItemTypeAmulet
+	case common.EquipmentSlotBelt:
+		return typ == common.ItemTypeBelt
+	case common.EquipmentSlotBoots:
+		return typ == common.ItemTypeBoots
+	case common.EquipmentSlotStone:
+		return typ == common.ItemTypeStone
+	case common.EquipmentSlotMount:
+		return typ == common.ItemTypeMount
+	}
+	return false
+}
+
+// CanEquipItem 检查性别、职业、属性要求和负重，不满足时提示玩家
+func (p *Player) CanEquipItem(info *common.ItemInfo, slot int32) bool {
+	if !p.checkRequirements(info, "装备") {
+		return false
+	}
+
+	// 替换下来的装备不再计算负重
+	old := 0
+	if o := p.Map.Env.GameDB.GetItemInfoByID(int(p.Equipment[slot].ItemID)); o != nil && p.Equipment[slot].ID != 0 {
+		old = int(o.Weight)
+	}
+	switch info.Type {
+	case common.ItemTypeWeapon, common.ItemTypeTorch:
+		if p.CurrentHandWeight-old+int(info.Weight) > int(p.MaxHandWeight) {
+			p.ReceiveChat("腕力不足，无法装备", common.ChatTypeSystem)
+			return false
+		}
+	default:
+		if p.CurrentWearWeight-old+int(info.Weight) > int(p.MaxWearWeight) {
+			p.ReceiveChat("负重不足，无法装备", common.ChatTypeSystem)
+			return false
+		}
+	}
+	return true
+}
+
+// checkRequirements 检查物品的性别、职业、等级和属性要求，action 为提示中的动作，如 "装备"、"使用"
+func (p *Player) checkRequirements(info *common.ItemInfo, action string) bool {
+	if info.RequiredGender&(1<<p.Gender) == 0 {
+		p.ReceiveChat("性别不符，无法"+action, common.ChatTypeSystem)
+		return false
+	}
+	if info.RequiredClass&(1<<p.Class) == 0 {
+		p.ReceiveChat("职业不符，无法"+action, common.ChatTypeSystem)
+		return false
+	}
+
+	amount := int(info.RequiredAmount)
+	var current int
+	var name string
+	switch info.RequiredType {
+	case common.RequiredTypeLevel:
+		current, name = int(p.Level), "等级"
+	case common.RequiredTypeMaxLevel:
+		if int(p.Level) > amount {
+			p.ReceiveChat(fmt.Sprintf("等级超过 %d 级，无法%s", amount, action), common.ChatTypeSystem)
+			return false
+		}
+	case common.RequiredTypeMaxAC:
+		current, name = int(p.MaxAC), "防御"
+	case common.RequiredTypeMaxMAC:
+		current, name = int(p.MaxMAC), "魔御"
+	case common.RequiredTypeMaxDC:
+		current, name = int(p.MaxDC), "攻击"
+	case common.RequiredTypeMaxMC:
+		current, name = int(p.MaxMC), "魔法"
+	case common.RequiredTypeMaxSC:
+		current, name = int(p.MaxSC), "道术"
+	case common.RequiredTypeMinAC:
+		current, name = int(p.MinAC), "最小防御"
+	case common.RequiredTypeMinMAC:
+		current, name = int(p.MinMAC), "最小魔御"
+	case common.RequiredTypeMinDC:
+		current, name = int(p.MinDC), "最小攻击"
+	case common.RequiredTypeMinMC:
+		current, name = int(p.MinMC), "最小魔法"
+	case common.RequiredTypeMinSC:
+		current, name = int(p.MinSC), "最小道术"
+	}
+	if name != "" && current < amount {
+		p.ReceiveChat(fmt.Sprintf("%s需要达到 %d 才能%s", name, amount, action), common.ChatTypeSystem)
+		return false
+	}
+	return true
+}
+
+// looks 外观，装备变化后比较是否需要广播 PlayerUpdate
+type looks struct {
+	armour, wings, weapon, weaponEffect int
+	light                               uint8
+}
+
+func (p *Player) getLooks() looks {
+	return looks{p.LooksArmour, p.LooksWings, p.LooksWeapon, p.LooksWeaponEffect, p.Light}
+}
+
+// broadcastLooks 外观变化时通知周围玩家
+func (p *Player) broadcastLooks(old looks) {
+	if p.getLooks() != old {
+		p.Broadcast(ServerMessage{}.PlayerUpdate(p))
+	}
+}
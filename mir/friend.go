@@ -0,0 +1,158 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// MaxMemoLength 好友备注最大长度，按字符计算
+const MaxMemoLength = 200
+
+// GetFriend 获取好友或黑名单记录
+func (p *Player) GetFriend(characterID int) *common.Friend {
+	for i := range p.Friends {
+		if p.Friends[i].FriendID == characterID {
+			return &p.Friends[i]
+		}
+	}
+	return nil
+}
+
+// IsBlocked other 是否在玩家的黑名单中
+func (p *Player) IsBlocked(other *Player) bool {
+	f := p.GetFriend(int(other.ID))
+	return f != nil && f.Blocked
+}
+
+// AddFriend 添加好友，blocked 为 true 时加入黑名单
+func (p *Player) AddFriend(name string, blocked bool) {
+	if name == p.Name {
+		p.ReceiveChat("不能添加自己", common.ChatTypeSystem)
+		return
+	}
+	db := p.Map.Env.Game.DB
+	c := new(common.Character)
+	db.Table("character").Where("name = ?", name).Find(c)
+	if c.ID == 0 {
+		p.ReceiveChat(fmt.Sprintf("找不到玩家(%s)", name), common.ChatTypeSystem)
+		return
+	}
+	if f := p.GetFriend(int(c.ID)); f != nil {
+		if f.Blocked == blocked {
+			p.ReceiveChat(fmt.Sprintf("%s 已经在列表中", name), common.ChatTypeSystem)
+			return
+		}
+		f.Blocked = blocked
+		db.Table("friend").Where("id = ?", f.ID).Update("blocked", blocked)
+	} else {
+		f := common.Friend{CharacterID: int(p.ID), FriendID: int(c.ID), Blocked: blocked}
+		db.Table("friend").Create(&f)
+		p.Friends = append(p.Friends, f)
+	}
+	p.RefreshFriends()
+}
+
+// RemoveFriend 删除好友或移出黑名单
+func (p *Player) RemoveFriend(characterID int) {
+	for i := range p.Friends {
+		if p.Friends[i].FriendID != characterID {
+			continue
+		}
+		p.Map.Env.Game.DB.Table("friend").Where("id = ?", p.Friends[i].ID).Delete(common.Friend{})
+		p.Friends = append(p.Friends[:i], p.Friends[i+1:]...)
+		break
+	}
+	p.RefreshFriends()
+}
+
+// AddMemo 修改好友备注
+func (p *Player) AddMemo(characterID int, memo string) {
+	f := p.GetFriend(characterID)
+	if f == nil {
+		return
+	}
+	if r := []rune(memo); len(r) > MaxMemoLength {
+		memo = string(r[:MaxMemoLength])
+	}
+	f.Memo = memo
+	p.Map.Env.Game.DB.Table("friend").Where("id = ?", f.ID).Update("memo", memo)
+	p.RefreshFriends()
+}
+
+// RefreshFriends 发送好友列表和在线状态
+func (p *Player) RefreshFriends() {
+	env := p.Map.Env
+	ids := make([]int, 0, len(p.Friends))
+	for i := range p.Friends {
+		ids = append(ids, p.Friends[i].FriendID)
+	}
+	chars := make([]common.Character, 0, len(ids))
+	if len(ids) != 0 {
+		env.Game.DB.Table("character").Where("id in (?)", ids).Find(&chars)
+	}
+	names := make(map[int]string)
+	for _, c := range chars {
+		names[int(c.ID)] = c.Name
+	}
+	friends := make([]common.ClientFriend, 0, len(p.Friends))
+	for _, f := range p.Friends {
+		name, ok := names[f.FriendID]
+		if !ok {
+			continue
+		}
+		friends = append(friends, common.ClientFriend{
+			Index:   int32(f.FriendID),
+			Name:    name,
+			Memo:    f.Memo,
+			Blocked: f.Blocked,
+			Online:  env.GetPlayer(uint32(f.FriendID)) != nil,
+		})
+	}
+	p.Enqueue(&server.FriendUpdate{Friends: friends})
+}
+
+// NotifyFriendsStatus 通知把自己加为好友的在线玩家
+func (p *Player) NotifyFriendsStatus(online bool) {
+	status := "下线了"
+	if online {
+		status = "上线了"
+	}
+	for _, o := range p.Map.Env.GetOnlinePlayers() {
+		if o == p {
+			continue
+		}
+		f := o.GetFriend(int(p.ID))
+		if f == nil || f.Blocked {
+			continue
+		}
+		o.ReceiveChat(fmt.Sprintf("好友 %s %s", p.Name, status), common.ChatTypeRelationship)
+		o.RefreshFriends()
+	}
+}
+
+// TradeRequest 向面前的玩家发起交易请求，被对方拉黑时拒绝
+func (p *Player) TradeRequest() {
+	c := p.Map.GetNextCell(p.GetCell(), p.GetDirection(), 1)
+	if c == nil {
+		return
+	}
+	var target *Player
+	c.Objects.Range(func(k, v interface{}) bool {
+		if o, ok := v.(*Player); ok {
+			target = o
+			return false
+		}
+		return true
+	})
+	if target == nil {
+		p.ReceiveChat("面前没有可以交易的玩家", common.ChatTypeSystem)
+		return
+	}
+	if target.IsBlocked(p) {
+		p.ReceiveChat(fmt.Sprintf("%s 拒绝了你的交易请求", target.Name), common.ChatTypeSystem)
+		return
+	}
+	target.Enqueue(&server.TradeRequest{Name: p.Name})
+}
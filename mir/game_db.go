@@ -27,6 +27,16 @@ type GameDB struct {
 	MonsterNameInfoMap *sync.Map // key: Monster.Name value: MonsterInfo
 	DropInfoMap        *sync.Map // key: MonsterName, value: []common.DropInfo
 	MagicIDInfoMap     *sync.Map // key: MagicInfo.ID, value: MagicInfo
+	RecipeInfoMap      *sync.Map // key: ItemInfo.Name, value: common.RecipeInfo
+	ExpList            []int64   // 升级经验表，下标为等级 - 1
+}
+
+// GetMaxExperience 获取升到下一级需要的经验，达到经验表的等级数即满级，返回 0
+func (db *GameDB) GetMaxExperience(level uint16) int64 {
+	if level == 0 || int(level) >= len(db.ExpList) {
+		return 0
+	}
+	return db.ExpList[level-1]
 }
 
 // GetMapInfoByID ...
@@ -82,3 +92,22 @@ func (db *GameDB) GetMagicInfoByID(magicID int) *common.MagicInfo {
 	}
 	return v.(*common.MagicInfo)
 }
+
+// GetMagicInfoBySpell 根据技能获取魔法信息
+func (db *GameDB) GetMagicInfoBySpell(spell common.Spell) *common.MagicInfo {
+	for i := range db.MagicInfos {
+		if common.Spell(db.MagicInfos[i].Spell) == spell {
+			return db.GetMagicInfoByID(db.MagicInfos[i].ID)
+		}
+	}
+	return nil
+}
+
+// GetRecipeInfoByName 根据合成出的物品名获取配方
+func (db *GameDB) GetRecipeInfoByName(itemName string) *common.RecipeInfo {
+	v, ok := db.RecipeInfoMap.Load(itemName)
+	if !ok {
+		return nil
+	}
+	return v.(*common.RecipeInfo)
+}
@@ -0,0 +1,221 @@
+package mir
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// GameShopMaxQuantity 商城一次最多购买数量
+const GameShopMaxQuantity = 99
+
+// GetGameShopItemByID 获取商城商品
+func (db *GameDB) GetGameShopItemByID(id int) *common.GameShopItem {
+	for i := range db.GameShopItems {
+		if db.GameShopItems[i].ID == id {
+			return &db.GameShopItems[i]
+		}
+	}
+	return nil
+}
+
+// GameShopStockLevel 商品剩余库存，Stock 为 0 表示不限量返回 0
+// IStock 不为 0 时 Stock 是每个角色的限购数量，否则是全服库存
+func (e *Environ) GameShopStockLevel(item *common.GameShopItem, characterID int) int32 {
+	if item.Stock == 0 {
+		return 0
+	}
+	var res struct{ Total int }
+	db := e.Game.DB.Table("game_shop_log").Select("sum(count) as total").Where("game_shop_item_id = ?", item.ID)
+	if item.IStock != 0 {
+		db = db.Where("character_id = ?", characterID)
+	}
+	db.Scan(&res)
+	left := item.Stock - res.Total
+	if left < 0 {
+		left = 0
+	}
+	return int32(left)
+}
+
+// EnqueueGameShop 发送商城商品列表
+func (p *Player) EnqueueGameShop() {
+	env := p.Map.Env
+	for i := range env.GameDB.GameShopItems {
+		item := &env.GameDB.GameShopItems[i]
+		p.EnqueueItemInfo(int32(item.ItemID))
+		p.Enqueue(&server.GameShopInfo{
+			Item:       *item,
+			StockLevel: env.GameShopStockLevel(item, int(p.ID)),
+		})
+	}
+}
+
+// GameshopBuy 商城购买，优先使用元宝，元宝不足时使用金币
+func (p *Player) GameshopBuy(id int32, quantity uint8) {
+	if p.IsDead() || quantity == 0 || quantity > GameShopMaxQuantity {
+		return
+	}
+	env := p.Map.Env
+	item := env.GameDB.GetGameShopItemByID(int(id))
+	if item == nil {
+		return
+	}
+	info := env.GameDB.GetItemInfoByID(item.ItemID)
+	if info == nil {
+		return
+	}
+	if item.Stock != 0 && env.GameShopStockLevel(item, int(p.ID)) < int32(quantity) {
+		p.ReceiveChat(fmt.Sprintf("%s 库存不足", info.Name), common.ChatTypeSystem)
+		return
+	}
+	creditCost := uint32(item.CreditPrice) * uint32(quantity)
+	goldCost := uint64(item.GoldPrice) * uint64(quantity)
+	switch {
+	case item.CreditPrice > 0 && p.Credit >= creditCost:
+		goldCost = 0
+		p.TakeCredit(creditCost)
+	case item.GoldPrice > 0 && p.Gold >= goldCost:
+		creditCost = 0
+		p.TakeGold(goldCost)
+	default:
+		p.ReceiveChat("元宝或金币不足", common.ChatTypeSystem)
+		return
+	}
+
+	env.Game.DB.Table("game_shop_log").Create(&common.GameShopLog{
+		AccountID:      p.AccountID,
+		CharacterID:    int(p.ID),
+		GameShopItemID: item.ID,
+		Count:          int(quantity),
+		CreditCost:     int(creditCost),
+		GoldCost:       int(goldCost),
+		CreateTime:     time.Now().Unix(),
+	})
+	log.Infof("商城购买: 玩家 %s 购买 %s x%d, 花费元宝 %d 金币 %d\n", p.Name, info.Name, quantity, creditCost, goldCost)
+
+	stackSize := info.StackSize
+	if stackSize == 0 {
+		stackSize = 1
+	}
+	mailed := false
+	count := uint32(item.Count) * uint32(quantity)
+	for count > 0 {
+		ui := env.NewUserItem(info)
+		ui.Count = count
+		if ui.Count > stackSize {
+			ui.Count = stackSize
+		}
+		count -= ui.Count
+		if !p.CanGainItem(ui) || !p.GainItem(ui) {
+			p.SendMail("商城", "背包已满，购买的物品通过邮件发送", ui, 0)
+			mailed = true
+		}
+	}
+	if mailed {
+		p.ReceiveChat("背包已满，购买的物品已通过邮件发送", common.ChatTypeSystem)
+	}
+
+	if item.Stock != 0 {
+		msg := &server.GameShopStock{GIndex: int32(item.ID), StockLevel: env.GameShopStockLevel(item, int(p.ID))}
+		if item.IStock != 0 {
+			p.Enqueue(msg)
+		} else {
+			env.Broadcast(msg)
+		}
+	}
+}
+
+// SendMail 给玩家发送附带物品或金币的邮件
+func (p *Player) SendMail(sender, message string, ui *common.UserItem, gold uint64) {
+	mail := &common.Mail{
+		CharacterID: int(p.ID),
+		Sender:      sender,
+		Message:     message,
+		Gold:        gold,
+		CreateTime:  time.Now().Unix(),
+	}
+	if ui != nil {
+		mail.ItemID = ui.ItemID
+		mail.Count = ui.Count
+	}
+	p.Map.Env.Game.DB.Table("mail").Create(mail)
+}
+
+// DeliverMail 把未领取邮件中的物品和金币放入背包，背包放不下的留到下次
+func (p *Player) DeliverMail() {
+	env := p.Map.Env
+	mails := make([]common.Mail, 0)
+	env.Game.DB.Table("mail").Where("character_id = ? and collected = ?", p.ID, false).Find(&mails)
+	for i := range mails {
+		mail := &mails[i]
+		if mail.ItemID != 0 {
+			info := env.GameDB.GetItemInfoByID(int(mail.ItemID))
+			if info == nil {
+				continue
+			}
+			ui := env.NewUserItem(info)
+			ui.Count = mail.Count
+			if !p.CanGainItem(ui) {
+				continue
+			}
+			p.GainItem(ui)
+		}
+		p.GainGold(mail.Gold)
+		env.Game.DB.Table("mail").Where("id = ?", mail.ID).Update("collected", true)
+		p.ReceiveChat(fmt.Sprintf("收到 %s 的邮件: %s", mail.Sender, mail.Message), common.ChatTypeSystem)
+	}
+}
+
+// GainCredit 增加元宝
+func (p *Player) GainCredit(credit uint32) {
+	if credit == 0 {
+		return
+	}
+	p.Credit += credit
+	p.saveAccountBalance()
+	p.Enqueue(&server.GainedCredit{Credit: credit})
+}
+
+// TakeCredit 扣除元宝
+func (p *Player) TakeCredit(credit uint32) {
+	if credit == 0 {
+		return
+	}
+	if credit > p.Credit {
+		credit = p.Credit
+	}
+	p.Credit -= credit
+	p.saveAccountBalance()
+	p.Enqueue(&server.LoseCredit{Credit: credit})
+}
+
+// GainPearls 增加珍珠
+func (p *Player) GainPearls(pearls uint32) {
+	if pearls == 0 {
+		return
+	}
+	p.Pearls += pearls
+	p.saveAccountBalance()
+	p.ReceiveChat(fmt.Sprintf("获得 %d 珍珠, 当前 %d", pearls, p.Pearls), common.ChatTypeSystem)
+}
+
+// TakePearls 扣除珍珠
+func (p *Player) TakePearls(pearls uint32) {
+	if pearls > p.Pearls {
+		pearls = p.Pearls
+	}
+	p.Pearls -= pearls
+	p.saveAccountBalance()
+	p.ReceiveChat(fmt.Sprintf("消耗 %d 珍珠, 剩余 %d", pearls, p.Pearls), common.ChatTypeSystem)
+}
+
+// saveAccountBalance 元宝和珍珠属于账号，变化后立即保存
+func (p *Player) saveAccountBalance() {
+	p.Map.Env.Game.DB.Table("account").Where("id = ?", p.AccountID).Updates(map[string]interface{}{
+		"credit": p.Credit,
+		"pearls": p.Pearls,
+	})
+}
@@ -0,0 +1,149 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// MaxGroup 队伍最多人数
+const MaxGroup = 15
+
+// SwitchGroup 开关是否允许组队，关闭时离开队伍
+func (p *Player) SwitchGroup(allow bool) {
+	if p.AllowGroup == allow {
+		return
+	}
+	p.AllowGroup = allow
+	p.Enqueue(&server.SwitchGroup{AllowGroup: allow})
+	if !allow {
+		p.LeaveGroup()
+	}
+}
+
+// AddMember 队长邀请玩家加入队伍，没有队伍时邀请后成为队长
+func (p *Player) AddMember(name string) {
+	if len(p.GroupMembers) > 0 && p.GroupMembers[0] != p {
+		p.ReceiveChat("只有队长才能邀请队员", common.ChatTypeSystem)
+		return
+	}
+	if len(p.GroupMembers) >= MaxGroup {
+		p.ReceiveChat("队伍已满", common.ChatTypeSystem)
+		return
+	}
+	o := p.Map.Env.GetPlayerByName(name)
+	if o == nil {
+		p.ReceiveChat(fmt.Sprintf("找不到玩家(%s)", name), common.ChatTypeSystem)
+		return
+	}
+	if o == p {
+		p.ReceiveChat("不能邀请自己", common.ChatTypeSystem)
+		return
+	}
+	if !o.AllowGroup {
+		p.ReceiveChat(fmt.Sprintf("%s 不允许组队", o.Name), common.ChatTypeSystem)
+		return
+	}
+	if len(o.GroupMembers) > 0 {
+		p.ReceiveChat(fmt.Sprintf("%s 已经在队伍中", o.Name), common.ChatTypeSystem)
+		return
+	}
+	if o.GroupInvitation != nil {
+		p.ReceiveChat(fmt.Sprintf("%s 正在被邀请", o.Name), common.ChatTypeSystem)
+		return
+	}
+	p.SwitchGroup(true)
+	o.GroupInvitation = p
+	o.Enqueue(&server.GroupInvite{Name: p.Name})
+}
+
+// GroupInvite 回应组队邀请
+func (p *Player) GroupInvite(accept bool) {
+	leader := p.GroupInvitation
+	if leader == nil {
+		return
+	}
+	p.GroupInvitation = nil
+	if !accept {
+		leader.ReceiveChat(fmt.Sprintf("%s 拒绝了组队邀请", p.Name), common.ChatTypeSystem)
+		return
+	}
+	if len(p.GroupMembers) > 0 {
+		p.ReceiveChat("你已经在队伍中", common.ChatTypeSystem)
+		return
+	}
+	if leader.Map.Env.GetPlayer(leader.ID) == nil {
+		p.ReceiveChat(fmt.Sprintf("%s 已经离线", leader.Name), common.ChatTypeSystem)
+		return
+	}
+	if len(leader.GroupMembers) > 0 && leader.GroupMembers[0] != leader {
+		p.ReceiveChat(fmt.Sprintf("%s 已经不是队长", leader.Name), common.ChatTypeSystem)
+		return
+	}
+	if len(leader.GroupMembers) >= MaxGroup {
+		p.ReceiveChat("队伍已满", common.ChatTypeSystem)
+		return
+	}
+	if len(leader.GroupMembers) == 0 {
+		setGroup([]*Player{leader})
+		leader.Enqueue(&server.AddMember{Name: leader.Name})
+	}
+	members := append([]*Player{}, leader.GroupMembers...)
+	for _, o := range members {
+		o.Enqueue(&server.AddMember{Name: p.Name})
+		p.Enqueue(&server.AddMember{Name: o.Name})
+	}
+	p.Enqueue(&server.AddMember{Name: p.Name})
+	setGroup(append(members, p))
+}
+
+// DelMember 队长把队员移出队伍，也可以移除自己
+func (p *Player) DelMember(name string) {
+	if len(p.GroupMembers) == 0 {
+		return
+	}
+	if p.GroupMembers[0] != p {
+		p.ReceiveChat("只有队长才能移除队员", common.ChatTypeSystem)
+		return
+	}
+	for _, o := range p.GroupMembers {
+		if o.Name == name {
+			o.LeaveGroup()
+			return
+		}
+	}
+	p.ReceiveChat(fmt.Sprintf("%s 不在队伍中", name), common.ChatTypeSystem)
+}
+
+// LeaveGroup 离开队伍，只剩一个人时解散队伍
+func (p *Player) LeaveGroup() {
+	p.GroupInvitation = nil
+	if len(p.GroupMembers) == 0 {
+		return
+	}
+	rest := make([]*Player, 0, len(p.GroupMembers))
+	for _, o := range p.GroupMembers {
+		if o != p {
+			rest = append(rest, o)
+		}
+	}
+	p.GroupMembers = nil
+	p.Enqueue(&server.DeleteGroup{})
+	if len(rest) == 1 {
+		rest[0].GroupMembers = nil
+		rest[0].Enqueue(&server.DeleteGroup{})
+		return
+	}
+	for _, o := range rest {
+		o.Enqueue(&server.DeleteMember{Name: p.Name})
+	}
+	setGroup(rest)
+}
+
+// setGroup 让所有队员共用同一份队员列表
+func setGroup(members []*Player) {
+	for _, o := range members {
+		o.GroupMembers = members
+	}
+}
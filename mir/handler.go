@@ -10,6 +10,7 @@ import (
 	_ "github.com/yenkeia/mirgo/proc/mirtcp"
 	"github.com/yenkeia/mirgo/proto/client"
 	"github.com/yenkeia/mirgo/proto/server"
+	"github.com/yenkeia/mirgo/setting"
 )
 
 func (g *Game) HandleEvent(ev cellnet.Event) {
@@ -323,6 +324,7 @@ func (g *Game) SessionClosed(s cellnet.Session, msg *cellnet.SessionClosed) {
 	p := v.(*Player)
 	if p.GameStage == GAME {
 		p.StopGame(StopGameUserClosedGame)
+		savePlayerInfo(g, p)
 		g.Env.DeletePlayer(p)
 	}
 	pm.Delete(s.ID())
@@ -466,6 +468,26 @@ func (g *Game) NewCharacter(s cellnet.Session, msg *client.NewCharacter) {
 		s.Send(ServerMessage{}.NewCharacter(4))
 		return
 	}
+	if msg.Gender != common.MirGenderMale && msg.Gender != common.MirGenderFemale {
+		s.Send(ServerMessage{}.NewCharacter(2))
+		return
+	}
+	switch msg.Class {
+	case common.MirClassWarrior, common.MirClassWizard, common.MirClassTaoist:
+	case common.MirClassAssassin:
+		if !setting.Conf.AllowCreateAssassin {
+			s.Send(ServerMessage{}.NewCharacter(3))
+			return
+		}
+	case common.MirClassArcher:
+		if !setting.Conf.AllowCreateArcher {
+			s.Send(ServerMessage{}.NewCharacter(3))
+			return
+		}
+	default:
+		s.Send(ServerMessage{}.NewCharacter(3))
+		return
+	}
 	s.Send(ServerMessage{}.NewCharacterSuccess(g, p.AccountID, msg.Name, msg.Class, msg.Gender))
 }
 
@@ -504,6 +526,7 @@ func updatePlayerInfo(g *Game, p *Player, c *common.Character) {
 	is := make([]int, 0, 46)
 	es := make([]int, 0, 14)
 	qs := make([]int, 0, 40)
+	ss := make([]int, 0, ExpandedStorageSize)
 	for _, i := range cui {
 		switch common.UserItemType(i.Type) {
 		case common.UserItemTypeInventory:
@@ -512,20 +535,28 @@ func updatePlayerInfo(g *Game, p *Player, c *common.Character) {
 			es = append(es, i.UserItemID)
 		case common.UserItemTypeQuestInventory:
 			qs = append(qs, i.UserItemID)
+		case common.UserItemTypeStorage:
+			ss = append(ss, i.UserItemID)
 		}
 		userItemIDIndexMap[i.UserItemID] = i.Index
 	}
 	inventory := make([]common.UserItem, 46)
 	equipment := make([]common.UserItem, 14)
 	questInventory := make([]common.UserItem, 40)
+	storage := make([]common.UserItem, StorageSize)
+	if c.HasExpandedStorage {
+		storage = make([]common.UserItem, ExpandedStorageSize)
+	}
 	trade := make([]common.UserItem, 0)
 	refine := make([]common.UserItem, 0)
 	uii := make([]common.UserItem, 0, 46)
 	uie := make([]common.UserItem, 0, 14)
 	uiq := make([]common.UserItem, 0, 40)
+	uis := make([]common.UserItem, 0, len(ss))
 	g.DB.Table("user_item").Where("id in (?)", is).Find(&uii)
 	g.DB.Table("user_item").Where("id in (?)", es).Find(&uie)
 	g.DB.Table("user_item").Where("id in (?)", qs).Find(&uiq)
+	g.DB.Table("user_item").Where("id in (?)", ss).Find(&uis)
 	for _, v := range uii {
 		inventory[userItemIDIndexMap[int(v.ID)]] = v
 	}
@@ -535,14 +566,28 @@ func updatePlayerInfo(g *Game, p *Player, c *common.Character) {
 	for _, v := range uiq {
 		questInventory[userItemIDIndexMap[int(v.ID)]] = v
 	}
+	for _, v := range uis {
+		if i := userItemIDIndexMap[int(v.ID)]; i < len(storage) {
+			storage[i] = v
+		}
+	}
 	magics := make([]common.UserMagic, 0)
 	g.DB.Table("user_magic").Where("character_id = ?", c.ID).Find(&magics)
+	for i := range magics {
+		magics[i].Info = g.Env.GameDB.GetMagicInfoByID(magics[i].MagicID)
+	}
+	friends := make([]common.Friend, 0)
+	g.DB.Table("friend").Where("character_id = ?", c.ID).Find(&friends)
 	healNextTime := time.Now().Add(10 * time.Second)
 	p.HP = c.HP
 	p.MP = c.MP
 	p.Level = c.Level
 	p.Experience = c.Experience
 	p.Gold = c.Gold
+	ac := new(common.Account)
+	g.DB.Table("account").Where("id = ?", p.AccountID).Find(ac)
+	p.Credit = ac.Credit
+	p.Pearls = ac.Pearls
 	p.GuildName = ""     // TODO
 	p.GuildRankName = "" // TODO
 	p.Class = c.Class
@@ -551,11 +596,14 @@ func updatePlayerInfo(g *Game, p *Player, c *common.Character) {
 	p.Inventory = inventory
 	p.Equipment = equipment
 	p.QuestInventory = questInventory
+	p.Storage = storage
+	p.HasExpandedStorage = c.HasExpandedStorage
 	p.Trade = trade
 	p.Refine = refine
 	p.SendItemInfo = make([]common.ItemInfo, 0)
-	p.MaxExperience = 100
 	p.Magics = magics
+	p.Friends = friends
+	p.AllowGroup = true
 	p.ActionList = new(sync.Map)
 	p.Health = Health{
 		HPPotNextTime: new(time.Time),
@@ -568,10 +616,95 @@ func updatePlayerInfo(g *Game, p *Player, c *common.Character) {
 	p.Pets = make([]IMapObject, 0)
 	p.PKPoints = 0
 	p.AMode = common.AttackModeAll
-	p.PMode = common.PetModeNone
+	p.PMode = c.PetMode
 	p.CallingNPC = nil
 }
 
+// savePlayerInfo 保存角色信息，各个格子里的物品写回 user_item 和 character_user_item
+func savePlayerInfo(g *Game, p *Player) {
+	g.DB.Table("character").Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"level":                p.Level,
+		"experience":           p.Experience,
+		"gold":                 p.Gold,
+		"hp":                   p.HP,
+		"mp":                   p.MP,
+		"current_map_id":       p.Map.Info.ID,
+		"current_location_x":   p.CurrentLocation.X,
+		"current_location_y":   p.CurrentLocation.Y,
+		"direction":            p.CurrentDirection,
+		"has_expanded_storage": p.HasExpandedStorage,
+		"pet_mode":             p.PMode,
+	})
+
+	tx := g.DB.Begin()
+	old := make([]common.CharacterUserItem, 0)
+	tx.Table("character_user_item").Where("character_id = ?", p.ID).Find(&old)
+	tx.Table("character_user_item").Where("character_id = ?", p.ID).Delete(common.CharacterUserItem{})
+	saved := make(map[int]bool)
+	grids := []struct {
+		typ   common.UserItemType
+		items []common.UserItem
+	}{
+		{common.UserItemTypeInventory, p.Inventory},
+		{common.UserItemTypeEquipment, p.Equipment},
+		{common.UserItemTypeQuestInventory, p.QuestInventory},
+		{common.UserItemTypeStorage, p.Storage},
+	}
+	for _, grid := range grids {
+		for i := range grid.items {
+			ui := grid.items[i]
+			if ui.ID == 0 {
+				continue
+			}
+			tx.Table("user_item").Save(&ui)
+			tx.Table("character_user_item").Create(&common.CharacterUserItem{
+				CharacterID: int(p.ID),
+				UserItemID:  int(ui.ID),
+				Type:        int(grid.typ),
+				Index:       i,
+			})
+			saved[int(ui.ID)] = true
+		}
+	}
+	// 已经不在身上的物品，没有被其他角色持有就删除
+	removed := make([]int, 0)
+	for _, c := range old {
+		if !saved[c.UserItemID] {
+			removed = append(removed, c.UserItemID)
+		}
+	}
+	if len(removed) != 0 {
+		tx.Table("user_item").Where("id in (?) and id not in (select user_item_id from character_user_item)", removed).Delete(common.UserItem{})
+	}
+	for _, um := range p.Magics {
+		tx.Table("user_magic").Where("id = ?", um.ID).Updates(map[string]interface{}{
+			"level":      um.Level,
+			"experience": um.Experience,
+			"magic_key":  um.Key,
+			"cast_time":  um.CastTime,
+		})
+	}
+	// 宠物下线时保存，上线时重新召唤
+	tx.Table("character_pet").Where("character_id = ?", p.ID).Delete(common.CharacterPet{})
+	for _, o := range p.Pets {
+		m := o.(*Monster)
+		if m.IsDead() || m.Info == nil || m.Name == CloneName {
+			continue
+		}
+		tx.Table("character_pet").Create(&common.CharacterPet{
+			CharacterID: int(p.ID),
+			MonsterID:   m.Info.ID,
+			HP:          m.HP,
+			Experience:  m.PetExperience,
+			Level:       m.PetLevel,
+			MaxLevel:    m.MaxPetLevel,
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Errorf("保存角色物品失败: %s %s\n", p.Name, err.Error())
+	}
+}
+
 // StartGame 开始游戏
 func (g *Game) StartGame(s cellnet.Session, msg *client.StartGame) {
 	p, ok := g.GetPlayer(s, SELECT)
@@ -596,6 +729,33 @@ func (g *Game) StartGame(s cellnet.Session, msg *client.StartGame) {
 	p.Map = g.Env.GetMap(int(c.CurrentMapID))
 	g.Env.AddPlayer(p)
 	p.StartGame()
+	restorePets(g, p)
+}
+
+// restorePets 重新召唤下线时保存的宠物
+func restorePets(g *Game, p *Player) {
+	pets := make([]common.CharacterPet, 0)
+	g.DB.Table("character_pet").Where("character_id = ?", p.ID).Find(&pets)
+	for _, cp := range pets {
+		mi := g.Env.GameDB.GetMonsterInfoByID(cp.MonsterID)
+		if mi == nil {
+			continue
+		}
+		back := p.petBack()
+		pt, err := p.Map.GetValidPoint(int(back.X), int(back.Y), 1)
+		if err != nil {
+			pt = p.CurrentLocation
+		}
+		m := NewMonster(p.Map, pt, mi)
+		m.SetPetLevel(cp.Level)
+		m.MaxPetLevel = cp.MaxLevel
+		m.PetExperience = cp.Experience
+		if cp.HP > 0 && cp.HP < m.MaxHP {
+			m.HP = cp.HP
+		}
+		p.AddPet(m)
+		m.Spawn(p.Map, pt)
+	}
 }
 
 func (g *Game) LogOut(s cellnet.Session, msg *client.LogOut) {
@@ -604,6 +764,7 @@ func (g *Game) LogOut(s cellnet.Session, msg *client.LogOut) {
 		return
 	}
 	p.StopGame(StopGameUserReturnedToSelectChar)
+	savePlayerInfo(g, p)
 	g.Env.DeletePlayer(p)
 	s.Send(ServerMessage{}.LogOutSuccess(g.getAccountCharacters(p.AccountID)))
 }
@@ -744,9 +905,8 @@ func (g *Game) BuyItem(p *Player, msg *client.BuyItem) {
 	p.BuyItem(msg.ItemIndex, msg.Count, msg.Type)
 }
 
-// TODO
 func (g *Game) CraftItem(p *Player, msg *client.CraftItem) {
-	p.CraftItem()
+	p.CraftItem(msg.UniqueID, msg.Count, msg.Slots)
 }
 
 func (g *Game) SellItem(p *Player, msg *client.SellItem) {
@@ -898,7 +1058,7 @@ func (g *Game) CancelMentor(p *Player, msg *client.CancelMentor) {
 }
 
 func (g *Game) TradeRequest(p *Player, msg *client.TradeRequest) {
-	//p.TradeRequest()
+	p.TradeRequest()
 }
 
 func (g *Game) TradeGold(p *Player, msg *client.TradeGold) {
@@ -954,7 +1114,7 @@ func (g *Game) CancelReincarnation(p *Player, msg *client.CancelReincarnation) {
 }
 
 func (g *Game) CombineItem(p *Player, msg *client.CombineItem) {
-	//p.CombineItem()
+	p.CombineItem(msg.IDFrom, msg.IDTo)
 }
 
 func (g *Game) SetConcentration(p *Player, msg *client.SetConcentration) {
@@ -962,27 +1122,27 @@ func (g *Game) SetConcentration(p *Player, msg *client.SetConcentration) {
 }
 
 func (g *Game) AwakeningNeedMaterials(p *Player, msg *client.AwakeningNeedMaterials) {
-
+	p.AwakeningNeedMaterials(msg.UniqueID, msg.Type)
 }
 
 func (g *Game) AwakeningLockedItem(p *Player, msg *client.AwakeningLockedItem) {
-
+	p.AwakeningLockedItem(msg.UniqueID, msg.Locked)
 }
 
 func (g *Game) Awakening(p *Player, msg *client.Awakening) {
-
+	p.Awakening(msg.UniqueID, msg.Type)
 }
 
 func (g *Game) DisassembleItem(p *Player, msg *client.DisassembleItem) {
-
+	p.DisassembleItem(msg.UniqueID)
 }
 
 func (g *Game) DowngradeAwakening(p *Player, msg *client.DowngradeAwakening) {
-
+	p.DowngradeAwakening(msg.UniqueID)
 }
 
 func (g *Game) ResetAddedItem(p *Player, msg *client.ResetAddedItem) {
-
+	p.ResetAddedItem(msg.UniqueID)
 }
 
 func (g *Game) SendMail(p *Player, msg *client.SendMail) {
@@ -1022,19 +1182,19 @@ func (g *Game) IntelligentCreaturePickup(p *Player, msg *client.IntelligentCreat
 }
 
 func (g *Game) AddFriend(p *Player, msg *client.AddFriend) {
-
+	p.AddFriend(msg.Name, msg.Blocked)
 }
 
 func (g *Game) RemoveFriend(p *Player, msg *client.RemoveFriend) {
-
+	p.RemoveFriend(int(msg.CharacterIndex))
 }
 
 func (g *Game) RefreshFriends(p *Player, msg *client.RefreshFriends) {
-
+	p.RefreshFriends()
 }
 
 func (g *Game) AddMemo(p *Player, msg *client.AddMemo) {
-
+	p.AddMemo(int(msg.CharacterIndex), msg.Memo)
 }
 
 func (g *Game) GuildBuffUpdate(p *Player, msg *client.GuildBuffUpdate) {
@@ -1042,7 +1202,7 @@ func (g *Game) GuildBuffUpdate(p *Player, msg *client.GuildBuffUpdate) {
 }
 
 func (g *Game) GameshopBuy(p *Player, msg *client.GameshopBuy) {
-
+	p.GameshopBuy(msg.GIndex, msg.Quantity)
 }
 
 func (g *Game) NPCConfirmInput(p *Player, msg *client.NPCConfirmInput) {
@@ -1054,7 +1214,7 @@ func (g *Game) ReportIssue(p *Player, msg *client.ReportIssue) {
 }
 
 func (g *Game) GetRanking(p *Player, msg *client.GetRanking) {
-
+	p.GetRanking(msg.RankIndex, msg.StartIndex, msg.OnlineOnly)
 }
 
 func (g *Game) Opendoor(p *Player, msg *client.Opendoor) {
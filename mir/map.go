@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
 )
 
 // Map ...
@@ -18,6 +19,7 @@ type Map struct {
 	players  map[uint32]*Player
 	monsters map[uint32]*Monster
 	npcs     map[uint32]*NPC
+	spells   map[uint32]*SpellObject
 
 	ActionList map[uint32]*DelayedAction
 }
@@ -30,6 +32,9 @@ func NewMap(w, h int) *Map {
 		players:  map[uint32]*Player{},
 		monsters: map[uint32]*Monster{},
 		npcs:     map[uint32]*NPC{},
+		spells:   map[uint32]*SpellObject{},
+
+		ActionList: map[uint32]*DelayedAction{},
 	}
 	return m
 }
@@ -48,13 +53,21 @@ func (m *Map) Loop() {
 		select {
 		case <-mapTicker.C:
 
+			now := time.Now()
 			for i, action := range m.ActionList {
-				if !action.Finish && !time.Now().Before(action.ActionTime) {
+				if now.Before(action.ActionTime) {
+					continue
+				}
+				if !action.Finish {
 					action.Task.Execute()
 				}
 				delete(m.ActionList, i)
 			}
 
+			for _, s := range m.spells {
+				s.Process(now)
+			}
+
 		case <-playerTicker.C:
 
 			for _, p := range m.players {
@@ -153,6 +166,8 @@ func (m *Map) AddObject(obj IMapObject) (string, bool) {
 		m.npcs[obj.GetID()] = obj.(*NPC)
 	case *Monster:
 		m.monsters[obj.GetID()] = obj.(*Monster)
+	case *SpellObject:
+		m.spells[obj.GetID()] = obj.(*SpellObject)
 	}
 
 	return "", true
@@ -175,6 +190,8 @@ func (m *Map) DeleteObject(obj IMapObject) {
 		delete(m.monsters, obj.GetID())
 	case *NPC:
 		delete(m.npcs, obj.GetID())
+	case *SpellObject:
+		delete(m.spells, obj.GetID())
 	}
 }
 
@@ -215,7 +232,7 @@ func (m *Map) changeAOI(obj IMapObject, c1 *Cell, c2 *Cell) {
 		p.EnqueueAreaObjects(c1, c2)
 	case common.ObjectTypeMonster:
 		m := obj.(*Monster)
-		m.Broadcast(ServerMessage{}.ObjectMonster(m))
+		m.Broadcast(m.GetInfo())
 	}
 }
 
@@ -410,7 +427,7 @@ func (m *Map) CalcDiff(from, to common.Point, datarange int) *CellSet {
 func (m *Map) CompleteMagic(args ...interface{}) {
 	magic := args[0].(*common.UserMagic)
 	switch magic.Spell {
-	case common.SpellSummonSkeleton, common.SpellSummonShinsu, common.SpellSummonHolyDeva, common.SpellSummonVampire, common.SpellSummonToad, common.SpellSummonSnakes:
+	case common.SpellSummonSkeleton, common.SpellSummonShinsu, common.SpellSummonHolyDeva, common.SpellSummonVampire, common.SpellSummonToad, common.SpellSummonSnakes, common.SpellMirroring:
 		player := args[1].(*Player)
 		monster := args[2].(*Monster)
 		front := args[3].(common.Point)
@@ -423,24 +440,76 @@ func (m *Map) CompleteMagic(args ...interface{}) {
 		} else {
 			monster.Spawn(m, player.GetPoint())
 		}
-		pets := monster.Master.Pets
-		pets = append(pets, monster)
-	case common.SpellMassHealing:
+		player.AddPet(monster)
+	case common.SpellLionRoar, common.SpellBattleCry:
+		player := args[1].(*Player)
+		location := args[2].(common.Point)
+		hit := false
+		m.RangeObject(location, 2, func(o IMapObject) bool {
+			monster, ok := o.(*Monster)
+			if !ok || monster.IsDead() || !monster.IsAttackTarget(player) || int(monster.Level) > int(player.Level)+3 {
+				return true
+			}
+			monster.ApplyPoison(NewPoison(player.NewObjectID(), player, 0, common.PoisonTypeLRParalysis, time.Second, magic.Level+2), player)
+			hit = true
+			return true
+		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellMassHiding:
 		value := args[1].(int)
 		location := args[2].(common.Point)
 		player := args[3].(*Player)
+		hit := false
 		m.RangeObject(location, 1, func(o IMapObject) bool {
 			if o.GetRace() == common.ObjectTypePlayer && o.IsFriendlyTarget(player) {
 				target := o.(*Player)
-				for i := range target.Buffs {
-					if target.Buffs[i].BuffType == common.BuffTypeHiding {
-						return true
-					}
+				if target.GetBuff(common.BuffTypeHiding) != nil {
+					return true
 				}
 				target.AddBuff(NewBuff(player.NewObjectID(), common.BuffTypeHiding, 0, time.Now().Add(time.Duration(value*1000)*time.Millisecond)))
+				hit = true
 			}
 			return true
 		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellMassHealing:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		hit := false
+		m.RangeObject(location, 1, func(o IMapObject) bool {
+			if o.IsFriendlyTarget(player) && healObject(o, value) {
+				hit = true
+			}
+			return true
+		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellTrapHexagon:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		hit := false
+		m.RangeObject(location, 1, func(o IMapObject) bool {
+			monster, ok := o.(*Monster)
+			if !ok || monster.IsDead() || monster.Master != nil || !monster.IsAttackTarget(player) || int(monster.Level) > int(player.Level)+2 {
+				return true
+			}
+			monster.Target = nil
+			monster.ApplyPoison(NewPoison(player.NewObjectID(), player, 0, common.PoisonTypeLRParalysis, time.Second, value), player)
+			hit = true
+			return true
+		})
+		if !hit {
+			return
+		}
+		m.spawnSpell(player, magic.Spell, 0, location, time.Duration(value)*time.Second, time.Duration(value)*time.Second, true)
+		player.LevelMagic(magic)
 	case common.SpellSoulShield, common.SpellBlessedArmour:
 		value := args[1].(int)
 		location := args[2].(common.Point)
@@ -450,26 +519,254 @@ func (m *Map) CompleteMagic(args ...interface{}) {
 			buffType = common.BuffTypeBlessedArmour
 		}
 		m.RangeObject(location, 1, func(o IMapObject) bool {
-			if o.GetRace() == common.ObjectTypePlayer {
+			if o.GetRace() == common.ObjectTypePlayer && o.IsFriendlyTarget(player) {
 				target := o.(*Player)
 				target.AddBuff(NewBuff(player.NewObjectID(), buffType, int(target.Level)/7+4, time.Now().Add(time.Duration(value*1000)*time.Millisecond)))
 			}
 			return true
 		})
+		player.LevelMagic(magic)
 	case common.SpellFireWall:
-		// player := args[1].(*Player)
-		// value := args[2].(int)
-		// location := args[3].(common.Point)
-		// player.LevelMagic(magic)
-		// TODO SpellObject
-	case common.SpellLightning:
-		// player := args[1].(*Player)
-		// value := args[2].(int)
-		// location := args[3].(common.Point)
-		// direction := args[4].(common.MirDirection)
-	case common.SpellThunderStorm, common.SpellFlameField, common.SpellNapalmShot, common.SpellStormEscape:
-		// player := args[1].(*Player)
-		// value := args[2].(int)
-		// location := args[3].(common.Point)
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		duration := time.Duration(10+value/2) * time.Second
+		if !m.spawnSpell(player, magic.Spell, value, location, duration, 2*time.Second, true) {
+			return
+		}
+		player.LevelMagic(magic)
+		for _, dir := range []common.MirDirection{common.MirDirectionUp, common.MirDirectionDown, common.MirDirectionLeft, common.MirDirectionRight} {
+			m.spawnSpell(player, magic.Spell, value, location.NextPoint(dir, 1), duration, 2*time.Second, true)
+		}
+	case common.SpellCurse, common.SpellPlague: // 立即对 3x3 范围内的目标生效一次
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		m.RangeCell(location, 1, func(c *Cell, x, y int) bool {
+			m.rangeAttackTargets(player, common.NewPoint(x, y), func(o IMapObject) {
+				if magic.Spell == common.SpellCurse {
+					m.curse(o, player, value)
+				} else {
+					m.plague(o, player, value)
+				}
+			})
+			return true
+		})
+		player.LevelMagic(magic)
+	case common.SpellPoisonCloud, common.SpellBlizzard, common.SpellMeteorStrike, common.SpellNapalmShot:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		area := areaSpells[magic.Spell]
+		m.RangeCell(location, area.radius, func(c *Cell, x, y int) bool {
+			pt := common.NewPoint(x, y)
+			m.spawnSpell(player, magic.Spell, value, pt, area.duration, area.tick, pt.Equal(location))
+			return true
+		})
+		player.LevelMagic(magic)
+	case common.SpellOneWithNature:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		hit := false
+		m.RangeCell(location, 1, func(c *Cell, x, y int) bool {
+			m.rangeAttackTargets(player, common.NewPoint(x, y), func(o IMapObject) {
+				if spellAttack(o, player, value, common.DefenceTypeMAC) > 0 {
+					hit = true
+				}
+			})
+			return true
+		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellDelayedExplosion: // 中了爆裂箭的目标爆炸，伤害周围的敌人
+		player := args[1].(*Player)
+		value := args[2].(int)
+		target := args[3].(IMapObject)
+		if target.IsDead() || target.GetCell() == nil || target.GetCell().Map != m {
+			return
+		}
+		location := target.GetPoint()
+		m.BroadcastP(location, &server.ObjectEffect{ObjectID: target.GetID(), Effect: common.SpellEffectDelayedExplosion}, nil)
+		m.RangeCell(location, 1, func(c *Cell, x, y int) bool {
+			m.rangeAttackTargets(player, common.NewPoint(x, y), func(o IMapObject) {
+				spellAttack(o, player, value, common.DefenceTypeMAC)
+			})
+			return true
+		})
+	case common.SpellLightning, common.SpellHellFire:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		direction := args[4].(common.MirDirection)
+		length := uint32(8)
+		if magic.Spell == common.SpellHellFire {
+			length = 4
+		}
+		hit := false
+		for i := uint32(1); i <= length; i++ {
+			m.rangeAttackTargets(player, location.NextPoint(direction, i), func(o IMapObject) {
+				if spellAttack(o, player, value, common.DefenceTypeMAC) > 0 {
+					hit = true
+				}
+			})
+		}
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellFireBang, common.SpellIceStorm, common.SpellThunderStorm, common.SpellFlameField, common.SpellStormEscape:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		radius := 1
+		if magic.Spell != common.SpellFireBang && magic.Spell != common.SpellIceStorm {
+			radius = 2
+		}
+		hit := false
+		m.RangeCell(location, radius, func(c *Cell, x, y int) bool {
+			m.rangeAttackTargets(player, common.NewPoint(x, y), func(o IMapObject) {
+				damage := value
+				// 地狱雷光对不死系以外的目标只有十分之一的伤害
+				if magic.Spell == common.SpellThunderStorm && !o.IsUndead() {
+					damage /= 10
+				}
+				if spellAttack(o, player, damage, common.DefenceTypeMAC) <= 0 {
+					return
+				}
+				hit = true
+				if magic.Spell == common.SpellIceStorm {
+					player.freeze(o, magic)
+				}
+			})
+			return true
+		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellIceThrust:
+		player := args[1].(*Player)
+		value := args[2].(int)
+		location := args[3].(common.Point)
+		direction := args[4].(common.MirDirection)
+		left := common.MirDirection((int(direction) + 6) % 8)
+		right := common.MirDirection((int(direction) + 2) % 8)
+		hit := false
+		attack := func(o IMapObject) {
+			if spellAttack(o, player, value, common.DefenceTypeMAC) > 0 {
+				hit = true
+				player.freeze(o, magic)
+			}
+		}
+		// 锥形范围，第一格只有正前方，之后每格向两侧扩展一格
+		for i := uint32(0); i < 4; i++ {
+			center := location.NextPoint(direction, i)
+			m.rangeAttackTargets(player, center, attack)
+			if i == 0 {
+				continue
+			}
+			m.rangeAttackTargets(player, center.NextPoint(left, 1), attack)
+			m.rangeAttackTargets(player, center.NextPoint(right, 1), attack)
+		}
+		if hit {
+			player.LevelMagic(magic)
+		}
+	case common.SpellRepulsion, common.SpellEnergyRepulsor, common.SpellFireBurst:
+		player := args[1].(*Player)
+		location := args[2].(common.Point)
+		hit := false
+		m.RangeObject(location, 1, func(o IMapObject) bool {
+			if o.GetPoint().Equal(location) || o.IsDead() || !o.IsAttackTarget(player) {
+				return true
+			}
+			level := objectLevel(o)
+			if level >= int(player.Level) || RandomNext(20) >= 6+magic.Level*3+int(player.Level)-level {
+				return true
+			}
+			distance := 1 + RandomNext(2)
+			if magic.Level > 1 {
+				distance += magic.Level - 1
+			}
+			if pushObject(o, DirectionFromPoint(location, o.GetPoint()), distance) > 0 {
+				hit = true
+			}
+			return true
+		})
+		if hit {
+			player.LevelMagic(magic)
+		}
+	}
+}
+
+// rangeAttackTargets 遍历格子上可以被 caster 攻击的玩家和怪物
+func (m *Map) rangeAttackTargets(caster IMapObject, location common.Point, fun func(IMapObject)) {
+	c := m.GetCell(location)
+	if c == nil {
+		return
+	}
+	c.Objects.Range(func(_, v interface{}) bool {
+		o := v.(IMapObject)
+		switch o.GetRace() {
+		case common.ObjectTypePlayer, common.ObjectTypeMonster:
+			if !o.IsDead() && o.IsAttackTarget(caster) {
+				fun(o)
+			}
+		}
+		return true
+	})
+}
+
+// curse 诅咒目标，value 同时为诅咒的强度和秒数
+func (m *Map) curse(o, caster IMapObject, value int) {
+	o.AddBuff(NewBuff(m.Env.NewObjectID(), common.BuffTypeCurse, value, time.Now().Add(time.Duration(value)*time.Second)))
+	o.ApplyPoison(NewPoison(m.Env.NewObjectID(), caster, 0, common.PoisonTypeSlow, time.Second, value), caster)
+}
+
+// plague 瘟疫随机施加一种毒
+func (m *Map) plague(o, caster IMapObject, value int) {
+	typ := common.PoisonType(common.PoisonTypeGreen)
+	switch RandomNext(10) {
+	case 0:
+		typ = common.PoisonTypeParalysis
+	case 1, 2:
+		typ = common.PoisonTypeSlow
+	case 3, 4:
+		typ = common.PoisonTypeRed
+	}
+	o.ApplyPoison(NewPoison(m.Env.NewObjectID(), caster, value, typ, 2*time.Second, 5), caster)
+}
+
+// areaSpell 范围地面魔法的半径、持续时间和生效间隔
+type areaSpell struct {
+	radius   int
+	duration time.Duration
+	tick     time.Duration
+}
+
+var areaSpells = map[common.Spell]areaSpell{
+	common.SpellPoisonCloud:  {1, 6 * time.Second, time.Second},
+	common.SpellBlizzard:     {2, 3 * time.Second, time.Second},
+	common.SpellMeteorStrike: {2, 3 * time.Second, time.Second},
+	common.SpellNapalmShot:   {1, 4 * time.Second, time.Second},
+}
+
+// spawnSpell 在 location 放置地面魔法，格子不可走或已有同种魔法时返回 false
+func (m *Map) spawnSpell(caster IMapObject, spell common.Spell, value int, location common.Point, duration, tick time.Duration, show bool) bool {
+	c := m.GetCell(location)
+	if c == nil || !c.CanWalk() {
+		return false
 	}
+	exists := false
+	c.Objects.Range(func(_, v interface{}) bool {
+		if s, ok := v.(*SpellObject); ok && s.Spell == spell {
+			exists = true
+			return false
+		}
+		return true
+	})
+	if exists {
+		return false
+	}
+	NewSpellObject(m, caster, spell, value, location, duration, tick, show).Spawned()
+	return true
 }
@@ -0,0 +1,201 @@
+package mir
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/yenkeia/mirgo/common"
+)
+
+// migration 数据库迁移，执行过的迁移名字记录在 migration 表中，只会执行一次
+type migration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+// 新的迁移只能加在最后，已经发布的迁移不能修改
+var migrations = []migration{
+	{"user_item_base_stats", migrateUserItemBaseStats},
+	{"user_item_awake", addColumns("user_item", "gem_count int default 0", "awake_type int default 0", "awake_level int default 0", "awake_value int default 0")},
+	{"npc_trade_log", execSQL(`CREATE TABLE npc_trade_log
+(
+	id integer
+		constraint npc_trade_log_pk
+			primary key autoincrement,
+	type int,
+	npc_name varchar(200),
+	map_id int,
+	character_id int,
+	item_id int,
+	count int,
+	gold_cost int,
+	pearl_cost int,
+	create_time int
+)`)},
+	{"account_credit", addColumns("account", "credit int default 0", "pearls int default 0")},
+	{"game_shop_log", execSQL(`CREATE TABLE game_shop_log
+(
+	id integer
+		constraint game_shop_log_pk
+			primary key autoincrement,
+	account_id int,
+	character_id int,
+	game_shop_item_id int,
+	count int,
+	credit_cost int,
+	gold_cost int,
+	create_time int
+)`)},
+	{"mail", execSQL(`CREATE TABLE mail
+(
+	id integer
+		constraint mail_pk
+			primary key autoincrement,
+	character_id int,
+	sender string,
+	message string,
+	item_id int,
+	count int,
+	gold int,
+	collected int default 0,
+	create_time int
+)`)},
+	{"friend", execSQL(`CREATE TABLE friend
+(
+	id integer
+		constraint friend_pk
+			primary key autoincrement,
+	character_id int,
+	friend_id int,
+	memo string,
+	blocked int default 0
+)`)},
+	{"character_expanded_storage", addColumns("character", "has_expanded_storage int default 0")},
+	{"item_exp_rate", migrateItemExpRate},
+	{"character_pet", execSQL(`CREATE TABLE character_pet
+(
+	id integer
+		constraint character_pet_pk
+			primary key autoincrement,
+	character_id int,
+	monster_id int,
+	hp int,
+	experience int,
+	level int,
+	max_level int
+)`)},
+}
+
+// InitMigrations 按顺序执行还没有执行过的数据库迁移，必须在 InitGameDB 之前
+func (e *Environ) InitMigrations() {
+	db := e.Game.DB
+	db.Exec("CREATE TABLE IF NOT EXISTS migration (name TEXT CONSTRAINT migration_pk PRIMARY KEY)")
+	for _, m := range migrations {
+		count := 0
+		db.Table("migration").Where("name = ?", m.name).Count(&count)
+		if count > 0 {
+			continue
+		}
+		tx := db.Begin()
+		if err := m.run(tx); err != nil {
+			tx.Rollback()
+			panic("数据库迁移 " + m.name + " 错误: " + err.Error())
+		}
+		if err := tx.Exec("INSERT INTO migration (name) VALUES (?)", m.name).Error; err != nil {
+			tx.Rollback()
+			panic("数据库迁移 " + m.name + " 错误: " + err.Error())
+		}
+		tx.Commit()
+		log.Infof("执行了数据库迁移 %s\n", m.name)
+	}
+}
+
+// execSQL 依次执行 sql 语句，用于建表
+func execSQL(sqls ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, sql := range sqls {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumns 给表添加字段，columns 为 "字段名 类型" 形式
+func addColumns(table string, columns ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, c := range columns {
+			if err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + c).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// hasCopiedBaseStats 旧版本创建物品时把 ItemInfo 的基础属性复制到了 UserItem 上
+func hasCopiedBaseStats(ui *common.UserItem, info *common.ItemInfo) bool {
+	if info.MinAC == 0 && info.MinMAC == 0 && info.MinDC == 0 && info.MinMC == 0 && info.MinSC == 0 &&
+		info.Accuracy == 0 && info.Agility == 0 && info.AttackSpeed == 0 && info.Luck == 0 {
+		return false
+	}
+	return ui.AC == info.MinAC && ui.MAC == info.MinMAC && ui.DC == info.MinDC &&
+		ui.MC == info.MinMC && ui.SC == info.MinSC && ui.Accuracy == info.Accuracy &&
+		ui.Agility == info.Agility && ui.AttackSpeed == info.AttackSpeed && ui.Luck == info.Luck
+}
+
+// migrateUserItemBaseStats 现在计算装备属性时会加上 ItemInfo 的基础属性，
+// 清除旧物品上复制的基础属性，避免重复计算
+func migrateUserItemBaseStats(tx *gorm.DB) error {
+	infos := make([]common.ItemInfo, 0)
+	if err := tx.Table("item").Find(&infos).Error; err != nil {
+		return err
+	}
+	infoMap := make(map[int32]*common.ItemInfo)
+	for i := range infos {
+		infoMap[infos[i].ID] = &infos[i]
+	}
+	items := make([]common.UserItem, 0)
+	if err := tx.Table("user_item").Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		ui := &items[i]
+		info := infoMap[ui.ItemID]
+		if info == nil || !hasCopiedBaseStats(ui, info) {
+			continue
+		}
+		err := tx.Table("user_item").Where("id = ?", ui.ID).Updates(map[string]interface{}{
+			"ac":           0,
+			"mac":          0,
+			"dc":           0,
+			"mc":           0,
+			"sc":           0,
+			"accuracy":     0,
+			"agility":      0,
+			"attack_speed": 0,
+			"luck":         0,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expRateItems 带经验加成的物品，数值来自物品说明
+var expRateItems = map[string]int{
+	"MysteriousStone[3d]": 30,
+}
+
+// migrateItemExpRate 物品表增加经验加成字段，并填入已有物品的经验加成
+func migrateItemExpRate(tx *gorm.DB) error {
+	if err := addColumns("item", "exp_rate int default 0")(tx); err != nil {
+		return err
+	}
+	for name, rate := range expRateItems {
+		if err := tx.Table("item").Where("name = ?", name).Update("exp_rate", rate).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package mir
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/yenkeia/mirgo/common"
+)
+
+// testDBFile 仓库里的开发数据库，迁移测试在它的副本上执行
+const testDBFile = "../dotnettools/mir.sqlite"
+
+func TestInitMigrations(t *testing.T) {
+	data, err := ioutil.ReadFile(testDBFile)
+	if err != nil {
+		t.Skip(err)
+	}
+	file := filepath.Join(t.TempDir(), "mir.sqlite")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("sqlite3", file)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer db.Close()
+
+	e := &Environ{Game: &Game{DB: db}}
+	e.InitMigrations()
+	// 再次执行时不会重复迁移
+	e.InitMigrations()
+
+	count := 0
+	db.Table("migration").Count(&count)
+	if count != len(migrations) {
+		t.Fatalf("migration count = %d", count)
+	}
+	if !db.Dialect().HasColumn("user_item", "awake_level") {
+		t.Error("user_item 缺少 awake_level")
+	}
+	if !db.Dialect().HasColumn("account", "pearls") {
+		t.Error("account 缺少 pearls")
+	}
+	if !db.Dialect().HasColumn("character", "has_expanded_storage") {
+		t.Error("character 缺少 has_expanded_storage")
+	}
+	info := common.ItemInfo{}
+	db.Table("item").Where("name = ?", "MysteriousStone[3d]").First(&info)
+	if info.ExpRate != 30 {
+		t.Errorf("MysteriousStone[3d] exp_rate = %d", info.ExpRate)
+	}
+	for _, table := range []string{"npc_trade_log", "game_shop_log", "mail", "friend", "character_pet"} {
+		if !db.HasTable(table) {
+			t.Errorf("缺少表 %s", table)
+		}
+	}
+}
+
+func TestMigrateUserItemBaseStats(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer db.Close()
+	db.DB().SetMaxOpenConns(1) // 内存数据库每个连接都是独立的
+	db.Table("user_item").CreateTable(&common.UserItem{})
+	db.Table("item").CreateTable(&common.ItemInfo{})
+	db.Table("item").Create(&common.ItemInfo{ID: 1, MinAC: 2, MaxAC: 5, Accuracy: 1})
+
+	old := common.UserItem{ID: 1, ItemID: 1, AC: 2, Accuracy: 1}
+	rolled := common.UserItem{ID: 2, ItemID: 1, AC: 3}
+	db.Table("user_item").Create(&old)
+	db.Table("user_item").Create(&rolled)
+
+	if err := migrateUserItemBaseStats(db); err != nil {
+		t.Fatal(err)
+	}
+
+	items := make([]common.UserItem, 0)
+	db.Table("user_item").Order("id").Find(&items)
+	if len(items) != 2 || items[0].AC != 0 || items[0].Accuracy != 0 || items[1].AC != 3 {
+		t.Fatalf("items = %+v", items)
+	}
+}
@@ -13,6 +13,11 @@ type IBehavior interface {
 	Process()
 }
 
+// IDeathBehavior 怪物死亡时还需要处理的行为，如分裂
+type IDeathBehavior interface {
+	OnDeath()
+}
+
 type BehaviroFactory func(id int, mon *Monster) IBehavior
 
 var behaviorFactory BehaviroFactory
@@ -21,14 +26,26 @@ func SetMonsterBehaviorFactory(fac BehaviroFactory) {
 	behaviorFactory = fac
 }
 
+// BehaviorLoader 加载怪物行为数据，在刷怪之前调用
+type BehaviorLoader func() error
+
+var behaviorLoader BehaviorLoader
+
+func SetMonsterBehaviorLoader(loader BehaviorLoader) {
+	behaviorLoader = loader
+}
+
 // Monster ...
 type Monster struct {
 	MapObject
+	Info        *common.MonsterInfo
 	Image       common.Monster
 	AI          int
 	Behavior    IBehavior
 	Effect      int
 	Poison      common.PoisonType
+	Undead      bool
+	CanTame     bool
 	Light       uint8
 	Target      IMapObject
 	Level       uint16
@@ -60,6 +77,19 @@ type Monster struct {
 	AttackTime  time.Time
 	DeadTime    time.Time
 	MoveTime    time.Time
+
+	HallucinationTime time.Time // 中了迷魂术，在此之前会攻击其它怪物
+	PetExperience     int       // 宠物经验
+	MaxPetLevel       uint16    // 宠物能升到的最高等级
+
+	// 行为树节点的状态保存在怪物上，重新加载行为树后不会丢失
+	Minions      []*Monster // 召唤出来的小怪
+	SummonTime   time.Time  // 下次可以召唤小怪的时间
+	TeleportTime time.Time  // 下次可以瞬移的时间
+	HealTime     time.Time  // 下次可以自我治疗的时间
+
+	path     []common.Point // 缓存的寻路结果
+	pathGoal common.Point   // 缓存路径的终点
 }
 
 func (m *Monster) String() string {
@@ -71,6 +101,7 @@ func NewMonster(mp *Map, p common.Point, mi *common.MonsterInfo) (m *Monster) {
 	m = new(Monster)
 	m.ID = mp.Env.NewObjectID()
 	m.Map = mp
+	m.Info = mi
 	m.Name = mi.Name
 	m.NameColor = common.Color{R: 255, G: 255, B: 255}
 	m.Image = common.Monster(mi.Image)
@@ -79,6 +110,8 @@ func NewMonster(mp *Map, p common.Point, mi *common.MonsterInfo) (m *Monster) {
 	m.Light = uint8(mi.Light)
 	m.Target = nil
 	m.Poison = common.PoisonTypeNone
+	m.Undead = mi.Undead != 0
+	m.CanTame = mi.CanTame != 0
 	m.CurrentLocation = p
 	m.CurrentDirection = RandomDirection()
 	m.Dead = false
@@ -137,6 +170,9 @@ func (m *Monster) GetDirection() common.MirDirection {
 }
 
 func (m *Monster) GetInfo() interface{} {
+	if m.Name == CloneName && m.Master != nil {
+		return m.cloneInfo()
+	}
 	res := &server.ObjectMonster{
 		ObjectID:          m.ID,
 		Name:              m.Name,
@@ -176,9 +212,44 @@ func (m *Monster) GetBaseStats() BaseStats {
 	}
 }
 
-func (m *Monster) AddBuff(buff *Buff) {}
+// AddBuff 怪物增益效果，同类型的会被替换
+func (m *Monster) AddBuff(buff *Buff) {
+	if m.IsDead() {
+		return
+	}
+	for i := range m.Buffs {
+		if m.Buffs[i].BuffType == buff.BuffType {
+			m.applyBuff(m.Buffs[i], -1)
+			m.Buffs[i] = buff
+			m.applyBuff(buff, 1)
+			return
+		}
+	}
+	m.Buffs = append(m.Buffs, buff)
+	m.applyBuff(buff, 1)
+}
 
-func (m *Monster) ApplyPoison(poison *Poison, caster IMapObject) {}
+// applyBuff 加上(sign 为 1)或去掉(sign 为 -1)增益效果对属性的影响
+func (m *Monster) applyBuff(buff *Buff, sign int) {
+	v := buff.Values * sign
+	switch buff.BuffType {
+	case common.BuffTypePetEnhancer:
+		m.MinDC = addUint16(m.MinDC, v)
+		m.MaxDC = addUint16(m.MaxDC, v)
+		m.MinAC = addUint16(m.MinAC, v)
+		m.MaxAC = addUint16(m.MaxAC, v)
+	}
+}
+
+// ApplyPoison 怪物中毒
+func (m *Monster) ApplyPoison(poison *Poison, caster IMapObject) {
+	if m.IsDead() {
+		return
+	}
+	m.addPoison(poison)
+	m.Poison = m.CurrentPoison()
+	m.Broadcast(&server.ObjectPoisoned{ObjectID: m.GetID(), Poison: m.Poison})
+}
 
 func (m *Monster) Broadcast(msg interface{}) {
 	m.Map.BroadcastP(m.CurrentLocation, msg, nil)
@@ -189,6 +260,7 @@ func (m *Monster) Spawn(mp *Map, p common.Point) {
 	m.Map = mp
 	m.CurrentLocation = p
 	mp.AddObject(m)
+	m.Broadcast(m.GetInfo())
 }
 
 func (m *Monster) BroadcastDamageIndicator(typ common.DamageType, dmg int) {
@@ -200,7 +272,7 @@ func (m *Monster) IsDead() bool {
 }
 
 func (m *Monster) IsUndead() bool {
-	return false
+	return m.Undead
 }
 
 func (m *Monster) IsBlocking() bool {
@@ -216,9 +288,19 @@ func (m *Monster) IsHidden() bool {
 }
 
 func (m *Monster) IsAttackTargetMonster(attacker *Monster) bool {
-	if attacker == m {
+	if attacker == m || m.IsDead() {
 		return false
 	}
+	// 宠物和野怪互相攻击，不同玩家的宠物按主人的攻击模式
+	if m.Master != nil || attacker.Master != nil {
+		switch {
+		case m.Master == attacker.Master:
+			return false
+		case m.Master == nil, attacker.Master == nil:
+			return true
+		}
+		return m.Master.IsAttackTarget(attacker.Master)
+	}
 
 	if m.AI == 6 || m.AI == 58 {
 		return false
@@ -242,11 +324,23 @@ func (m *Monster) IsAttackTarget(attacker IMapObject) bool {
 	case *Monster:
 		return m.IsAttackTargetMonster(attacker.(*Monster))
 	case *Player:
+		// 不能攻击自己的宠物，和平模式不能攻击别人的宠物
+		if m.Master != nil {
+			p := attacker.(*Player)
+			return m.Master != p && p.AMode != common.AttackModePeace
+		}
 	}
 	return true
 }
 
+// IsFriendlyTarget 宠物是主人和主人友方的友方目标
 func (m *Monster) IsFriendlyTarget(attacker IMapObject) bool {
+	if m.Master == nil {
+		return false
+	}
+	if p, ok := attacker.(*Player); ok {
+		return m.Master == p || m.Master.IsFriendlyTarget(p)
+	}
 	return false
 }
 
@@ -255,12 +349,12 @@ func (m *Monster) AttackMode() common.AttackMode {
 }
 
 func (m *Monster) CanMove() bool {
-	return time.Now().After(m.MoveTime)
+	return time.Now().After(m.MoveTime) && !m.IsParalysed()
 }
 
 func (m *Monster) CanAttack() bool {
 	now := time.Now()
-	if m.IsDead() {
+	if m.IsDead() || m.IsParalysed() {
 		return false
 	}
 	return now.After(m.AttackTime)
@@ -276,7 +370,7 @@ func (m *Monster) InAttackRange() bool {
 func (m *Monster) Process() {
 	if m.Target != nil &&
 		//m.Target.GetMap() != m.Map ||
-		(!m.Target.IsAttackTarget(m) || !InRange(m.CurrentLocation, m.Target.GetPoint(), DataRange)) {
+		(!m.canTarget(m.Target) || !InRange(m.CurrentLocation, m.Target.GetPoint(), DataRange)) {
 		m.Target = nil
 	}
 
@@ -288,7 +382,13 @@ func (m *Monster) Process() {
 		return
 	}
 
-	m.Behavior.Process()
+	if m.Master != nil {
+		if !m.IsDead() {
+			m.petProcess()
+		}
+	} else {
+		m.Behavior.Process()
+	}
 
 	m.ProcessBuffs()
 	m.ProcessRegan()
@@ -312,9 +412,42 @@ func (m *Monster) Process() {
 	}
 }
 
-// ProcessBuffs 处理怪物增益效果
+// ProcessBuffs 移除过期的增益效果
 func (m *Monster) ProcessBuffs() {
+	now := time.Now()
+	buffs := m.Buffs[:0]
+	for _, b := range m.Buffs {
+		if b.Infinite || now.Before(b.ExpireTime) {
+			buffs = append(buffs, b)
+			continue
+		}
+		m.applyBuff(b, -1)
+	}
+	m.Buffs = buffs
+}
+
+// IsHallucinating 是否中了迷魂术
+func (m *Monster) IsHallucinating() bool {
+	return time.Now().Before(m.HallucinationTime)
+}
+
+// canTarget 能否攻击 o，中了迷魂术的怪物可以攻击其它怪物
+func (m *Monster) canTarget(o IMapObject) bool {
+	if !m.canSee(o) {
+		return false
+	}
+	if m.IsHallucinating() && o != m && o.GetRace() == common.ObjectTypeMonster {
+		return !o.IsDead()
+	}
+	return o.IsAttackTarget(m)
+}
 
+// canSee 隐身的目标只有等级不低于它的 CoolEye 怪物能看到
+func (m *Monster) canSee(o IMapObject) bool {
+	if p, ok := o.(*Player); !ok || !p.IsHidden() {
+		return true
+	}
+	return m.Info != nil && m.Info.CoolEye > 0 && int(m.Level) >= objectLevel(o)
 }
 
 // ProcessRegan 怪物自身回血
@@ -324,7 +457,20 @@ func (m *Monster) ProcessRegan() {
 
 // ProcessPoison 处理怪物中毒效果
 func (m *Monster) ProcessPoison() {
-
+	if m.IsDead() || len(m.Poisons) == 0 {
+		return
+	}
+	damage, owner, changed := m.tickPoisons(time.Now())
+	if changed {
+		m.Poison = m.CurrentPoison()
+		m.Broadcast(&server.ObjectPoisoned{ObjectID: m.GetID(), Poison: m.Poison})
+	}
+	if damage > 0 {
+		if p, ok := owner.(*Player); ok && m.EXPOwner == nil {
+			m.EXPOwner = p
+		}
+		m.ChangeHP(-damage)
+	}
 }
 
 // GetDefencePower 获取防御值
@@ -361,6 +507,14 @@ func (m *Monster) Die() {
 	m.DeadTime = time.Now().Add(5 * time.Second)
 
 	m.Broadcast(ServerMessage{}.ObjectDied(m.GetID(), m.GetDirection(), m.GetPoint()))
+	// 宠物死亡不给经验也不掉落
+	if m.Master != nil {
+		m.Master.RemovePet(m)
+		return
+	}
+	if b, ok := m.Behavior.(IDeathBehavior); ok {
+		b.OnDeath()
+	}
 	// EXPOwner.WinExp(Experience, Level);
 
 	if m.EXPOwner != nil && m.Master == nil && m.EXPOwner.GetRace() == common.ObjectTypePlayer {
@@ -393,17 +547,33 @@ func (m *Monster) ChangeHP(amount int) {
 	m.Broadcast(ServerMessage{}.ObjectHealth(m.GetID(), percent, 5))
 }
 
-// Attacked 被攻击
-func (m *Monster) Attacked(attacker IMapObject, damage int, defenceType common.DefenceType, damageWeapon bool) {
+// Attacked 被攻击，返回造成的伤害
+func (m *Monster) Attacked(attacker IMapObject, damage int, defenceType common.DefenceType, damageWeapon bool) int {
 	if m.Target == nil && attacker.IsAttackTarget(m) {
 		m.Target = attacker
 	}
+	// 击杀经验算在玩家身上，宠物打的算主人的
+	var pet *Monster
+	switch t := attacker.(type) {
+	case *Player:
+		if m.EXPOwner == nil {
+			m.EXPOwner = t
+		}
+		t.petsTarget(m)
+	case *Monster:
+		if t.Master != nil {
+			pet = t
+			if m.EXPOwner == nil {
+				m.EXPOwner = t.Master
+			}
+		}
+	}
 	armor := 0
 	switch defenceType {
 	case common.DefenceTypeACAgility:
 		if RandomInt(0, int(m.Agility)) > int(attacker.GetBaseStats().Accuracy) {
 			m.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
-			return
+			return 0
 		}
 		armor = m.GetDefencePower(int(m.MinAC), int(m.MaxAC))
 	case common.DefenceTypeAC:
@@ -411,7 +581,7 @@ func (m *Monster) Attacked(attacker IMapObject, damage int, defenceType common.D
 	case common.DefenceTypeMACAgility:
 		if RandomInt(0, int(m.Agility)) > int(attacker.GetBaseStats().Accuracy) {
 			m.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
-			return
+			return 0
 		}
 		armor = m.GetDefencePower(int(m.MinMAC), int(m.MaxMAC))
 	case common.DefenceTypeMAC:
@@ -419,22 +589,29 @@ func (m *Monster) Attacked(attacker IMapObject, damage int, defenceType common.D
 	case common.DefenceTypeAgility:
 		if RandomInt(0, int(m.Agility)) > int(attacker.GetBaseStats().Accuracy) {
 			m.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
-			return
+			return 0
 		}
 	}
+	if p, ok := attacker.(*Player); ok && damageWeapon {
+		p.DamageWeapon()
+	}
 	armor = int(float32(armor) * m.ArmourRate)
 	damage = int(float32(damage) * m.DamageRate)
 	value := damage - armor
 	log.Debugf("attacker damage: %d, monster armor: %d\n", damage, armor)
 	if value <= 0 {
 		m.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
-		return
+		return 0
 	}
 	// TODO 还有很多没做
 	m.Broadcast(ServerMessage{}.ObjectStruck(m, attacker.GetID()))
 	m.BroadcastDamageIndicator(common.DamageTypeHit, value)
 	m.ChangeHP(-value)
+	if pet != nil && m.IsDead() {
+		pet.PetExp(int(m.Experience))
+	}
 	log.Debugf("!!!attacker damage: %d, monster armor: %d\n", damage, armor)
+	return value
 }
 
 // Drop 怪物掉落物品
@@ -471,7 +648,7 @@ func (m *Monster) Drop() {
 				Map: m.Map,
 			},
 			Gold:     0,
-			UserItem: m.Map.Env.NewUserItem(info),
+			UserItem: m.Map.Env.NewDropUserItem(info),
 		})
 	}
 	for i := range mapItems {
@@ -518,6 +695,9 @@ func (m *Monster) Walk(dir common.MirDirection) bool {
 	m.WalkNotify(oldpos, destcell.Point)
 
 	m.MoveTime = m.MoveTime.Add(time.Duration(int64(m.MoveSpeed)) * time.Millisecond)
+	if m.CurrentPoison()&common.PoisonTypeSlow != 0 {
+		m.MoveTime = m.MoveTime.Add(time.Duration(int64(m.MoveSpeed)) * time.Millisecond)
+	}
 
 	m.Broadcast(&server.ObjectWalk{
 		ObjectID:  m.GetID(),
@@ -525,6 +705,8 @@ func (m *Monster) Walk(dir common.MirDirection) bool {
 		Location:  dest,
 	})
 
+	processSpells(m)
+
 	return true
 }
 
@@ -568,16 +750,7 @@ func (m *Monster) Turn(dir common.MirDirection) {
 	// TODO:
 	// InSafeZone = CurrentMap.GetSafeZone(CurrentLocation) != null
 
-	// Cell cell = CurrentMap.GetCell(CurrentLocation);
-	// for (int i = 0; i < cell.Objects.Count; i++)
-	// {
-	//     if (cell.Objects[i].Race != ObjectType.Spell) continue;
-	//     SpellObject ob = (SpellObject)cell.Objects[i];
-
-	//     ob.ProcessSpell(this);
-	//     //break;
-	// }
-
+	processSpells(m)
 }
 
 func ObjectBack(m IMapObject) common.Point {
@@ -631,10 +804,11 @@ func (m *Monster) GuardAttack() {
 	}
 }
 
-func (m *Monster) Attack() {
-	if !m.Target.IsAttackTarget(m) {
+// Attack 近身攻击当前目标，返回造成的伤害
+func (m *Monster) Attack() int {
+	if !m.canTarget(m.Target) {
 		m.Target = nil
-		return
+		return 0
 	}
 	m.CurrentDirection = DirectionFromPoint(m.CurrentLocation, m.Target.GetPoint())
 	m.Broadcast(ServerMessage{}.ObjectAttack(m, common.SpellNone, 0, 0))
@@ -643,14 +817,9 @@ func (m *Monster) Attack() {
 	m.AttackTime = now.Add(time.Duration(m.AttackSpeed) * time.Millisecond)
 	damage := m.GetAttackPower(int(m.MinDC), int(m.MaxDC))
 	if damage <= 0 {
-		return
-	}
-	switch m.Target.GetRace() {
-	case common.ObjectTypePlayer:
-		m.Target.(*Player).Attacked(m, damage, common.DefenceTypeAgility, false)
-	case common.ObjectTypeMonster:
-		m.Target.(*Monster).Attacked(m, damage, common.DefenceTypeAgility, false)
+		return 0
 	}
+	return attackObject(m.Target, m, damage, common.DefenceTypeAgility, false)
 }
 
 func (m *Monster) MoveTo(location common.Point) {
@@ -676,6 +845,9 @@ func (m *Monster) MoveTo(location common.Point) {
 			return
 		}
 	}
+	if m.walkPath(location) {
+		return
+	}
 	dir := DirectionFromPoint(m.CurrentLocation, location)
 	if m.Walk(dir) {
 		return
@@ -708,21 +880,17 @@ func (m *Monster) FindTarget() {
 
 		switch o.GetRace() {
 		case common.ObjectTypeMonster:
-			if !o.IsAttackTarget(m) {
+			if !m.canTarget(o) {
 				return true
 			}
-			// if (ob.Hidden && (!CoolEye || Level < ob.Level)) continue;
 			m.Target = o
 
 		case common.ObjectTypePlayer:
 
-			if !o.IsAttackTarget(m) { // continue
+			if !o.IsAttackTarget(m) || m.IsHallucinating() || !m.canSee(o) { // continue
 				return true
 			}
 
-			// TODO:
-			// if (playerob.GMGameMaster || ob.Hidden && (!CoolEye || Level < ob.Level) || Envir.Time < HallucinationTime) continue;
-
 			m.Target = o
 
 			return false
@@ -747,8 +915,3 @@ func (m *Monster) CheckStacked() bool {
 
 	return false
 }
-
-// PetRecall 宠物传送回玩家身边
-func (m *Monster) PetRecall(...interface{}) {
-	log.Debugln("PetRecall", m.GetID())
-}
@@ -0,0 +1,155 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// ProjectileSpeed 怪物远程攻击每飞行一格需要的毫秒数
+const ProjectileSpeed = 50
+
+// attackPower 物理攻击用 DC，魔法攻击用 MC
+func (m *Monster) attackPower(magic bool) (int, common.DefenceType) {
+	if magic {
+		return m.GetAttackPower(int(m.MinMC), int(m.MaxMC)), common.DefenceTypeMACAgility
+	}
+	return m.GetAttackPower(int(m.MinDC), int(m.MaxDC)), common.DefenceTypeACAgility
+}
+
+// delayAction 延迟 delay 之后执行 fn
+func (m *Monster) delayAction(typ DelayedType, delay time.Duration, fn func(...interface{}), args ...interface{}) {
+	action := NewDelayedAction(m.Map.Env.NewObjectID(), typ, NewTask(fn, args...))
+	action.ActionTime = time.Now().Add(delay)
+	m.ActionList.Store(action.ID, action)
+}
+
+// rangeAttackStart 转向目标并广播远程攻击，返回目标位置和飞行时间
+func (m *Monster) rangeAttackStart(target IMapObject) (common.Point, time.Duration) {
+	location := target.GetPoint()
+	m.CurrentDirection = DirectionFromPoint(m.CurrentLocation, location)
+	m.Broadcast(&server.ObjectRangeAttack{
+		ObjectID:  m.GetID(),
+		Location:  m.CurrentLocation,
+		Direction: m.CurrentDirection,
+		TargetID:  target.GetID(),
+		Target:    location,
+		Type:      uint8(m.Effect),
+	})
+	m.AttackTime = time.Now().Add(time.Duration(m.AttackSpeed) * time.Millisecond)
+	return location, time.Duration(rangeDistance(m.CurrentLocation, location)*ProjectileSpeed) * time.Millisecond
+}
+
+// RangeAttack 远程攻击当前目标，弓箭或法术飞到目标后造成伤害，magic 为 true 时为魔法攻击
+func (m *Monster) RangeAttack(magic bool) {
+	if !m.canTarget(m.Target) {
+		m.Target = nil
+		return
+	}
+	target := m.Target
+	_, delay := m.rangeAttackStart(target)
+	damage, defence := m.attackPower(magic)
+	if damage <= 0 {
+		return
+	}
+	m.delayAction(DelayedTypeRangeDamage, delay, func(...interface{}) {
+		if !m.IsDead() && !target.IsDead() && target.IsAttackTarget(m) {
+			attackObject(target, m, damage, defence, false)
+		}
+	})
+}
+
+// AreaAttack 对目标周围 radius 格内所有可攻击的对象施放魔法
+func (m *Monster) AreaAttack(radius int) {
+	if !m.canTarget(m.Target) {
+		m.Target = nil
+		return
+	}
+	location, delay := m.rangeAttackStart(m.Target)
+	damage, defence := m.attackPower(true)
+	if damage <= 0 {
+		return
+	}
+	m.delayAction(DelayedTypeRangeDamage, delay, func(...interface{}) {
+		if m.IsDead() {
+			return
+		}
+		targets := make([]IMapObject, 0)
+		m.Map.RangeObject(location, radius, func(o IMapObject) bool {
+			switch o.GetRace() {
+			case common.ObjectTypePlayer, common.ObjectTypeMonster:
+				if o != IMapObject(m) && !o.IsDead() && o.IsAttackTarget(m) {
+					targets = append(targets, o)
+				}
+			}
+			return true
+		})
+		for _, o := range targets {
+			attackObject(o, m, damage, defence, false)
+		}
+	})
+}
+
+// PoisonTarget 使目标中毒，value 为每次的伤害
+func (m *Monster) PoisonTarget(target IMapObject, typ common.PoisonType, value int, tick time.Duration, tickNum int) {
+	if target == nil || target.IsDead() {
+		return
+	}
+	target.ApplyPoison(NewPoison(m.Map.Env.NewObjectID(), m, value, typ, tick, tickNum), m)
+}
+
+// Heal 怪物恢复血量
+func (m *Monster) Heal(amount int) bool {
+	if m.IsDead() || m.HP >= m.MaxHP || amount <= 0 {
+		return false
+	}
+	if m.HP+uint32(amount) > m.MaxHP {
+		amount = int(m.MaxHP - m.HP)
+	}
+	m.ChangeHP(amount)
+	m.Broadcast(&server.ObjectEffect{ObjectID: m.GetID(), Effect: common.SpellEffectHealing})
+	return true
+}
+
+// TeleportTo 怪物在当前地图内瞬移，和走路一样直接换格子，缓存的路径作废
+func (m *Monster) TeleportTo(location common.Point) {
+	dest := m.Map.GetCell(location)
+	if dest == nil {
+		return
+	}
+	m.Broadcast(&server.ObjectTeleportOut{ObjectID: m.GetID()})
+	oldpos := m.CurrentLocation
+	m.Map.GetCell(oldpos).DeleteObject(m)
+	dest.AddObject(m)
+	m.CurrentLocation = location
+	m.path = nil
+	m.pathGoal = common.Point{}
+	m.WalkNotify(oldpos, location)
+	m.Broadcast(m.GetInfo())
+	m.Broadcast(&server.ObjectTeleportIn{ObjectID: m.GetID()})
+	processSpells(m)
+}
+
+// SpawnNear 在怪物周围 spread 格内生成 count 个名字为 name 的怪物，生成的怪物攻击同一个目标
+func (m *Monster) SpawnNear(name string, count int, spread int) []*Monster {
+	mi := m.Map.Env.GameDB.GetMonsterInfoByName(name)
+	if mi == nil {
+		log.Warnf("生成怪物失败，找不到怪物 %s\n", name)
+		return nil
+	}
+	res := make([]*Monster, 0, count)
+	for i := 0; i < count; i++ {
+		pt, err := m.Map.GetValidPoint(int(m.CurrentLocation.X), int(m.CurrentLocation.Y), spread)
+		if err != nil {
+			break
+		}
+		mon := NewMonster(m.Map, pt, mi)
+		if m.Target != nil && mon.canTarget(m.Target) {
+			mon.Target = m.Target
+		}
+		mon.Spawn(m.Map, pt)
+		res = append(res, mon)
+	}
+	return res
+}
@@ -52,6 +52,19 @@ func (ServerMessage) MapInformation(info *common.MapInfo) *server.MapInformation
 	return mi
 }
 
+func (ServerMessage) MapChanged(info *common.MapInfo, location common.Point, direction common.MirDirection) *server.MapChanged {
+	return &server.MapChanged{
+		FileName:  info.Filename,
+		Title:     info.Title,
+		MiniMap:   uint16(info.MiniMap),
+		BigMap:    uint16(info.BigMap),
+		Music:     uint16(info.Music),
+		Lights:    common.LightSetting(info.Light),
+		Location:  location,
+		Direction: direction,
+	}
+}
+
 func (ServerMessage) StartGame(result, resolution int) *server.StartGame {
 	/*
 	 * 0: Disabled.
@@ -82,15 +95,15 @@ func (ServerMessage) UserInformation(p *Player) *server.UserInformation {
 	ui.Hair = p.Hair
 	ui.HP = p.HP
 	ui.MP = p.MP
-	ui.Experience = p.Experience             // TODO
-	ui.MaxExperience = 100                   // TODO
+	ui.Experience = p.Experience
+	ui.MaxExperience = p.MaxExperience
 	ui.LevelEffect = common.LevelEffectsNone // TODO
 	ui.Gold = uint32(p.Gold)
-	ui.Credit = 100 // TODO
+	ui.Credit = p.Credit
 	ui.Inventory = p.Inventory
 	ui.Equipment = p.Equipment
 	ui.QuestInventory = p.QuestInventory
-	ui.HasExpandedStorage = false    // TODO
+	ui.HasExpandedStorage = p.HasExpandedStorage
 	ui.ExpandedStorageExpiryTime = 0 // TODO
 	ui.ClientMagics = p.GetClientMagics()
 	return ui
@@ -234,8 +247,8 @@ func (m ServerMessage) Object(obj IMapObject) interface{} {
 	switch obj.GetRace() {
 	case common.ObjectTypePlayer:
 		return m.ObjectPlayer(obj)
-	case common.ObjectTypeMonster:
-		return m.ObjectMonster(obj)
+	case common.ObjectTypeMonster: // 分身显示为玩家
+		return obj.GetInfo()
 	case common.ObjectTypeMerchant:
 		return m.ObjectNPC(obj)
 	case common.ObjectTypeItem:
@@ -245,6 +258,8 @@ func (m ServerMessage) Object(obj IMapObject) interface{} {
 		} else {
 			return m.ObjectItem(item)
 		}
+	case common.ObjectTypeSpell:
+		return obj.GetInfo()
 	default:
 		panic("unknown object")
 	}
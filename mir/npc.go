@@ -2,6 +2,8 @@ package mir
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yenkeia/mirgo/common"
@@ -17,8 +19,20 @@ type NPC struct {
 	TurnTime time.Time
 	Script   *script.Script
 	Goods    []common.UserItem
+	Crafts   []common.UserItem            // 可合成的物品
+	Rate     float32                      // 价格倍率
+	BuyBack  map[string][]common.UserItem // key: 玩家名, value: 卖给 NPC 的物品，可以回购
+	StockMax map[uint64]uint32            // key: Goods UserItem.ID, value: [Trade] 中配置的库存，没有配置的商品不限量
+	// 下次补货时间
+	RestockTime time.Time
 }
 
+// NPCRestockDuration NPC 限量商品补货间隔
+const NPCRestockDuration = time.Hour
+
+// GoodsBuyBackMaxStored 每个玩家可回购物品数量上限
+const GoodsBuyBackMaxStored = 20
+
 func NewNPC(m *Map, ni *common.NpcInfo) *NPC {
 	sc, err := script.LoadFile(setting.Conf.NPCDirPath + ni.Filename + ".txt")
 	if err != nil {
@@ -33,11 +47,16 @@ func NewNPC(m *Map, ni *common.NpcInfo) *NPC {
 			CurrentLocation:  common.NewPoint(ni.LocationX, ni.LocationY),
 			CurrentDirection: common.MirDirection(RandomInt(0, 1)),
 		},
-		Image:    ni.Image,
-		Light:    0, // TODO
-		TurnTime: time.Now(),
-		Script:   sc,
-		Goods:    make([]common.UserItem, 0),
+		Image:       ni.Image,
+		Light:       0, // TODO
+		TurnTime:    time.Now(),
+		Script:      sc,
+		Goods:       make([]common.UserItem, 0),
+		Crafts:      make([]common.UserItem, 0),
+		Rate:        float32(ni.Rate) / 100,
+		BuyBack:     make(map[string][]common.UserItem),
+		StockMax:    make(map[uint64]uint32),
+		RestockTime: time.Now().Add(NPCRestockDuration),
 	}
 }
 
@@ -129,6 +148,10 @@ func (n *NPC) Broadcast(msg interface{}) {
 }
 
 func (n *NPC) Process() {
+	if n.RestockTime.Before(time.Now()) {
+		n.RestockTime = time.Now().Add(NPCRestockDuration)
+		n.Restock()
+	}
 	if n.TurnTime.Before(time.Now()) {
 		n.TurnTime = time.Now().Add(time.Second * time.Duration(RandomInt(20, 60)))
 		n.CurrentDirection = common.MirDirection(RandomInt(0, 1))
@@ -146,18 +169,164 @@ func (n *NPC) GetUserItemByID(id uint64) (item *common.UserItem) {
 	return nil
 }
 
-// Buy 玩家向 NPC 购买物品
+// GetCraftItemByID 获取 NPC 可合成的物品
+func (n *NPC) GetCraftItemByID(id uint64) (item *common.UserItem) {
+	for i := range n.Crafts {
+		if n.Crafts[i].ID == id {
+			return &n.Crafts[i]
+		}
+	}
+	return nil
+}
+
+// HasType NPC 是否收购/修理该类型的物品，由脚本 [Types] 决定
+func (n *NPC) HasType(typ common.ItemType) bool {
+	if n.Script == nil {
+		return false
+	}
+	for _, t := range n.Script.Types {
+		if common.ItemType(t) == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Sell 玩家卖给 NPC 的物品加入该玩家的回购列表
+func (n *NPC) Sell(p *Player, item common.UserItem) {
+	list := append(n.BuyBack[p.Name], item)
+	if len(list) > GoodsBuyBackMaxStored {
+		list = list[len(list)-GoodsBuyBackMaxStored:]
+	}
+	n.BuyBack[p.Name] = list
+}
+
+// GetBuyBackItemByID 获取玩家回购列表中的物品索引
+func (n *NPC) GetBuyBackItemByID(p *Player, id uint64) int {
+	for i, item := range n.BuyBack[p.Name] {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// InitGoods 根据脚本 [Trade] 初始化商品，"物品名 数量" 表示限量商品
+func (n *NPC) InitGoods() {
+	if len(n.Goods) != 0 || n.Script == nil {
+		return
+	}
+	env := n.Map.Env
+	for _, line := range n.Script.Goods {
+		res := strings.Fields(line)
+		if len(res) == 0 {
+			continue
+		}
+		name := res[0]
+		item := env.GameDB.GetItemInfoByName(name)
+		if item == nil {
+			log.Warnf("Good name err: %s\n", name)
+			continue
+		}
+		g := env.NewUserItem(item)
+		if len(res) == 2 {
+			c, err := strconv.Atoi(res[1])
+			if err != nil || c <= 0 {
+				log.Warnf("Good count err: %s\n", line)
+				continue
+			}
+			g.Count = uint32(c)
+			n.StockMax[g.ID] = g.Count
+		}
+		n.Goods = append(n.Goods, *g)
+	}
+}
+
+// Restock 限量商品补货
+func (n *NPC) Restock() {
+	for i := range n.Goods {
+		goods := &n.Goods[i]
+		max, ok := n.StockMax[goods.ID]
+		if !ok || goods.Count >= max {
+			continue
+		}
+		n.tradeLog(&common.NPCTradeLog{
+			Type:   common.NPCTradeTypeRestock,
+			ItemID: int(goods.ItemID),
+			Count:  int(max - goods.Count),
+		})
+		goods.Count = max
+	}
+}
+
+// tradeLog 把 NPC 交易和补货记录保存到 npc_trade_log
+func (n *NPC) tradeLog(l *common.NPCTradeLog) {
+	l.NPCName = n.Name
+	l.MapID = n.Map.Info.ID
+	l.CreateTime = time.Now().Unix()
+	n.Map.Env.Game.DB.Table("npc_trade_log").Create(l)
+}
+
+// Buy 玩家向 NPC 购买物品，扣除金币和库存
 func (n *NPC) Buy(p *Player, userItemID uint64, count uint32) {
 	env := n.Map.Env
-	userItem := n.GetUserItemByID(userItemID)
-	if userItem == nil {
+	goods := n.GetUserItemByID(userItemID)
+	if goods == nil || count == 0 {
 		return
 	}
-	itemInfo := env.GameDB.GetItemInfoByID(int(userItem.ItemID))
+	itemInfo := env.GameDB.GetItemInfoByID(int(goods.ItemID))
 	if itemInfo == nil {
 		return
 	}
-	ui := env.NewUserItem(itemInfo)
+	stackSize := itemInfo.StackSize
+	if stackSize == 0 {
+		stackSize = 1
+	}
+	if count > stackSize {
+		p.ReceiveChat(fmt.Sprintf("%s 一次最多购买 %d 个", itemInfo.Name, stackSize), common.ChatTypeSystem)
+		return
+	}
+	_, limited := n.StockMax[goods.ID]
+	if limited && goods.Count < count {
+		p.ReceiveChat(fmt.Sprintf("%s 库存不足", itemInfo.Name), common.ChatTypeSystem)
+		return
+	}
+	price := uint64(float32(itemInfo.Price)*n.Rate) * uint64(count)
+	if p.UsePearls {
+		price = uint64(itemInfo.Price) * uint64(count)
+		if uint64(p.Pearls) < price {
+			p.ReceiveChat("珍珠不足", common.ChatTypeSystem)
+			return
+		}
+	} else if p.Gold < price {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	ui := env.NewRandomUserItem(itemInfo)
 	ui.Count = count
+	if !p.CanGainItem(ui) {
+		p.ReceiveChat("背包已满或负重不足", common.ChatTypeSystem)
+		return
+	}
+	record := &common.NPCTradeLog{
+		Type:        common.NPCTradeTypeBuy,
+		CharacterID: int(p.ID),
+		ItemID:      int(itemInfo.ID),
+		Count:       int(count),
+	}
+	currency := "金币"
+	if p.UsePearls {
+		currency = "珍珠"
+		record.PearlCost = int(price)
+		p.TakePearls(uint32(price))
+	} else {
+		record.GoldCost = int(price)
+		p.TakeGold(price)
+	}
 	p.GainItem(ui)
+	if limited {
+		goods.Count -= count
+	}
+	n.tradeLog(record)
+	log.Infof("NPC 交易: 玩家 %s 在 %s 购买 %s x%d, 花费 %d %s\n", p.Name, n.Name, itemInfo.Name, count, price, currency)
 }
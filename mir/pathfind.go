@@ -0,0 +1,155 @@
+package mir
+
+import (
+	"container/heap"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+// MaxPathSearch 一次寻路最多展开的格子数，超过后返回离目标最近的路径
+const MaxPathSearch = 1500
+
+type pathNode struct {
+	point  common.Point
+	g, h   int // g 为起点到这里的步数，h 为到终点的估计步数
+	parent *pathNode
+	index  int // 在 openList 中的位置，-1 表示已经关闭
+}
+
+type openList []*pathNode
+
+func (l openList) Len() int { return len(l) }
+
+func (l openList) Less(i, j int) bool {
+	fi, fj := l[i].g+l[i].h, l[j].g+l[j].h
+	if fi != fj {
+		return fi < fj
+	}
+	return l[i].h < l[j].h
+}
+
+func (l openList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+	l[i].index = i
+	l[j].index = j
+}
+
+func (l *openList) Push(x interface{}) {
+	n := x.(*pathNode)
+	n.index = len(*l)
+	*l = append(*l, n)
+}
+
+func (l *openList) Pop() interface{} {
+	old := *l
+	n := old[len(old)-1]
+	*l = old[:len(old)-1]
+	n.index = -1
+	return n
+}
+
+// pathDistance 八方向移动时两点之间的步数
+func pathDistance(a, b common.Point) int {
+	dx := AbsInt(int(a.X) - int(b.X))
+	dy := AbsInt(int(a.Y) - int(b.Y))
+	if dx > dy {
+		return dx
+	}
+	return dy
+}
+
+// FindPath A* 寻路，返回从 from 走到 to 经过的点(不含起点)
+// blocked 判断格子是否被占据，终点不检查，maxSearch 为最多展开的格子数
+// 找不到完整路径时返回走到离终点最近的位置的路径，found 为 false
+func (m *Map) FindPath(from, to common.Point, maxSearch int, blocked func(*Cell) bool) (path []common.Point, found bool) {
+	if from.Equal(to) {
+		return nil, true
+	}
+	start := &pathNode{point: from, h: pathDistance(from, to)}
+	nodes := map[int]*pathNode{int(from.X) + int(from.Y)*m.Width: start}
+	open := &openList{}
+	heap.Push(open, start)
+	best := start
+	for searched := 0; open.Len() > 0 && searched < maxSearch; searched++ {
+		cur := heap.Pop(open).(*pathNode)
+		if cur.point.Equal(to) {
+			return buildPath(cur), true
+		}
+		if cur.h < best.h || (cur.h == best.h && cur.g < best.g) {
+			best = cur
+		}
+		for d := 0; d < 8; d++ {
+			p := cur.point.NextPoint(common.MirDirection(d), 1)
+			c := m.GetCell(p)
+			if c == nil || !c.CanWalk() || (!p.Equal(to) && blocked != nil && blocked(c)) {
+				continue
+			}
+			key := int(p.X) + int(p.Y)*m.Width
+			n, ok := nodes[key]
+			if !ok {
+				n = &pathNode{point: p, g: cur.g + 1, h: pathDistance(p, to), parent: cur}
+				nodes[key] = n
+				heap.Push(open, n)
+				continue
+			}
+			if n.index >= 0 && cur.g+1 < n.g {
+				n.g = cur.g + 1
+				n.parent = cur
+				heap.Fix(open, n.index)
+			}
+		}
+	}
+	return buildPath(best), false
+}
+
+func buildPath(n *pathNode) []common.Point {
+	path := make([]common.Point, n.g)
+	for ; n.parent != nil; n = n.parent {
+		path[n.g-1] = n.point
+	}
+	return path
+}
+
+// blockedCell 格子上有阻挡怪物移动的对象
+func (m *Monster) blockedCell(c *Cell) bool {
+	blocked := false
+	c.Objects.Range(func(_, v interface{}) bool {
+		o := v.(IMapObject)
+		if o != IMapObject(m) && o.IsBlocking() {
+			blocked = true
+			return false
+		}
+		return true
+	})
+	return blocked
+}
+
+// planPath 重新寻路并缓存路径
+func (m *Monster) planPath(location common.Point) {
+	m.path, _ = m.Map.FindPath(m.CurrentLocation, location, MaxPathSearch, m.blockedCell)
+	m.pathGoal = location
+}
+
+// walkPath 沿缓存的路径走一步，目标移动超过一格或者路径走不通时重新寻路
+// 没有路可走时返回 false
+func (m *Monster) walkPath(location common.Point) bool {
+	if !m.CanMove() {
+		return true
+	}
+	if len(m.path) == 0 || !InRange(m.pathGoal, location, 1) ||
+		m.path[0].Equal(m.CurrentLocation) || !InRange(m.path[0], m.CurrentLocation, 1) {
+		m.planPath(location)
+	}
+	for i := 0; i < 2; i++ {
+		if len(m.path) == 0 {
+			return false
+		}
+		if m.Walk(DirectionFromPoint(m.CurrentLocation, m.path[0])) {
+			m.path = m.path[1:]
+			return true
+		}
+		m.planPath(location)
+	}
+	m.path = nil
+	return false
+}
@@ -0,0 +1,149 @@
+package mir
+
+import (
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/setting"
+)
+
+// newTestMap 用字符画创建地图，'#' 为墙，'o' 为有阻挡对象的格子
+func newTestMap(rows ...string) (*Map, map[common.Point]bool) {
+	m := NewMap(len(rows[0]), len(rows))
+	occupied := map[common.Point]bool{}
+	for y, row := range rows {
+		for x, ch := range row {
+			if ch == '#' {
+				continue
+			}
+			p := common.NewPoint(x, y)
+			m.SetCell(p, &Cell{Point: p, Map: m, Objects: new(sync.Map)})
+			if ch == 'o' {
+				occupied[p] = true
+			}
+		}
+	}
+	return m, occupied
+}
+
+func TestFindPath(t *testing.T) {
+	m, occupied := newTestMap(
+		"..........",
+		".#######..",
+		".......#..",
+		"......o#..",
+		"..######..",
+		"..........",
+	)
+	blocked := func(c *Cell) bool { return occupied[c.Point] }
+	from, to := common.NewPoint(0, 3), common.NewPoint(6, 2)
+
+	path, found := m.FindPath(from, to, MaxPathSearch, blocked)
+	if !found || len(path) != 6 || !path[len(path)-1].Equal(to) {
+		t.Fatalf("path = %v, found = %v", path, found)
+	}
+	prev := from
+	for _, p := range path {
+		if !InRange(prev, p, 1) || m.GetCell(p) == nil || occupied[p] {
+			t.Fatalf("路径不连续或经过了障碍: %v", path)
+		}
+		prev = p
+	}
+
+	// 终点被包围时走到离终点最近的位置
+	to = common.NewPoint(6, 3)
+	m.GetCell(common.NewPoint(5, 2)).Attribute = common.CellAttributeHighWall
+	m.GetCell(common.NewPoint(6, 2)).Attribute = common.CellAttributeHighWall
+	m.GetCell(common.NewPoint(5, 3)).Attribute = common.CellAttributeHighWall
+	path, found = m.FindPath(from, to, MaxPathSearch, blocked)
+	if found || len(path) == 0 || pathDistance(path[len(path)-1], to) != 2 {
+		t.Fatalf("path = %v, found = %v", path, found)
+	}
+
+	// 超过搜索上限时返回部分路径
+	path, found = m.FindPath(common.NewPoint(0, 0), common.NewPoint(9, 5), 3, blocked)
+	if found || len(path) == 0 {
+		t.Fatalf("path = %v, found = %v", path, found)
+	}
+}
+
+// testMapFile 按 V1 格式生成的 100x100 地图，一道竖墙和一道横墙把地图分开，只能从城门通过
+const testMapFile = "testdata/town.map"
+
+func TestFindPathTown(t *testing.T) {
+	m := LoadMap(testMapFile)
+	// 从左下角到右上角要先后穿过横墙和竖墙上的城门
+	from, to := common.NewPoint(5, 90), common.NewPoint(90, 10)
+	path, found := m.FindPath(from, to, m.Width*m.Height, nil)
+	if !found || !path[len(path)-1].Equal(to) {
+		t.Fatalf("path = %v, found = %v", path, found)
+	}
+	prev := from
+	for _, p := range path {
+		if !InRange(prev, p, 1) || m.GetCell(p) == nil {
+			t.Fatalf("路径不连续或穿过了墙: %v", path)
+		}
+		prev = p
+	}
+}
+
+func benchmarkFindPath(b *testing.B, m *Map, distance int) {
+	walkable := make([]common.Point, 0)
+	for x := 0; x < m.Width; x++ {
+		for y := 0; y < m.Height; y++ {
+			if c := m.GetCellXY(x, y); c != nil && c.CanWalk() {
+				walkable = append(walkable, c.Point)
+			}
+		}
+	}
+	if len(walkable) == 0 {
+		b.Skip("地图没有可以行走的格子")
+	}
+	r := rand.New(rand.NewSource(1))
+	pairs := make([][2]common.Point, 0, 256)
+	for len(pairs) < cap(pairs) {
+		from := walkable[r.Intn(len(walkable))]
+		x := int(from.X) + r.Intn(distance*2+1) - distance
+		y := int(from.Y) + r.Intn(distance*2+1) - distance
+		if c := m.GetCellXY(x, y); c != nil && c.CanWalk() {
+			pairs = append(pairs, [2]common.Point{from, c.Point})
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pair := pairs[i%len(pairs)]
+		m.FindPath(pair[0], pair[1], MaxPathSearch, nil)
+	}
+}
+
+// BenchmarkFindPathMap 使用真实地图数据，地图文件不存在时跳过
+func BenchmarkFindPathMap(b *testing.B) {
+	file := setting.Conf.MapDirPath + "0.map"
+	if _, err := os.Stat(file); err != nil {
+		b.Skip("地图文件不存在: " + file)
+	}
+	m := LoadMap(file)
+	b.Run("chase", func(b *testing.B) { benchmarkFindPath(b, m, 12) })
+	b.Run("far", func(b *testing.B) { benchmarkFindPath(b, m, 40) })
+}
+
+func BenchmarkFindPathMaze(b *testing.B) {
+	rows := make([]string, 200)
+	for y := range rows {
+		row := make([]byte, 200)
+		for x := range row {
+			row[x] = '.'
+			// 每隔 4 列一堵墙，墙上交替在顶部和底部留出缺口
+			if x%4 == 2 && ((x/4)%2 == 0 && y != 0 || (x/4)%2 == 1 && y != 199) {
+				row[x] = '#'
+			}
+		}
+		rows[y] = string(row)
+	}
+	m, _ := newTestMap(rows...)
+	b.Run("chase", func(b *testing.B) { benchmarkFindPath(b, m, 12) })
+	b.Run("far", func(b *testing.B) { benchmarkFindPath(b, m, 40) })
+}
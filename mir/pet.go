@@ -0,0 +1,259 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// summonInfo 召唤技能召唤的宠物名字、消耗的护身符数量和同时存在的数量上限
+type summonInfo struct {
+	name    string
+	amulets int
+	limit   int
+}
+
+var summonInfos = map[common.Spell]summonInfo{
+	common.SpellSummonSkeleton: {"BoneFamiliar", 1, 1},
+	common.SpellSummonShinsu:   {"Shinsu", 5, 1},
+	common.SpellSummonHolyDeva: {"HolyDeva", 2, 1},
+	common.SpellSummonVampire:  {"VampireSpider", 1, 1},
+	common.SpellSummonToad:     {"SpittingToad", 1, 1},
+	common.SpellSummonSnakes:   {"SnakeTotem", 1, 1},
+	common.SpellMirroring:      {CloneName, 0, 1},
+}
+
+// CloneName 分身术召唤的分身，外观和主人一样，不会保存到数据库
+const CloneName = "Clone"
+
+const (
+	MaxPets        = 2     // 召唤宠物的总数上限
+	PetRecallRange = 12    // 宠物离主人超过这个距离时传送回主人身边
+	PetLevelExp    = 20000 // 宠物每升一级需要的经验 * (等级 + 1)
+)
+
+// AddPet 添加宠物
+func (p *Player) AddPet(m *Monster) {
+	m.Master = p
+	m.Target = nil
+	p.Pets = append(p.Pets, m)
+}
+
+// RemovePet 宠物死亡或被释放
+func (p *Player) RemovePet(m *Monster) {
+	for i := range p.Pets {
+		if p.Pets[i] == m {
+			p.Pets = append(p.Pets[:i], p.Pets[i+1:]...)
+			return
+		}
+	}
+}
+
+// countPets 名字为 name 的宠物数量，name 为空时统计全部
+func (p *Player) countPets(name string) int {
+	n := 0
+	for _, pet := range p.Pets {
+		if !pet.IsDead() && (name == "" || pet.GetName() == name) {
+			n++
+		}
+	}
+	return n
+}
+
+// ChangePMode 切换宠物模式
+func (p *Player) ChangePMode(mode common.PetMode) {
+	var msg string
+	switch mode {
+	case common.PetModeBoth:
+		msg = "宠物模式: 跟随并攻击"
+	case common.PetModeMoveOnly:
+		msg = "宠物模式: 只跟随"
+	case common.PetModeAttackOnly:
+		msg = "宠物模式: 只攻击"
+	case common.PetModeNone:
+		msg = "宠物模式: 休息"
+	default:
+		return
+	}
+	p.PMode = mode
+	for _, pet := range p.Pets {
+		if mode == common.PetModeMoveOnly || mode == common.PetModeNone {
+			pet.(*Monster).Target = nil
+		}
+	}
+	p.Enqueue(&server.ChangePMode{Mode: mode})
+	p.ReceiveChat(msg, common.ChatTypeHint)
+}
+
+// petsTarget 主人攻击或被攻击时，空闲的宠物攻击 target
+func (p *Player) petsTarget(target IMapObject) {
+	if p.PMode == common.PetModeMoveOnly || p.PMode == common.PetModeNone {
+		return
+	}
+	for _, o := range p.Pets {
+		pet := o.(*Monster)
+		if pet.IsDead() || pet.Target != nil || target == IMapObject(pet) || !pet.canTarget(target) {
+			continue
+		}
+		pet.Target = target
+	}
+}
+
+// despawnPets 主人下线时把宠物从地图上移除，p.Pets 保留用于保存
+func (p *Player) despawnPets() {
+	for _, o := range p.Pets {
+		o.(*Monster).despawn()
+	}
+}
+
+// teleportPets 主人换地图后宠物跟随
+func (p *Player) teleportPets() {
+	for _, o := range p.Pets {
+		if pet := o.(*Monster); !pet.IsDead() {
+			pet.PetRecall()
+		}
+	}
+}
+
+// petBack 主人身后的位置
+func (p *Player) petBack() common.Point {
+	return p.CurrentLocation.NextPoint(common.MirDirection((int(p.CurrentDirection)+4)%8), 1)
+}
+
+// despawn 从地图上移除，不会掉落物品
+func (m *Monster) despawn() {
+	m.Broadcast(ServerMessage{}.ObjectRemove(m))
+	m.Map.DeleteObject(m)
+}
+
+// PetRecall 宠物传送回主人身边，主人换地图时也跟随过去
+func (m *Monster) PetRecall(...interface{}) {
+	master := m.Master
+	if master == nil || m.IsDead() {
+		return
+	}
+	back := master.petBack()
+	pt, err := master.Map.GetValidPoint(int(back.X), int(back.Y), 1)
+	if err != nil {
+		pt = master.CurrentLocation
+	}
+	m.Broadcast(&server.ObjectTeleportOut{ObjectID: m.GetID()})
+	m.despawn()
+	m.Target = nil
+	m.Spawn(master.Map, pt)
+	m.Broadcast(&server.ObjectTeleportIn{ObjectID: m.GetID()})
+}
+
+// SetPetLevel 设置宠物等级，每级增加生命、防御和攻击
+func (m *Monster) SetPetLevel(level uint16) {
+	n := int(level) - int(m.PetLevel)
+	m.PetLevel = level
+	m.MaxHP = uint32(int(m.MaxHP) + n*20)
+	m.MinAC = addUint16(m.MinAC, n*2)
+	m.MaxAC = addUint16(m.MaxAC, n*2)
+	m.MinMAC = addUint16(m.MinMAC, n*2)
+	m.MaxMAC = addUint16(m.MaxMAC, n*2)
+	m.MinDC = addUint16(m.MinDC, n)
+	m.MaxDC = addUint16(m.MaxDC, n)
+	if m.HP > m.MaxHP {
+		m.HP = m.MaxHP
+	}
+}
+
+// PetExp 宠物击杀获得经验，达到 PetLevelExp * (等级 + 1) 时升级
+func (m *Monster) PetExp(amount int) {
+	if m.PetLevel >= m.MaxPetLevel || amount <= 0 {
+		return
+	}
+	if _, ok := summonInfoByName(m.Name); ok {
+		amount *= 3
+	}
+	m.PetExperience += amount
+	need := PetLevelExp * (int(m.PetLevel) + 1)
+	if m.PetExperience < need {
+		return
+	}
+	m.PetExperience -= need
+	m.SetPetLevel(m.PetLevel + 1)
+	m.Broadcast(ServerMessage{}.ObjectHealth(m.GetID(), uint8(float32(m.HP)/float32(m.MaxHP)*100), 5))
+	m.Master.ReceiveChat(fmt.Sprintf("%s 升到了 %d 级", m.Name, m.PetLevel), common.ChatTypeHint)
+}
+
+// summonInfoByName 召唤出来的宠物(而不是诱惑来的)
+func summonInfoByName(name string) (summonInfo, bool) {
+	for _, s := range summonInfos {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return summonInfo{}, false
+}
+
+// petProcess 宠物行为：按主人的宠物模式跟随主人、攻击目标
+func (m *Monster) petProcess() {
+	master := m.Master
+	if master.Map != m.Map || !InRange(m.CurrentLocation, master.CurrentLocation, PetRecallRange) {
+		m.PetRecall()
+		return
+	}
+	mode := master.PMode
+	if mode == common.PetModeMoveOnly || mode == common.PetModeNone {
+		m.Target = nil
+	} else if m.Target == nil {
+		m.findPetTarget()
+	}
+	if m.Target != nil {
+		if m.InAttackRange() {
+			if m.CanAttack() {
+				m.Attack()
+			}
+			return
+		}
+		m.MoveTo(m.Target.GetPoint())
+		return
+	}
+	if mode == common.PetModeBoth || mode == common.PetModeMoveOnly {
+		if !InRange(m.CurrentLocation, master.CurrentLocation, 2) {
+			m.MoveTo(master.petBack())
+		}
+	}
+}
+
+// findPetTarget 宠物只会主动攻击附近的怪物，玩家需要主人指定
+func (m *Monster) findPetTarget() {
+	m.Map.RangeObject(m.CurrentLocation, m.ViewRange, func(o IMapObject) bool {
+		if o.GetRace() != common.ObjectTypeMonster || o.(*Monster).Master != nil || !m.canTarget(o) {
+			return true
+		}
+		m.Target = o
+		return false
+	})
+}
+
+// cloneInfo 分身显示为主人的样子
+func (m *Monster) cloneInfo() *server.ObjectPlayer {
+	p := m.Master
+	return &server.ObjectPlayer{
+		ObjectID:     m.ID,
+		Name:         p.Name,
+		NameColor:    m.NameColor.ToInt32(),
+		Class:        p.Class,
+		Gender:       p.Gender,
+		Level:        p.Level,
+		Location:     m.GetPoint(),
+		Direction:    m.GetDirection(),
+		Hair:         p.Hair,
+		Light:        p.Light,
+		Weapon:       int16(p.LooksWeapon),
+		WeaponEffect: int16(p.LooksWeaponEffect),
+		Armour:       int16(p.LooksArmour),
+		Poison:       m.Poison,
+		Dead:         m.IsDead(),
+		Hidden:       m.IsHidden(),
+		Effect:       common.SpellEffectNone,
+		WingEffect:   uint8(p.LooksWings),
+		Buffs:        make([]common.BuffType, 0),
+		LevelEffects: common.LevelEffectsNone,
+	}
+}
@@ -2,6 +2,7 @@ package mir
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,6 +33,8 @@ type Player struct {
 	Level              uint16
 	Experience         int64
 	Gold               uint64
+	Credit             uint32 // 账号元宝
+	Pearls             uint32 // 账号珍珠
 	GuildName          string
 	GuildRankName      string
 	Class              common.MirClass
@@ -41,6 +44,8 @@ type Player struct {
 	Inventory          []common.UserItem // 46
 	Equipment          []common.UserItem // 14
 	QuestInventory     []common.UserItem // 40
+	Storage            []common.UserItem // 80, 扩展后 160
+	HasExpandedStorage bool
 	Trade              []common.UserItem // 10
 	Refine             []common.UserItem // 16
 	LooksArmour        int
@@ -69,6 +74,8 @@ type Player struct {
 	MaxBagWeight       uint16 //Other Stats;
 	MaxWearWeight      uint16
 	MaxHandWeight      uint16
+	CurrentWearWeight  int
+	CurrentHandWeight  int
 	ASpeed             int8
 	Luck               int8
 	LifeOnHit          uint8
@@ -98,6 +105,19 @@ type Player struct {
 	AMode              common.AttackMode
 	PMode              common.PetMode
 	CallingNPC         *NPC
+	UsePearls          bool // 当前 NPC 商店使用珍珠交易
+	Friends            []common.Friend
+	GroupMembers       []*Player    // 队伍成员，包括自己，第一个是队长
+	GroupInvitation    *Player      // 邀请自己组队的队长
+	AllowGroup         bool         // 是否允许组队
+	ShoutTime          time.Time    // 下次可以地图喊话的时间
+	GlobalShoutTime    time.Time    // 下次可以全服喊话的时间
+	GuildBuffs         []GuildBuff  // 行会增益
+	NoDuraLoss         bool         // 装备了不掉持久的特殊物品
+	Toggles            SpellToggles // 战士技能开关
+	SpellTime          time.Time    // 公共施法冷却，在此之前不能再次施法
+	Barrier            int          // 元素盾吸收伤害的百分比
+	BarrierTime        time.Time    // 元素盾失效时间
 }
 
 type Health struct {
@@ -167,7 +187,7 @@ func (p *Player) AttackMode() common.AttackMode {
 // IsAttackTarget 判断玩家是否是攻击者的攻击对象
 func (p *Player) IsAttackTarget(attacker IMapObject) bool {
 	// return false
-	if attacker == nil {
+	if attacker == nil || attacker.GetID() == p.GetID() {
 		return false
 	}
 	if p.IsDead() {
@@ -236,10 +256,7 @@ func (p *Player) IsFriendlyTarget(obj IMapObject) bool {
 		// 	case ObjectType.Monster:
 		// 		return false;
 		// }
-		if !ally.Master.IsFriendlyTarget(ally) {
-			return false
-		}
-		return true
+		return ally.Master == p || ally.Master.IsFriendlyTarget(p)
 	}
 	return true
 }
@@ -261,7 +278,7 @@ func (p *Player) GetInfo() interface{} {
 		Weapon:           int16(p.LooksWeapon),
 		WeaponEffect:     int16(p.LooksWeaponEffect),
 		Armour:           int16(p.LooksArmour),
-		Poison:           common.PoisonTypeNone, // TODO
+		Poison:           p.CurrentPoison(),
 		Dead:             p.IsDead(),
 		Hidden:           p.IsHidden(),
 		Effect:           common.SpellEffectNone, // TODO
@@ -298,12 +315,100 @@ func (p *Player) GetBaseStats() BaseStats {
 }
 
 // AddBuff ...
+// AddBuff 增加 Buff，已有同类型的 Buff 时替换
 func (p *Player) AddBuff(buff *Buff) {
-	p.Buffs = append(p.Buffs, buff)
+	replaced := false
+	for i := range p.Buffs {
+		if p.Buffs[i].BuffType == buff.BuffType {
+			p.Buffs[i] = buff
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		p.Buffs = append(p.Buffs, buff)
+	}
+	p.Enqueue(&server.AddBuff{
+		Type:     buff.BuffType,
+		Caster:   p.Name,
+		ObjectID: p.GetID(),
+		Visible:  buff.Visible,
+		Expire:   int64(time.Until(buff.ExpireTime) / time.Millisecond),
+		Values:   []int32{int32(buff.Values)},
+		Infinite: buff.Infinite,
+	})
+	p.RefreshStats()
+	if isStealthBuff(buff.BuffType) {
+		p.broadcastHidden()
+	}
+}
+
+// GetBuff 获取指定类型的 Buff，没有时返回 nil
+func (p *Player) GetBuff(typ common.BuffType) *Buff {
+	for _, b := range p.Buffs {
+		if b.BuffType == typ {
+			return b
+		}
+	}
+	return nil
+}
+
+// ProcessBuffs 移除过期的 Buff
+func (p *Player) ProcessBuffs() {
+	now := time.Now()
+	buffs := p.Buffs[:0]
+	changed := false
+	revealed := false
+	for _, b := range p.Buffs {
+		if b.Infinite || now.Before(b.ExpireTime) {
+			buffs = append(buffs, b)
+			continue
+		}
+		changed = true
+		revealed = revealed || isStealthBuff(b.BuffType)
+		p.Enqueue(&server.RemoveBuff{Type: b.BuffType, ObjectID: p.GetID()})
+		if b.BuffType == common.BuffTypeMagicShield {
+			msg := &server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectMagicShieldDown}
+			p.Enqueue(msg)
+			p.Broadcast(msg)
+		}
+	}
+	p.Buffs = buffs
+	if changed {
+		p.RefreshStats()
+	}
+	if revealed && !p.IsHidden() {
+		p.broadcastHidden()
+	}
 }
 
+// ApplyPoison 玩家中毒，毒抗越高越容易抵抗
 func (p *Player) ApplyPoison(poison *Poison, caster IMapObject) {
+	if p.IsDead() || RandomNext(10) < int(p.PoisonResist) {
+		return
+	}
+	p.addPoison(poison)
+	p.sendPoisoned()
+}
+
+// ProcessPoison 处理玩家中毒效果
+func (p *Player) ProcessPoison() {
+	if len(p.Poisons) == 0 {
+		return
+	}
+	damage, _, changed := p.tickPoisons(time.Now())
+	if changed {
+		p.sendPoisoned()
+	}
+	if damage > 0 {
+		p.ChangeHP(-damage)
+	}
+}
 
+func (p *Player) sendPoisoned() {
+	poison := p.CurrentPoison()
+	p.Enqueue(&server.Poisoned{Poison: poison})
+	p.Broadcast(&server.ObjectPoisoned{ObjectID: p.GetID(), Poison: poison})
 }
 
 func (p *Player) NewObjectID() uint32 {
@@ -311,19 +416,26 @@ func (p *Player) NewObjectID() uint32 {
 }
 
 func (p *Player) IsDead() bool {
-	return false
+	return p.Dead
 }
 
 func (p *Player) IsUndead() bool {
 	return false
 }
 
+// IsHidden 隐身术、月影术、烈火身生效时隐身
 func (p *Player) IsHidden() bool {
+	now := time.Now()
+	for _, b := range p.Buffs {
+		if isStealthBuff(b.BuffType) && (b.Infinite || now.Before(b.ExpireTime)) {
+			return true
+		}
+	}
 	return false
 }
 
 func (p *Player) CanMove() bool {
-	return true
+	return !p.IsDead() && !p.IsParalysed()
 }
 
 func (p *Player) CanWalk() bool {
@@ -335,19 +447,32 @@ func (p *Player) CanRun() bool {
 }
 
 func (p *Player) CanAttack() bool {
-	return true
+	return !p.IsDead() && !p.IsParalysed()
 }
 
 func (p *Player) CanRegen() bool {
 	return true
 }
 
-func (p *Player) CanCast() bool {
-	return true
+// CanCast 是否可以施放技能，死亡、麻痹、公共施法冷却和技能自身冷却时不能施放
+func (p *Player) CanCast(magic *common.UserMagic) bool {
+	if p.IsDead() || p.IsParalysed() || time.Now().Before(p.SpellTime) {
+		return false
+	}
+	return magic.CastReady(common.NowMillis())
 }
 
+// CanUseItem 检查物品的使用要求，技能书已学会时不能使用
 func (p *Player) CanUseItem(item *common.UserItem) bool {
-	return true
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil {
+		return false
+	}
+	if info.Type == common.ItemTypeBook && p.GetMagic(common.Spell(info.Shape)) != nil {
+		p.ReceiveChat("已经学会了该技能", common.ChatTypeSystem)
+		return false
+	}
+	return p.checkRequirements(info, "使用")
 }
 
 func (p *Player) Enqueue(msg interface{}) {
@@ -393,6 +518,13 @@ func (p *Player) Process() {
 	for i := range finishID {
 		p.ActionList.Delete(finishID[i])
 	}
+	p.ProcessBuffs()
+	p.processBarrier()
+	if p.IsDead() {
+		return
+	}
+	p.ProcessPoison()
+	p.ProcessToggles()
 	ch := &p.Health
 	if ch.HPPotValue != 0 && ch.HPPotNextTime.Before(now) {
 		p.ChangeHP(ch.HPPotPerValue)
@@ -475,18 +607,40 @@ func (p *Player) RefreshStats() {
 	p.RefreshMirSetStats()
 	p.RefreshSkills()
 	p.RefreshBuffs()
-	p.RefreshStatCaps()
 	p.RefreshMountStats()
 	p.RefreshGuildBuffs()
+	p.RefreshStatCaps()
 }
 
 func (p *Player) RefreshLevelStats() {
 	baseStats := setting.BaseStats[p.Class]
+	// 以下属性只由装备、增益等累加，每次刷新前清零
+	p.ExpRateOffset = 0
+	p.ItemDropRateOffset = 0
+	p.GoldDropRateOffset = 0
+	p.AttackBonus = 0
+	p.MineRate = 0
+	p.GemRate = 0
+	p.FishRate = 0
+	p.CraftRate = 0
 	p.Accuracy = uint8(baseStats.StartAccuracy)
 	p.Agility = uint8(baseStats.StartAgility)
 	p.CriticalRate = uint8(baseStats.StartCriticalRate)
 	p.CriticalDamage = uint8(baseStats.StartCriticalDamage)
-	p.MaxExperience = 100
+	p.ASpeed = 0
+	p.Luck = 0
+	p.LifeOnHit = 0
+	p.HpDrainRate = 0
+	p.Reflect = 0
+	p.MagicResist = 0
+	p.PoisonResist = 0
+	p.HealthRecovery = 0
+	p.SpellRecovery = 0
+	p.PoisonRecovery = 0
+	p.Holy = 0
+	p.Freezing = 0
+	p.PoisonAttack = 0
+	p.MaxExperience = p.Map.Env.GameDB.GetMaxExperience(p.Level)
 	p.MaxHP = uint16(14 + (float32(p.Level)/baseStats.HpGain+baseStats.HpGainRate)*float32(p.Level))
 	p.MinAC = 0
 	if baseStats.MinAc > 0 {
@@ -547,6 +701,10 @@ func (p *Player) RefreshLevelStats() {
 		p.MaxMP = uint16(13.0 + (float32(p.Level/5.0+2.0) * 2.2 * float32(p.Level)) + (float32(p.Level) * baseStats.MpGainRate))
 	case common.MirClassTaoist:
 		p.MaxMP = uint16((13 + float32(p.Level)/8.0*2.2*float32(p.Level)) + (float32(p.Level) * baseStats.MpGainRate))
+	case common.MirClassAssassin:
+		p.MaxMP = uint16(11.0 + (float32(p.Level) * 5.0) + (float32(p.Level) * baseStats.MpGainRate))
+	case common.MirClassArcher:
+		p.MaxMP = uint16(11.0 + (float32(p.Level) * 4.0) + (float32(p.Level) * baseStats.MpGainRate))
 	}
 }
 
@@ -561,13 +719,74 @@ func (p *Player) RefreshBagWeight() {
 	}
 }
 
+// RefreshEquipmentStats 累加装备的基础属性、附加属性和觉醒属性
+// 同时计算外观、光照和穿戴负重，损坏的装备不显示
 func (p *Player) RefreshEquipmentStats() {
 	gdb := p.Map.Env.GameDB
+	p.LooksArmour = 0
+	p.LooksWings = 0
+	p.LooksWeapon = -1
+	p.LooksWeaponEffect = 0
+	p.Light = 0
+	p.CurrentWearWeight = 0
+	p.CurrentHandWeight = 0
+	p.NoDuraLoss = false
 	for i := range p.Equipment {
-		e := gdb.GetItemInfoByID(int(p.Equipment[i].ItemID))
+		ui := p.Equipment[i]
+		if ui.ID == 0 {
+			continue
+		}
+		e := gdb.GetItemInfoByID(int(ui.ItemID))
 		if e == nil {
 			continue
 		}
+		if e.Type == common.ItemTypeWeapon || e.Type == common.ItemTypeTorch {
+			p.CurrentHandWeight += int(e.Weight)
+		} else {
+			p.CurrentWearWeight += int(e.Weight)
+		}
+		if ui.CurrentDura == 0 && e.Durability > 0 {
+			continue
+		}
+		if common.SpecialItemMode(e.UniqueItem)&common.SpecialItemModeNoDuraLoss != 0 {
+			p.NoDuraLoss = true
+		}
+		if e.Light > p.Light {
+			p.Light = e.Light
+		}
+		ac, mac, dc, mc, sc, hp, mp := AwakeStats(&ui)
+		p.MinAC += uint16(e.MinAC)
+		p.MaxAC += uint16(int(e.MaxAC) + int(ui.AC) + ac)
+		p.MinMAC += uint16(e.MinMAC)
+		p.MaxMAC += uint16(int(e.MaxMAC) + int(ui.MAC) + mac)
+		p.MinDC += uint16(e.MinDC)
+		p.MaxDC += uint16(int(e.MaxDC) + int(ui.DC) + dc)
+		p.MinMC += uint16(e.MinMC)
+		p.MaxMC += uint16(int(e.MaxMC) + int(ui.MC) + mc)
+		p.MinSC += uint16(e.MinSC)
+		p.MaxSC += uint16(int(e.MaxSC) + int(ui.SC) + sc)
+		p.MaxHP += uint16(int(e.HP) + int(ui.HP) + hp)
+		p.MaxMP += uint16(int(e.MP) + int(ui.MP) + mp)
+		p.Accuracy += e.Accuracy + ui.Accuracy
+		p.Agility += e.Agility + ui.Agility
+		p.ASpeed += e.AttackSpeed + ui.AttackSpeed
+		p.Luck += e.Luck + ui.Luck
+		p.CriticalRate += e.CriticalRate + ui.CriticalRate
+		p.CriticalDamage += e.CriticalDamage + ui.CriticalDamage
+		p.MagicResist += e.MagicResist + ui.MagicResist
+		p.PoisonResist += e.PoisonResist + ui.PoisonResist
+		p.HealthRecovery += e.HealthRecovery + ui.HealthRecovery
+		p.SpellRecovery += e.SpellRecovery + ui.ManaRecovery
+		p.PoisonRecovery += e.PoisonRecovery + ui.PoisonRecovery
+		p.Freezing += e.Freezing + ui.Freezing
+		p.PoisonAttack += e.PoisonAttack + ui.PoisonAttack
+		p.Holy += e.Holy
+		p.Reflect += e.Reflect
+		p.HpDrainRate += e.HpDrainRate
+		p.MaxBagWeight += uint16(e.BagWeight)
+		p.MaxWearWeight += uint16(e.WearWeight)
+		p.MaxHandWeight += uint16(e.HandWeight)
+		p.ExpRateOffset += float32(e.ExpRate)
 		switch e.Type {
 		case common.ItemTypeArmour:
 			p.LooksArmour = int(e.Shape)
@@ -579,34 +798,10 @@ func (p *Player) RefreshEquipmentStats() {
 	}
 }
 
-func (p *Player) RefreshItemSetStats() {
-
-}
-
-func (p *Player) RefreshMirSetStats() {
-
-}
-
-func (p *Player) RefreshSkills() {
-
-}
-
-func (p *Player) RefreshBuffs() {
-
-}
-
-func (p *Player) RefreshStatCaps() {
-
-}
-
 func (p *Player) RefreshMountStats() {
 
 }
 
-func (p *Player) RefreshGuildBuffs() {
-
-}
-
 // GetUserItemByID 获取物品，返回该物品在容器的索引和是否成功
 func (p *Player) GetUserItemByID(mirGridType common.MirGridType, id uint64) (index int, item *common.UserItem) {
 	var arr []common.UserItem
@@ -627,9 +822,28 @@ func (p *Player) GetUserItemByID(mirGridType common.MirGridType, id uint64) (ind
 	return -1, nil
 }
 
-// ConsumeItem 减少物品数量
+// ConsumeItem 减少物品数量，userItem 需要指向玩家身上的物品，用完时清空格子
 func (p *Player) ConsumeItem(userItem *common.UserItem, count int) {
+	if uint32(count) > userItem.Count {
+		count = int(userItem.Count)
+	}
+	p.Enqueue(&server.DeleteItem{UniqueID: userItem.ID, Count: uint32(count)})
 	userItem.Count -= uint32(count)
+	if userItem.Count == 0 {
+		*userItem = common.UserItem{}
+	}
+	p.RefreshBagWeight()
+}
+
+// Revive 复活并恢复 hp 点血量
+func (p *Player) Revive(hp int) {
+	if !p.IsDead() {
+		return
+	}
+	p.Dead = false
+	p.SetHP(uint32(hp))
+	p.Enqueue(&server.Revived{})
+	p.Broadcast(&server.ObjectRevived{ObjectID: p.GetID(), Effect: true})
 }
 
 // GainItem 为玩家增加物品，增加成功返回 true
@@ -659,6 +873,9 @@ func (p *Player) GainItem(ui *common.UserItem) bool {
 		p.Inventory[i] = *ui
 		break
 	}
+	if i >= j {
+		return false
+	}
 	p.EnqueueItemInfo(ui.ItemID)
 	p.Enqueue(ServerMessage{}.GainedItem(ui))
 	p.RefreshBagWeight()
@@ -674,6 +891,43 @@ func (p *Player) GainGold(gold uint64) {
 	p.Enqueue(ServerMessage{}.GainedGold(gold))
 }
 
+// TakeGold 扣除玩家金币
+func (p *Player) TakeGold(gold uint64) {
+	if gold <= 0 {
+		return
+	}
+	if gold > p.Gold {
+		gold = p.Gold
+	}
+	p.Gold -= gold
+	p.Enqueue(&server.LoseGold{Gold: uint32(gold)})
+}
+
+// CanGainItem 背包是否有空位并且负重足够放下物品
+func (p *Player) CanGainItem(ui *common.UserItem) bool {
+	item := p.Map.Env.GameDB.GetItemInfoByID(int(ui.ItemID))
+	if item == nil {
+		return false
+	}
+	if p.CurrentBagWeight+int(item.Weight) > int(p.MaxBagWeight) {
+		return false
+	}
+	i, j := 6, 46
+	if item.Type == common.ItemTypePotion ||
+		item.Type == common.ItemTypeScroll ||
+		item.Type == common.ItemTypeScript ||
+		item.Type == common.ItemTypeAmulet {
+		i = 0
+		j = 4
+	}
+	for ; i < j && i < len(p.Inventory); i++ {
+		if p.Inventory[i].ID == 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Player) UpdateConcentration() {
 	p.Enqueue(ServerMessage{}.SetConcentration(p))
 	p.Broadcast(ServerMessage{}.SetObjectConcentration(p))
@@ -690,33 +944,93 @@ func (p *Player) GetAttackPower(min, max int) int {
 	return RandomInt(min, max)
 }
 
-// TODO
-func (p *Player) Attacked(attacker IMapObject, damageFinal int, defenceType common.DefenceType, damageWeapon bool) {
-
+// Attacked 被攻击，damageWeapon 为 true 时攻击者的武器减少持久，返回造成的伤害
+func (p *Player) Attacked(attacker IMapObject, damageFinal int, defenceType common.DefenceType, damageWeapon bool) int {
+	accuracy := int(attacker.GetBaseStats().Accuracy)
+	armour := 0
+	switch defenceType {
+	case common.DefenceTypeACAgility:
+		if RandomInt(0, int(p.Agility)) > accuracy {
+			p.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
+			return 0
+		}
+		armour = p.GetAttackPower(int(p.MinAC), int(p.MaxAC))
+	case common.DefenceTypeAC:
+		armour = p.GetAttackPower(int(p.MinAC), int(p.MaxAC))
+	case common.DefenceTypeMACAgility:
+		if RandomInt(0, int(p.Agility)) > accuracy {
+			p.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
+			return 0
+		}
+		armour = p.GetAttackPower(int(p.MinMAC), int(p.MaxMAC))
+	case common.DefenceTypeMAC:
+		armour = p.GetAttackPower(int(p.MinMAC), int(p.MaxMAC))
+	case common.DefenceTypeAgility:
+		if RandomInt(0, int(p.Agility)) > accuracy {
+			p.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
+			return 0
+		}
+	}
+	if o, ok := attacker.(*Player); ok && damageWeapon {
+		o.DamageWeapon()
+	}
+	value := damageFinal - armour
+	if b := p.GetBuff(common.BuffTypeMagicShield); b != nil {
+		value -= value * (b.Values + 2) / 10
+	}
+	if time.Now().Before(p.BarrierTime) {
+		value -= value * p.Barrier / 100
+	}
+	if value <= 0 {
+		p.BroadcastDamageIndicator(common.DamageTypeMiss, 0)
+		return 0
+	}
+	p.petsTarget(attacker)
+	p.Enqueue(&server.Struck{AttackerID: attacker.GetID()})
+	p.Broadcast(ServerMessage{}.ObjectStruck(p, attacker.GetID()))
+	p.BroadcastDamageIndicator(common.DamageTypeHit, value)
+	p.DamageDura()
+	p.ChangeHP(-value)
+	// 阴阳盾被击中时有几率回血
+	if b := p.GetBuff(common.BuffTypeEnergyShield); b != nil && !p.IsDead() && RandomNext(4) == 0 {
+		p.ChangeHP(b.Values)
+	}
+	return value
 }
 
-// GainExp 为玩家增加经验
+// GainExp 为玩家增加经验，经验足够时可以连续升级
 func (p *Player) GainExp(amount uint32) {
+	if amount == 0 {
+		return
+	}
+	defer p.updateRanking()
 	p.Experience += int64(amount)
 	p.Enqueue(ServerMessage{}.GainExperience(amount))
-	if p.Experience < p.MaxExperience {
+	if p.MaxExperience == 0 || p.Experience < p.MaxExperience {
 		return
 	}
-	p.Experience -= p.MaxExperience
-	p.Level++
+	gdb := p.Map.Env.GameDB
+	for p.MaxExperience > 0 && p.Experience >= p.MaxExperience {
+		p.Experience -= p.MaxExperience
+		p.Level++
+		p.MaxExperience = gdb.GetMaxExperience(p.Level)
+	}
 	p.LevelUp()
 }
 
-// WinExp 玩家获取经验
+// WinExp 玩家击杀获取经验，比目标高 10 级以上时经验减少，再乘以服务器经验倍率和装备、Buff 的经验加成
 func (p *Player) WinExp(amount, targetLevel int) {
-	// 	if (Level < targetLevel + 10 || !Settings.ExpMobLevelDifference)
-	// 		expPoint = (int)amount;
-	// 	else
-	// 		expPoint = (int)amount - (int)Math.Round(Math.Max(amount / 15, 1) * ((double)Level - (targetLevel + 10)));
 	expPoint := amount
+	if setting.Conf.ExpMobLevelDifference && int(p.Level) >= targetLevel+10 {
+		expPoint = amount - int(math.Round(math.Max(float64(amount/15), 1)*float64(int(p.Level)-(targetLevel+10))))
+	}
 	if expPoint <= 0 {
 		expPoint = 1
 	}
+	expPoint = int(float32(expPoint) * setting.Conf.ExpRate)
+	if p.ExpRateOffset > 0 {
+		expPoint += int(float32(expPoint) * p.ExpRateOffset / 100)
+	}
 	// if (GroupMembers != null)
 	p.GainExp(uint32(expPoint))
 }
@@ -735,18 +1049,43 @@ func (p *Player) SetMP(amount uint32) {
 	p.Broadcast(msg)
 }
 
+// ChangeHP 增减生命值，结果限制在 [0, MaxHP]
 func (p *Player) ChangeHP(amount int) {
-	if amount == 0 || p.IsDead() || p.HP >= p.MaxHP {
+	if amount == 0 || p.IsDead() {
+		return
+	}
+	hp := int(p.HP) + amount
+	if hp > int(p.MaxHP) {
+		hp = int(p.MaxHP)
+	}
+	if hp < 0 {
+		hp = 0
+	}
+	if hp == int(p.HP) {
 		return
 	}
-	p.SetHP(uint32(int(p.HP) + amount))
+	p.SetHP(uint32(hp))
+	if hp == 0 {
+		p.Die()
+	}
 }
 
+// ChangeMP 增减魔法值，结果限制在 [0, MaxMP]
 func (p *Player) ChangeMP(amount int) {
-	if amount == 0 || p.IsDead() || p.MP >= p.MaxMP {
+	if amount == 0 || p.IsDead() {
+		return
+	}
+	mp := int(p.MP) + amount
+	if mp > int(p.MaxMP) {
+		mp = int(p.MaxMP)
+	}
+	if mp < 0 {
+		mp = 0
+	}
+	if mp == int(p.MP) {
 		return
 	}
-	p.SetMP(uint32(int(p.MP) + amount))
+	p.SetMP(uint32(mp))
 }
 
 func (p *Player) LevelUp() {
@@ -755,14 +1094,65 @@ func (p *Player) LevelUp() {
 	p.SetMP(uint32(p.MaxMP))
 	p.Enqueue(ServerMessage{}.LevelChanged(p.Level, p.Experience, p.MaxExperience))
 	p.Broadcast(ServerMessage{}.ObjectLeveled(p.GetID()))
+	p.ReceiveChat(fmt.Sprintf("恭喜升级，当前等级 %d", p.Level), common.ChatTypeLevelUp)
 }
 
-func (p *Player) Die() {
+// SetLevel 直接设置等级，经验清零
+func (p *Player) SetLevel(level uint16) {
+	if level == 0 {
+		level = 1
+	}
+	p.Level = level
+	p.Experience = 0
+	p.MaxExperience = p.Map.Env.GameDB.GetMaxExperience(level)
+	p.LevelUp()
+	p.updateRanking()
+}
 
+// updateRanking 把等级经验同步给排行榜
+func (p *Player) updateRanking() {
+	p.Map.Env.Ranking.UpdateProgress(int64(p.ID), int32(p.Level), p.Experience)
 }
 
-func (p *Player) Teleport(m *Map, pt common.Point) {
+// Die 玩家死亡，清除中毒和药水效果，死亡期间不再恢复
+func (p *Player) Die() {
+	if p.IsDead() {
+		return
+	}
+	p.HP = 0
+	p.Dead = true
+	p.Poisons = nil
+	p.Health.HPPotValue = 0
+	p.Health.MPPotValue = 0
+	p.sendPoisoned()
+	p.Enqueue(&server.Death{Location: p.CurrentLocation, Direction: p.CurrentDirection})
+	p.Broadcast(ServerMessage{}.ObjectDied(p.GetID(), p.GetDirection(), p.GetPoint()))
+}
 
+// Teleport 传送到地图 m 的 pt 点，目标点不能走或有阻挡时返回 false
+func (p *Player) Teleport(m *Map, pt common.Point) bool {
+	if m == nil {
+		return false
+	}
+	c := m.GetCell(pt)
+	if c == nil || !c.CanWalk() || c.HasObject() {
+		return false
+	}
+	p.Broadcast(&server.ObjectTeleportOut{ObjectID: p.GetID()})
+	p.Broadcast(ServerMessage{}.ObjectRemove(p))
+	p.Map.DeleteObject(p)
+	changed := p.Map != m
+	p.Map = m
+	p.CurrentLocation = pt
+	m.AddObject(p)
+	p.Enqueue(ServerMessage{}.MapChanged(m.Info, pt, p.CurrentDirection))
+	p.EnqueueAreaObjects(nil, c)
+	p.Broadcast(ServerMessage{}.ObjectPlayer(p))
+	p.Broadcast(&server.ObjectTeleportIn{ObjectID: p.GetID()})
+	if changed {
+		p.teleportPets()
+	}
+	return true
 }
 
 // func (p *Player) EnqueueAreaObjects(oldGrid, newGrid *Grid) {
@@ -821,7 +1211,7 @@ func (p *Player) Teleport(m *Map, pt common.Point) {
 func (p *Player) EnqueueAreaObjects(oldCell, newCell *Cell) {
 	if oldCell == nil {
 		p.Map.RangeObject(p.CurrentLocation, DataRange, func(o IMapObject) bool {
-			if o != p {
+			if o != p && !hiddenSpell(o) {
 				p.Enqueue(ServerMessage{}.Object(o))
 			}
 			return true
@@ -833,7 +1223,9 @@ func (p *Player) EnqueueAreaObjects(oldCell, newCell *Cell) {
 	for c, isadd := range cells.M {
 		if isadd {
 			c.Objects.Range(func(k, v interface{}) bool {
-				p.Enqueue(ServerMessage{}.Object(v.(IMapObject)))
+				if o := v.(IMapObject); !hiddenSpell(o) {
+					p.Enqueue(ServerMessage{}.Object(o))
+				}
 				return true
 			})
 		} else {
@@ -867,10 +1259,15 @@ func (p *Player) StartGame() {
 	p.EnqueueAreaObjects(nil, p.GetCell())
 	p.Enqueue(ServerMessage{}.NPCResponse([]string{}))
 	p.Broadcast(ServerMessage{}.ObjectPlayer(p))
+	p.EnqueueGameShop()
+	p.DeliverMail()
+	p.RefreshFriends()
+	p.Enqueue(&server.SwitchGroup{AllowGroup: p.AllowGroup})
 }
 
 func (p *Player) StopGame(reason int) {
 	p.Broadcast(ServerMessage{}.ObjectRemove(p))
+	p.despawnPets()
 }
 
 func (p *Player) Turn(direction common.MirDirection) {
@@ -898,9 +1295,14 @@ func (p *Player) Walk(direction common.MirDirection) {
 	p.CurrentLocation = n
 	p.Enqueue(ServerMessage{}.UserLocation(p))
 	p.Broadcast(ServerMessage{}.ObjectWalk(p))
+	processSpells(p)
 }
 
 func (p *Player) Run(direction common.MirDirection) {
+	if !p.CanMove() || !p.CanRun() {
+		p.Enqueue(ServerMessage{}.UserLocation(p))
+		return
+	}
 	n1 := p.Point().NextPoint(direction, 1)
 	n2 := p.Point().NextPoint(direction, 2)
 	if ok := p.Map.UpdateObject(p, n1, n2); !ok {
@@ -911,15 +1313,26 @@ func (p *Player) Run(direction common.MirDirection) {
 	p.CurrentLocation = n2
 	p.Enqueue(ServerMessage{}.UserLocation(p))
 	p.Broadcast(ServerMessage{}.ObjectRun(p))
+	processSpells(p)
 }
 
 func (p *Player) Chat(message string) {
-	// private message
-	if strings.HasPrefix(message, "/") {
-		return
+	if r := []rune(message); len(r) > ChatMessageMaxLen {
+		message = string(r[:ChatMessageMaxLen])
 	}
-	// group
-	if strings.HasPrefix(message, "!!") {
+	switch {
+	case strings.HasPrefix(message, "/"): // 私聊
+		p.Whisper(message)
+		return
+	case strings.HasPrefix(message, "!!"): // 组队
+		p.GroupChat(message[2:])
+		return
+	case strings.HasPrefix(message, "!~"): // 行会聊天需要行会系统，暂时和以前一样按普通聊天处理
+	case strings.HasPrefix(message, "!"): // 地图喊话
+		p.Shout(message[1:])
+		return
+	case strings.HasPrefix(message, "@!"): // 全服喊话
+		p.GlobalShout(message[2:])
 		return
 	}
 
@@ -951,7 +1364,26 @@ func (p *Player) Chat(message string) {
 			})
 		case "RESTORE":
 		case "CHANGEGENDER":
-		case "LEVEL":
+		case "LEVEL": // @level 等级，@level name 等级 设置玩家等级
+			if len(parts) != 2 && len(parts) != 3 {
+				p.ReceiveChat("正确命令格式: @level 22 或 @level name 22", common.ChatTypeSystem)
+				return
+			}
+			target := p
+			if len(parts) == 3 {
+				target = curMap.Env.GetPlayerByName(parts[1])
+				if target == nil {
+					p.ReceiveChat(fmt.Sprintf("找不到玩家(%s)", parts[1]), common.ChatTypeSystem)
+					return
+				}
+			}
+			level, err := strconv.Atoi(parts[len(parts)-1])
+			if err != nil || level <= 0 || level > 0xFFFF {
+				p.ReceiveChat("等级不正确", common.ChatTypeSystem)
+				return
+			}
+			target.SetLevel(uint16(level))
+			p.ReceiveChat(fmt.Sprintf("%s 等级设置为 %d", target.Name, level), common.ChatTypeSystem)
 		case "MAKE": // @make 物品名 数量
 			if len(parts) != 3 {
 				return
@@ -1031,8 +1463,31 @@ func (p *Player) Chat(message string) {
 		case "RELOADDROPS":
 		case "RELOADNPCS":
 		case "GIVEGOLD":
-		case "GIVEPEARLS":
-		case "GIVECREDIT":
+		case "GIVEPEARLS", "GIVECREDIT": // @givecredit [玩家名] 数量
+			if len(parts) < 2 || len(parts) > 3 {
+				p.ReceiveChat(fmt.Sprintf("正确命令格式: @%s [玩家名] 数量", strings.ToLower(parts[0])), common.ChatTypeSystem)
+				return
+			}
+			o := p
+			if len(parts) == 3 {
+				o = curMap.Env.GetPlayerByName(parts[1])
+				if o == nil {
+					p.ReceiveChat(fmt.Sprintf("找不到玩家(%s)", parts[1]), common.ChatTypeSystem)
+					return
+				}
+			}
+			amount, err := strconv.Atoi(parts[len(parts)-1])
+			if err != nil || amount <= 0 {
+				p.ReceiveChat("数量不正确", common.ChatTypeSystem)
+				return
+			}
+			if strings.ToUpper(parts[0]) == "GIVECREDIT" {
+				o.GainCredit(uint32(amount))
+				p.ReceiveChat(fmt.Sprintf("%s 获得 %d 元宝", o.Name, amount), common.ChatTypeSystem)
+			} else {
+				o.GainPearls(uint32(amount))
+				p.ReceiveChat(fmt.Sprintf("%s 获得 %d 珍珠", o.Name, amount), common.ChatTypeSystem)
+			}
 		case "GIVESKILL":
 		case "FIND":
 		case "LEAVEGUILD":
@@ -1050,7 +1505,8 @@ func (p *Player) Chat(message string) {
 		case "DECO": //TEST CODE
 		case "ADJUSTPKPOINT":
 		case "ADDINVENTORY":
-		case "ADDSTORAGE":
+		case "ADDSTORAGE": // @addstorage 花费金币扩展仓库
+			p.ExpandStorage()
 		case "INFO": // @info
 			if len(parts) != 1 {
 				return
@@ -1112,7 +1568,7 @@ func (p *Player) MoveItem(mirGridType common.MirGridType, from int32, to int32)
 			msg.Success = true
 		}
 	case common.MirGridTypeStorage:
-		// TODO
+		msg.Success = p.moveStorageItem(from, to)
 	case common.MirGridTypeTrade:
 		// TODO
 	case common.MirGridTypeRefine:
@@ -1121,15 +1577,6 @@ func (p *Player) MoveItem(mirGridType common.MirGridType, from int32, to int32)
 	p.Enqueue(msg)
 }
 
-func (p *Player) StoreItem(from int32, to int32) {
-	msg := &server.StoreItem{
-		From:    from,
-		To:      to,
-		Success: false,
-	}
-	p.Enqueue(msg)
-}
-
 func (p *Player) DepositRefineItem(from int32, to int32) {
 
 }
@@ -1162,10 +1609,6 @@ func (p *Player) RetrieveTradeItem(from int32, to int32) {
 
 }
 
-func (p *Player) TakeBackItem(from int32, to int32) {
-
-}
-
 func (p *Player) MergeItem(from common.MirGridType, to common.MirGridType, from2 uint64, to2 uint64) {
 
 }
@@ -1177,27 +1620,47 @@ func (p *Player) EquipItem(mirGridType common.MirGridType, id uint64, to int32)
 		To:       to,
 		Success:  false,
 	}
-	if l := len(p.Equipment); to < 0 || int(to) >= l {
+	if l := len(p.Equipment); p.IsDead() || to < 0 || int(to) >= l {
 		p.Enqueue(msg)
 		return
 	}
+	var arr []common.UserItem
 	switch mirGridType {
 	case common.MirGridTypeInventory:
-		index, item := p.GetUserItemByID(mirGridType, id)
-		if item == nil {
+		arr = p.Inventory
+	case common.MirGridTypeStorage:
+		if !p.isStorageOpen() {
 			p.Enqueue(msg)
 			return
 		}
-		p.Inventory[index] = p.Equipment[to]
-		p.Equipment[to] = *item
-	case common.MirGridTypeStorage:
-		// TODO
+		arr = p.Storage
+	default:
+		p.Enqueue(msg)
+		return
+	}
+	index := -1
+	for i := range arr {
+		if arr[i].ID == id {
+			index = i
+			break
+		}
 	}
+	if index == -1 {
+		p.Enqueue(msg)
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(arr[index].ItemID))
+	if info == nil || !IsCorrectSlot(info.Type, to) || !p.CanEquipItem(info, to) {
+		p.Enqueue(msg)
+		return
+	}
+	old := p.getLooks()
+	arr[index], p.Equipment[to] = p.Equipment[to], arr[index]
 	msg.Success = true
 	p.RefreshStats()
 	p.Enqueue(msg)
 	p.UpdateConcentration()
-	p.Broadcast(ServerMessage{}.PlayerUpdate(p))
+	p.broadcastLooks(old)
 }
 
 func (p *Player) RemoveItem(mirGridType common.MirGridType, id uint64, to int32) {
@@ -1207,38 +1670,36 @@ func (p *Player) RemoveItem(mirGridType common.MirGridType, id uint64, to int32)
 		To:       to,
 		Success:  false,
 	}
-	if l := len(p.Inventory); to < 0 || int(to) >= l {
+	index, item := p.GetUserItemByID(common.MirGridTypeEquipment, id)
+	if item == nil {
 		p.Enqueue(msg)
 		return
 	}
+	var arr []common.UserItem
 	switch mirGridType {
 	case common.MirGridTypeInventory:
-		index, item := p.GetUserItemByID(common.MirGridTypeEquipment, id)
-		if item == nil {
+		arr = p.Inventory
+	case common.MirGridTypeStorage:
+		if !p.isStorageOpen() {
 			p.Enqueue(msg)
 			return
 		}
-		invItem := p.Inventory[to]
-		if invItem.ID == 0 {
-			p.Inventory[to], p.Equipment[index] = p.Equipment[index], p.Inventory[to]
-			break
-		}
-		for i := range p.Inventory[6:] {
-			tmp := p.Inventory[6:][i]
-			if tmp.ID != 0 {
-				continue
-			}
-			p.Inventory[6:][i], p.Equipment[index] = p.Equipment[index], p.Inventory[6:][i]
-			break
-		}
-	case common.MirGridTypeStorage:
-		// TODO
+		arr = p.Storage
+	default:
+		p.Enqueue(msg)
+		return
+	}
+	if to < 0 || int(to) >= len(arr) || arr[to].ID != 0 {
+		p.Enqueue(msg)
+		return
 	}
+	old := p.getLooks()
+	arr[to], p.Equipment[index] = p.Equipment[index], arr[to]
 	msg.Success = true
 	p.RefreshStats()
 	p.Enqueue(msg)
 	p.UpdateConcentration()
-	p.Broadcast(ServerMessage{}.PlayerUpdate(p))
+	p.broadcastLooks(old)
 }
 
 func (p *Player) RemoveSlotItem(grid common.MirGridType, id uint64, to int32, to2 common.MirGridType) {
@@ -1329,11 +1790,27 @@ func (p *Player) UseItem(id uint64) {
 			p.ChangeHP(int(info.HP))
 			p.ChangeMP(int(info.MP))
 		case 2: // TODO MysteryWater
-		case 3: // TODO Buff
-		case 4: // TODO Exp 经验
+		case 3: // Buff 增益药水
+			if !p.useBuffPotion(item, info) {
+				p.Enqueue(msg)
+				return
+			}
+		case 4: // Exp 经验
+			if !p.useExpPotion(item, info) {
+				p.Enqueue(msg)
+				return
+			}
 		}
 	case common.ItemTypeScroll:
+		if !p.useScroll(info) {
+			p.Enqueue(msg)
+			return
+		}
 	case common.ItemTypeBook:
+		if !p.useBook(info) {
+			p.Enqueue(msg)
+			return
+		}
 	case common.ItemTypeScript:
 	case common.ItemTypeFood:
 	case common.ItemTypePets:
@@ -1343,7 +1820,7 @@ func (p *Player) UseItem(id uint64) {
 		return
 	}
 	if item.Count > 1 {
-		item.Count--
+		p.Inventory[index].Count--
 	} else {
 		p.Inventory[index] = common.UserItem{}
 	}
@@ -1422,7 +1899,13 @@ func (p *Player) PickUp() {
 
 func (p *Player) Inspect(id uint32) {
 	o := p.Map.Env.GetPlayer(id)
+	if o == nil {
+		return
+	}
 	for i := range o.Equipment {
+		if o.Equipment[i].ID == 0 {
+			continue
+		}
 		item := p.Map.Env.GameDB.GetItemInfoByID(int(o.Equipment[i].ItemID))
 		if item != nil {
 			p.EnqueueItemInfo(item.ID)
@@ -1435,10 +1918,6 @@ func (p *Player) ChangeAMode(mode common.AttackMode) {
 
 }
 
-func (p *Player) ChangePMode(mode common.AttackMode) {
-
-}
-
 func (p *Player) ChangeTrade(trade bool) {
 
 }
@@ -1448,33 +1927,50 @@ func (p *Player) Attack(direction common.MirDirection, spell common.Spell) {
 		p.Enqueue(ServerMessage{}.UserLocation(p))
 		return
 	}
+	spell, magic := p.attackSpell(spell)
+	level := 0
+	if magic != nil {
+		level = magic.Level
+	}
 	p.CurrentDirection = direction
 	p.Enqueue(ServerMessage{}.UserLocation(p))
-	p.Broadcast(ServerMessage{}.ObjectAttack(p, common.SpellNone, 0, 0))
+	p.Broadcast(ServerMessage{}.ObjectAttack(p, spell, level, 0))
 	target := p.GetPoint().NextPoint(p.GetDirection(), 1)
 	damageBase := p.GetAttackPower(int(p.MinDC), int(p.MaxDC)) // = the original damage from your gear (+ bonus from moonlight and darkbody)
 	damageFinal := damageBase                                  // = the damage you're gonna do with skills added
-	cell := p.Map.GetCell(target)
-	if !cell.CanWalk() {
-		return
-	}
-	cell.Objects.Range(func(k, v interface{}) bool {
-		o := v.(IMapObject)
-		if !o.IsAttackTarget(p) {
-			return true
+	damageBase = p.stealthDamage(damageBase)
+	damageFinal = damageBase
+	switch spell {
+	case common.SpellSlaying, common.SpellFlamingSword:
+		// 攻杀和烈火只对正前方的目标加成，用过一次后关闭
+		damageFinal = magic.GetDamage(damageBase)
+		p.setToggle(spell, false)
+	case common.SpellTwinDrakeBlade:
+		p.setToggle(spell, false)
+	}
+	bleed := p.hemorrhage()
+	if bleed != nil {
+		damageFinal += int(float32(damageFinal) * bleed.GetMultiplier())
+	}
+	if p.attackCell(target, damageFinal) {
+		if spell == common.SpellSlaying || spell == common.SpellFlamingSword {
+			p.LevelMagic(magic)
 		}
-		switch o.GetRace() {
-		case common.ObjectTypePlayer:
-			o.(*Player).Attacked(p, damageFinal, common.DefenceTypeAgility, false)
-		case common.ObjectTypeMonster:
-			o.(*Monster).Attacked(p, damageFinal, common.DefenceTypeAgility, false)
+		if fencing := p.GetMagic(common.SpellFencing); fencing != nil {
+			p.LevelMagic(fencing)
 		}
-		return true
-	})
-}
-
-func (p *Player) RangeAttack(direction common.MirDirection, location common.Point, id uint32) {
-
+		if fatal := p.GetMagic(common.SpellFatalSword); fatal != nil {
+			p.LevelMagic(fatal)
+		}
+		if bleed != nil {
+			p.bleed(target, bleed, damageFinal)
+		}
+		p.mpEater()
+	}
+	if magic != nil {
+		p.attackSkill(spell, magic, damageBase)
+	}
+	p.rollSlaying()
 }
 
 func (p *Player) Harvest(direction common.MirDirection) {
@@ -1486,6 +1982,7 @@ func (p *Player) CallNPC(id uint32, key string) {
 	if npc == nil {
 		return
 	}
+	p.CallingNPC = npc
 	say, err := npc.CallScript(p, key)
 	if err != nil {
 		log.Warnf("NPC 脚本执行失败: %d %s %s\n", id, key, err.Error())
@@ -1497,11 +1994,32 @@ func (p *Player) CallNPC(id uint32, key string) {
 	switch strings.ToUpper(key) {
 	case "[@BUY]":
 		sendBuyKey(p, npc)
+	case "[@PEARLBUY]":
+		sendPearlBuyKey(p, npc)
 	case "[@SELL]":
 		p.Enqueue(&server.NPCSell{})
 	case "[@BUYSELL]":
 		sendBuyKey(p, npc)
 		p.Enqueue(&server.NPCSell{})
+	case "[@BUYBACK]":
+		sendBuyBackKey(p, npc)
+	case "[@REPAIR]":
+		p.Enqueue(&server.NPCRepair{Rate: npc.Rate})
+	case "[@SREPAIR]":
+		p.Enqueue(&server.NPCSRepair{Rate: npc.Rate * 3})
+	case "[@CRAFT]":
+		sendCraftKey(p, npc)
+	case "[@AWAKENING]":
+		p.Enqueue(&server.NPCAwakening{})
+	case "[@DISASSEMBLE]":
+		p.Enqueue(&server.NPCDisassemble{})
+	case "[@DOWNGRADE]":
+		p.Enqueue(&server.NPCDowngrade{})
+	case "[@RESET]":
+		p.Enqueue(&server.NPCReset{})
+	case "[@STORAGE]":
+		p.SendStorage()
+		p.Enqueue(&server.NPCStorage{})
 	default:
 		// TODO
 	}
@@ -1509,45 +2027,101 @@ func (p *Player) CallNPC(id uint32, key string) {
 
 func sendBuyKey(p *Player, npc *NPC) {
 	p.CallingNPC = npc
+	p.UsePearls = false
 
-	goods := npc.Goods
-	if len(goods) != 0 {
-		p.Enqueue(&server.NPCGoods{
-			Goods: goods,
-			Rate:  1.0,
-			Type:  common.PanelTypeBuy,
-		})
-		return
+	npc.InitGoods()
+	for i := range npc.Goods {
+		p.EnqueueItemInfo(npc.Goods[i].ItemID)
 	}
 
-	for _, name := range npc.Script.Goods {
-		res := strings.Split(name, " ")
-		name := res[0]
-		count := 1
-		if len(res) == 2 {
-			c, err := strconv.Atoi(res[1])
-			if err != nil {
-				log.Warnf("Good name err: %s\n", name)
+	p.Enqueue(&server.NPCGoods{
+		Goods: npc.Goods,
+		Rate:  npc.Rate,
+		Type:  common.PanelTypeBuy,
+	})
+}
+
+// sendPearlBuyKey 珍珠商店，价格为 ItemInfo.Price 个珍珠
+func sendPearlBuyKey(p *Player, npc *NPC) {
+	p.CallingNPC = npc
+	p.UsePearls = true
+
+	npc.InitGoods()
+	for i := range npc.Goods {
+		p.EnqueueItemInfo(npc.Goods[i].ItemID)
+	}
+
+	p.Enqueue(&server.NPCPearlGoods{
+		Goods: npc.Goods,
+		Rate:  npc.Rate,
+		Type:  common.PanelTypeBuy,
+	})
+}
+
+func sendBuyBackKey(p *Player, npc *NPC) {
+	goods := npc.BuyBack[p.Name]
+	for i := range goods {
+		p.EnqueueItemInfo(goods[i].ItemID)
+	}
+	p.Enqueue(&server.NPCGoods{
+		Goods: goods,
+		Rate:  1.0,
+		Type:  common.PanelTypeBuy,
+	})
+}
+
+func sendCraftKey(p *Player, npc *NPC) {
+	p.CallingNPC = npc
+
+	gdb := p.Map.Env.GameDB
+	if len(npc.Crafts) == 0 && npc.Script != nil {
+		for _, name := range npc.Script.Recipes {
+			item := gdb.GetItemInfoByName(name)
+			if item == nil || gdb.GetRecipeInfoByName(name) == nil {
+				log.Warnf("Recipe name err: %s\n", name)
 				continue
 			}
-			count = c
+			npc.Crafts = append(npc.Crafts, *p.Map.Env.NewUserItem(item))
 		}
-		item := p.Map.Env.GameDB.GetItemInfoByName(name)
-		if item == nil {
-			log.Warnf("Good name err: %s\n", name)
-			continue
+	}
+
+	for i := range npc.Crafts {
+		craft := npc.Crafts[i]
+		item := gdb.GetItemInfoByID(int(craft.ItemID))
+		recipe := gdb.GetRecipeInfoByName(item.Name)
+		info := common.ClientRecipeInfo{
+			Gold:        uint32(recipe.Gold),
+			Chance:      uint8(recipe.Chance),
+			Item:        craft,
+			Tools:       make([]common.UserItem, 0),
+			Ingredients: make([]common.UserItem, 0),
+		}
+		info.Item.Count = recipe.Amount
+		p.EnqueueItemInfo(craft.ItemID)
+		for _, tool := range recipe.Tools {
+			ti := gdb.GetItemInfoByName(tool.ItemName)
+			ui := p.Map.Env.NewUserItem(ti)
+			ui.Count = tool.Count
+			p.EnqueueItemInfo(ti.ID)
+			info.Tools = append(info.Tools, *ui)
 		}
-		p.EnqueueItemInfo(item.ID)
-		g := p.Map.Env.NewUserItem(item)
-		g.Count = uint32(count)
-		goods = append(goods, *g)
-		npc.Goods = goods
+		for _, ing := range recipe.Ingredients {
+			ii := gdb.GetItemInfoByName(ing.ItemName)
+			ui := p.Map.Env.NewUserItem(ii)
+			ui.Count = ing.Count
+			if ing.Dura > 0 {
+				ui.CurrentDura = ing.Dura
+			}
+			p.EnqueueItemInfo(ii.ID)
+			info.Ingredients = append(info.Ingredients, *ui)
+		}
+		p.Enqueue(&server.NewRecipeInfo{Info: info})
 	}
 
 	p.Enqueue(&server.NPCGoods{
-		Goods: goods,
+		Goods: npc.Crafts,
 		Rate:  1.0,
-		Type:  common.PanelTypeBuy,
+		Type:  common.PanelTypeCraft,
 	})
 }
 
@@ -1563,80 +2137,662 @@ func (p *Player) BuyItem(index uint64, count uint32, panelType common.PanelType)
 	if npc == nil {
 		return
 	}
+	if npc.GetBuyBackItemByID(p, index) >= 0 {
+		p.BuyItemBack(index, count)
+		return
+	}
 	npc.Buy(p, index, count)
 }
 
-func (p *Player) CraftItem() {
+// takeInventoryItem 从背包格子中扣除物品，并通知客户端
+func (p *Player) takeInventoryItem(index int, count uint32) {
+	ui := &p.Inventory[index]
+	p.Enqueue(&server.DeleteItem{UniqueID: ui.ID, Count: count})
+	if count >= ui.Count {
+		p.Inventory[index] = common.UserItem{}
+	} else {
+		ui.Count -= count
+	}
+}
+
+// inventorySlots 背包所有格子索引
+func (p *Player) inventorySlots() []int {
+	slots := make([]int, len(p.Inventory))
+	for i := range p.Inventory {
+		slots[i] = i
+	}
+	return slots
+}
+
+// findCraftItems 在背包指定格子中查找配方需要的物品，返回 背包索引->使用数量，不足时返回 nil
+func (p *Player) findCraftItems(slots []int, ing common.RecipeIngredient, times uint32, used map[int]uint32) map[int]uint32 {
+	info := p.Map.Env.GameDB.GetItemInfoByName(ing.ItemName)
+	need := ing.Count * times
+	res := make(map[int]uint32)
+	for _, i := range slots {
+		ui := p.Inventory[i]
+		if ui.ID == 0 || ui.ItemID != info.ID || (ing.Dura > 0 && ui.CurrentDura < ing.Dura) {
+			continue
+		}
+		// 客户端可能重复发送同一个格子，扣除之前已经占用的数量
+		left := ui.Count - used[i] - res[i]
+		if left == 0 {
+			continue
+		}
+		if left > need {
+			left = need
+		}
+		res[i] += left
+		need -= left
+		if need == 0 {
+			return res
+		}
+	}
+	return nil
+}
+
+// CraftItem 在 NPC 处按配方合成物品，slots 为客户端放入合成材料的背包格子
+func (p *Player) CraftItem(id uint64, count uint32, slots []int32) {
+	msg := &server.CraftItem{Success: false}
+	npc := p.CallingNPC
+	if p.IsDead() || npc == nil || count == 0 {
+		p.Enqueue(msg)
+		return
+	}
+	craft := npc.GetCraftItemByID(id)
+	if craft == nil {
+		p.Enqueue(msg)
+		return
+	}
+	gdb := p.Map.Env.GameDB
+	info := gdb.GetItemInfoByID(int(craft.ItemID))
+	recipe := gdb.GetRecipeInfoByName(info.Name)
+	if recipe == nil {
+		p.Enqueue(msg)
+		return
+	}
+	// 合成结果必须能放进一格，先限制数量，避免后面计算材料和产出数量时溢出
+	stack := info.StackSize
+	if stack == 0 {
+		stack = 1
+	}
+	if count > stack/recipe.Amount {
+		p.ReceiveChat("合成数量超过物品堆叠上限", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	gold := recipe.Gold * uint64(count)
+	if p.Gold < gold {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+
+	searchSlots := make([]int, 0, len(p.Inventory))
+	for _, s := range slots {
+		if s >= 0 && int(s) < len(p.Inventory) {
+			searchSlots = append(searchSlots, int(s))
+		}
+	}
+	if len(searchSlots) == 0 {
+		searchSlots = p.inventorySlots()
+	}
+
+	// 工具只需要持有，每次合成消耗持久
+	used := make(map[int]uint32)
+	tools := make([]int, 0, len(recipe.Tools))
+	for _, tool := range recipe.Tools {
+		found := p.findCraftItems(searchSlots, common.RecipeIngredient{ItemName: tool.ItemName, Count: 1, Dura: tool.Dura}, 1, used)
+		if found == nil {
+			p.ReceiveChat(fmt.Sprintf("缺少工具 %s", tool.ItemName), common.ChatTypeSystem)
+			p.Enqueue(msg)
+			return
+		}
+		for i, c := range found {
+			used[i] += c
+			tools = append(tools, i)
+		}
+	}
+	for _, ing := range recipe.Ingredients {
+		found := p.findCraftItems(searchSlots, ing, count, used)
+		if found == nil {
+			p.ReceiveChat(fmt.Sprintf("材料不足 %s", ing.ItemName), common.ChatTypeSystem)
+			p.Enqueue(msg)
+			return
+		}
+		for i, c := range found {
+			used[i] += c
+		}
+	}
+
+	result := p.Map.Env.NewRandomUserItem(info)
+	result.Count = recipe.Amount * count
+	if p.CurrentBagWeight+int(info.Weight)*int(result.Count) > int(p.MaxBagWeight) {
+		p.ReceiveChat("负重不足", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	if !p.CanGainItem(result) {
+		p.ReceiveChat("背包已满", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
 
+	p.TakeGold(gold)
+	for i, c := range used {
+		isTool := false
+		for _, t := range tools {
+			if t == i {
+				isTool = true
+				break
+			}
+		}
+		ui := &p.Inventory[i]
+		// 工具持久足够时只扣持久，否则工具损坏，只扣除一个
+		if isTool {
+			dura := uint32(count) * 1000
+			if uint32(ui.CurrentDura) > dura {
+				ui.CurrentDura -= uint16(dura)
+				p.Enqueue(&server.DuraChanged{UniqueID: ui.ID, CurrentDura: ui.CurrentDura})
+				c--
+			}
+		}
+		if c > 0 {
+			p.takeInventoryItem(i, c)
+		}
+	}
+	p.RefreshBagWeight()
+
+	// 每一份单独判定成功率，CraftRate 提高合成成功率
+	success := uint32(0)
+	for i := uint32(0); i < count; i++ {
+		if RandomNext(100) < recipe.Chance+int(p.CraftRate) {
+			success++
+		}
+	}
+	if success > 0 {
+		result.Count = recipe.Amount * success
+		msg.Success = p.GainItem(result)
+	}
+	if success < count {
+		p.ReceiveChat(fmt.Sprintf("%s 合成失败 %d 次", info.Name, count-success), common.ChatTypeSystem)
+	}
+	p.Enqueue(msg)
 }
 
+// SellItem 玩家把背包里的物品卖给 NPC
 func (p *Player) SellItem(id uint64, count uint32) {
+	msg := &server.SellItem{UniqueID: id, Count: count, Success: false}
+	npc := p.CallingNPC
+	if p.IsDead() || npc == nil || count == 0 {
+		p.Enqueue(msg)
+		return
+	}
+	index, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil || item.Count < count {
+		p.Enqueue(msg)
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil || common.BindMode(info.Bind)&common.BindModeDontSell != 0 {
+		p.ReceiveChat("该物品不能出售", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	if !npc.HasType(info.Type) {
+		p.ReceiveChat("这里不收购该类物品", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	sold := *item
+	if count < item.Count {
+		sold.ID = uint64(p.Map.Env.NewObjectID())
+		sold.Count = count
+		p.Inventory[index].Count -= count
+	} else {
+		p.Inventory[index] = common.UserItem{}
+	}
+	npc.Sell(p, sold)
+	p.RefreshBagWeight()
+	msg.Success = true
+	p.Enqueue(msg)
+	p.GainGold(sold.Price(info) / 2)
+}
 
+// repairItem 修理背包或身上的物品，特修会恢复最大持久并且价格更高
+func (p *Player) repairItem(id uint64, special bool) {
+	npc := p.CallingNPC
+	if p.IsDead() || npc == nil {
+		return
+	}
+	var item *common.UserItem
+	if index, ui := p.GetUserItemByID(common.MirGridTypeInventory, id); ui != nil {
+		item = &p.Inventory[index]
+	} else if index, ui := p.GetUserItemByID(common.MirGridTypeEquipment, id); ui != nil {
+		item = &p.Equipment[index]
+	}
+	if item == nil {
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info.Durability == 0 || !npc.HasType(info.Type) {
+		p.ReceiveChat("这里不能修理该类物品", common.ChatTypeSystem)
+		return
+	}
+	maxDura := item.MaxDura
+	if special {
+		if maxDura < info.Durability {
+			maxDura = info.Durability
+		}
+	} else {
+		maxDura -= (item.MaxDura - item.CurrentDura) / 30
+	}
+	if item.CurrentDura >= maxDura && item.MaxDura >= maxDura {
+		return
+	}
+	cost := uint64(float32(item.RepairPrice(info)) * npc.Rate)
+	if special {
+		cost *= 3
+	}
+	if p.Gold < cost {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	p.TakeGold(cost)
+	item.MaxDura = maxDura
+	item.CurrentDura = maxDura
+	p.Enqueue(&server.ItemRepaired{UniqueID: item.ID, MaxDura: item.MaxDura, CurrentDura: item.CurrentDura})
+	p.RefreshStats()
 }
 
+// RepairItem 普通修理，会损失部分最大持久
 func (p *Player) RepairItem(id uint64) {
-
+	p.repairItem(id, false)
 }
 
+// BuyItemBack 从 NPC 回购卖出的物品，价格与卖出时相同
 func (p *Player) BuyItemBack(id uint64, count uint32) {
-
+	npc := p.CallingNPC
+	if p.IsDead() || npc == nil {
+		return
+	}
+	i := npc.GetBuyBackItemByID(p, id)
+	if i < 0 {
+		return
+	}
+	list := npc.BuyBack[p.Name]
+	item := list[i]
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	price := item.Price(info) / 2
+	if p.Gold < price {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	if !p.CanGainItem(&item) {
+		p.ReceiveChat("背包已满", common.ChatTypeSystem)
+		return
+	}
+	npc.BuyBack[p.Name] = append(list[:i], list[i+1:]...)
+	p.TakeGold(price)
+	p.GainItem(&item)
+	sendBuyBackKey(p, npc)
 }
 
+// SRepairItem 特殊修理
 func (p *Player) SRepairItem(id uint64) {
+	p.repairItem(id, true)
+}
 
+// CombineItem 把宝石或修理工具合到背包里的装备上
+func (p *Player) CombineItem(idFrom, idTo uint64) {
+	msg := &server.CombineItem{IDFrom: idFrom, IDTo: idTo}
+	if p.IsDead() {
+		p.Enqueue(msg)
+		return
+	}
+	fromIndex, from := p.GetUserItemByID(common.MirGridTypeInventory, idFrom)
+	toIndex, to := p.GetUserItemByID(common.MirGridTypeInventory, idTo)
+	if from == nil || to == nil || fromIndex == toIndex {
+		p.Enqueue(msg)
+		return
+	}
+	gdb := p.Map.Env.GameDB
+	fromInfo := gdb.GetItemInfoByID(int(from.ItemID))
+	toInfo := gdb.GetItemInfoByID(int(to.ItemID))
+	if fromInfo.Type != common.ItemTypeGem || !CanGem(fromInfo, toInfo) {
+		p.Enqueue(msg)
+		return
+	}
+	target := &p.Inventory[toIndex]
+	switch fromInfo.Shape {
+	case 1, 2: // 修理锤 / 缝补工具
+		if target.CurrentDura >= target.MaxDura {
+			p.ReceiveChat("物品不需要修理", common.ChatTypeSystem)
+			p.Enqueue(msg)
+			return
+		}
+		target.CurrentDura = target.MaxDura
+	case 3, 4: // 宝石 / 宝珠
+		if target.GemCount >= fromInfo.CriticalDamage {
+			p.ReceiveChat("物品镶嵌宝石已达上限", common.ChatTypeSystem)
+			p.Enqueue(msg)
+			return
+		}
+		chance := int(fromInfo.CriticalRate) - int(fromInfo.Reflect)*int(target.GemCount)
+		if RandomNext(100) >= chance {
+			p.takeInventoryItem(fromIndex, 1)
+			msg.Destroy = RandomNext(100) < int(fromInfo.HpDrainRate)
+			if msg.Destroy {
+				p.ReceiveChat(fmt.Sprintf("镶嵌失败，%s 损坏了", toInfo.Name), common.ChatTypeSystem)
+				p.Inventory[toIndex] = common.UserItem{}
+			} else {
+				p.ReceiveChat("镶嵌失败", common.ChatTypeSystem)
+			}
+			p.RefreshBagWeight()
+			p.Enqueue(msg)
+			return
+		}
+		addGemStats(target, fromInfo)
+		target.GemCount++
+	default:
+		p.Enqueue(msg)
+		return
+	}
+	p.takeInventoryItem(fromIndex, 1)
+	p.RefreshBagWeight()
+	msg.Success = true
+	p.Enqueue(msg)
+	p.Enqueue(&server.ItemUpgraded{Item: *target})
 }
 
-func (p *Player) Magic(spell common.Spell, direction common.MirDirection, targetID uint32, targetLocation common.Point) {
-	if !p.CanCast() {
-		p.Enqueue(ServerMessage{}.UserLocation(p))
+// AwakeningNeedMaterials 觉醒到下一级需要的材料
+func (p *Player) AwakeningNeedMaterials(id uint64, typ common.AwakeType) {
+	msg := &server.AwakeningNeedMaterials{
+		Materials:      make([]common.ItemInfo, 0),
+		MaterialsCount: make([]int, 0),
+	}
+	_, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil {
+		p.Enqueue(msg)
+		return
+	}
+	gdb := p.Map.Env.GameDB
+	info := gdb.GetItemInfoByID(int(item.ItemID))
+	if !CanAwake(info, typ) || item.AwakeLevel >= MaxAwakeLevel {
+		p.Enqueue(msg)
 		return
 	}
+	materials, counts := gdb.AwakeMaterials(item, info, typ)
+	for i := range materials {
+		p.EnqueueItemInfo(materials[i].ID)
+		msg.Materials = append(msg.Materials, *materials[i])
+		msg.MaterialsCount = append(msg.MaterialsCount, int(counts[i]))
+	}
+	p.Enqueue(msg)
+}
+
+func (p *Player) AwakeningLockedItem(id uint64, locked bool) {
+	p.Enqueue(&server.AwakeningLockedItem{UniqueID: id, Locked: locked})
+}
+
+// Awakening 觉醒背包里的装备，成功提升一级，失败可能降一级
+func (p *Player) Awakening(id uint64, typ common.AwakeType) {
+	msg := &server.Awakening{Result: -1, RemoveID: -1}
+	if p.IsDead() || p.CallingNPC == nil {
+		p.Enqueue(msg)
+		return
+	}
+	index, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil {
+		p.Enqueue(msg)
+		return
+	}
+	gdb := p.Map.Env.GameDB
+	info := gdb.GetItemInfoByID(int(item.ItemID))
+	if !CanAwake(info, typ) {
+		p.Enqueue(msg)
+		return
+	}
+	if item.AwakeType != common.AwakeTypeNone && item.AwakeType != typ {
+		p.ReceiveChat("只能继续觉醒相同的类型", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	if item.AwakeLevel >= MaxAwakeLevel {
+		p.ReceiveChat("觉醒已达到最高等级", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	materials, counts := gdb.AwakeMaterials(item, info, typ)
+	if materials == nil {
+		p.Enqueue(msg)
+		return
+	}
+	slots := p.inventorySlots()
+	used := make(map[int]uint32)
+	for i := range materials {
+		found := p.findCraftItems(slots, common.RecipeIngredient{ItemName: materials[i].Name, Count: counts[i]}, 1, used)
+		if found == nil {
+			p.ReceiveChat(fmt.Sprintf("材料不足 %s", materials[i].Name), common.ChatTypeSystem)
+			p.Enqueue(msg)
+			return
+		}
+		for j, c := range found {
+			used[j] += c
+		}
+	}
+	for j, c := range used {
+		p.takeInventoryItem(j, c)
+	}
+
+	ui := &p.Inventory[index]
+	if RandomNext(100) < awakeChance[ui.AwakeLevel] {
+		ui.AwakeType = typ
+		ui.AwakeLevel++
+		ui.AwakeValue += AwakeValue(info)
+		msg.Result = 1
+	} else if ui.AwakeLevel > 0 && RandomNext(AwakeFailDowngradeIn) == 0 {
+		downgradeAwake(ui)
+		msg.Result = 0
+	} else {
+		msg.Result = 2
+	}
+	p.RefreshBagWeight()
+	p.Enqueue(&server.ItemUpgraded{Item: *ui})
+	p.Enqueue(msg)
+}
+
+// downgradeAwake 觉醒等级降一级
+func downgradeAwake(ui *common.UserItem) {
+	if ui.AwakeLevel == 0 {
+		return
+	}
+	ui.AwakeValue -= ui.AwakeValue / ui.AwakeLevel
+	ui.AwakeLevel--
+	if ui.AwakeLevel == 0 {
+		ui.AwakeType = common.AwakeTypeNone
+		ui.AwakeValue = 0
+	}
+}
+
+// DowngradeAwakening 花费金币降低一级觉醒
+func (p *Player) DowngradeAwakening(id uint64) {
+	if p.IsDead() || p.CallingNPC == nil {
+		return
+	}
+	index, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil || item.AwakeLevel == 0 {
+		return
+	}
+	gold := uint64(AwakeDowngradeGold) * uint64(item.AwakeLevel)
+	if p.Gold < gold {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	p.TakeGold(gold)
+	ui := &p.Inventory[index]
+	downgradeAwake(ui)
+	p.Enqueue(&server.ItemUpgraded{Item: *ui})
+}
+
+// DisassembleItem 分解装备，得到觉醒材料
+func (p *Player) DisassembleItem(id uint64) {
+	if p.IsDead() || p.CallingNPC == nil {
+		return
+	}
+	index, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil {
+		return
+	}
+	env := p.Map.Env
+	info := env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if !info.CanAwakening {
+		p.ReceiveChat("该物品不能分解", common.ChatTypeSystem)
+		return
+	}
+	gold := uint64(info.Price / DisassembleGoldRate)
+	if p.Gold < gold {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	grade := strconv.Itoa(awakeGrade(info))
+	results := make([]*common.UserItem, 0, 2)
+	if soul := env.GameDB.GetItemInfoByName(awakeSoulName + grade); soul != nil {
+		results = append(results, env.NewUserItem(soul))
+	}
+	if name, ok := awakeGlyphNames[item.AwakeType]; ok && item.AwakeLevel > 0 {
+		if glyph := env.GameDB.GetItemInfoByName(name + grade); glyph != nil {
+			ui := env.NewUserItem(glyph)
+			ui.Count = uint32(item.AwakeLevel)
+			results = append(results, ui)
+		}
+	}
+	for _, ui := range results {
+		if !p.CanGainItem(ui) {
+			p.ReceiveChat("背包已满", common.ChatTypeSystem)
+			return
+		}
+	}
+	p.TakeGold(gold)
+	p.takeInventoryItem(index, item.Count)
+	for _, ui := range results {
+		p.GainItem(ui)
+	}
+	p.RefreshBagWeight()
+}
+
+// ResetAddedItem 花费金币清除物品的附加属性、宝石和觉醒
+func (p *Player) ResetAddedItem(id uint64) {
+	if p.IsDead() || p.CallingNPC == nil {
+		return
+	}
+	index, item := p.GetUserItemByID(common.MirGridTypeInventory, id)
+	if item == nil {
+		return
+	}
+	if p.Gold < ResetAddedItemGold {
+		p.ReceiveChat("金币不足", common.ChatTypeSystem)
+		return
+	}
+	p.TakeGold(ResetAddedItemGold)
+	old := p.Inventory[index]
+	p.Inventory[index] = common.UserItem{
+		ID:          old.ID,
+		ItemID:      old.ItemID,
+		CurrentDura: old.CurrentDura,
+		MaxDura:     old.MaxDura,
+		Count:       old.Count,
+		SoulBoundId: old.SoulBoundId,
+		Bools:       old.Bools,
+	}
+	p.Enqueue(&server.ItemUpgraded{Item: p.Inventory[index]})
+}
+
+func (p *Player) Magic(spell common.Spell, direction common.MirDirection, targetID uint32, targetLocation common.Point) {
 	userMagic := p.GetMagic(spell)
-	if userMagic == nil {
+	if userMagic == nil || !p.CanCast(userMagic) {
 		p.Enqueue(ServerMessage{}.UserLocation(p))
 		return
 	}
 	info := p.Map.Env.GameDB.GetMagicInfoByID(userMagic.MagicID)
 	cost := info.BaseCost + info.LevelCost*userMagic.Level
+	if p.GetBuff(common.BuffTypeMagicBooster) != nil {
+		if booster := p.GetMagic(common.SpellMagicBooster); booster != nil {
+			cost += cost * (6 + booster.Level) / 100
+		}
+	}
 	if uint16(cost) > p.MP {
 		p.Enqueue(ServerMessage{}.UserLocation(p))
 		return
 	}
 	p.CurrentDirection = direction
 	p.ChangeMP(-cost)
+	p.SpellTime = time.Now().Add(SpellDelay)
 	target := p.Map.GetObjectInAreaByID(targetID, targetLocation)
-	cast, targetID := p.UseMagic(spell, userMagic, target)
+	cast, targetID := p.UseMagic(spell, userMagic, target, targetLocation)
+	if cast {
+		userMagic.CastTime = common.NowMillis()
+		p.Enqueue(&server.MagicCast{Spell: spell})
+	}
 	p.Enqueue(ServerMessage{}.UserLocation(p))
 	p.Enqueue(ServerMessage{}.Magic(spell, targetID, targetLocation, cast, userMagic.Level))
 	p.Broadcast(ServerMessage{}.ObjectMagic(p, spell, targetID, targetLocation, cast, userMagic.Level))
 }
 
+// MagicKey 设置技能快捷键，同一个键只能绑定一个技能
 func (p *Player) MagicKey(spell common.Spell, key uint8) {
-
-}
-
-func (p *Player) SwitchGroup(group bool) {
-
-}
-
-func (p *Player) AddMember(name string) {
-
-}
-
-func (p *Player) DelMember(name string) {
-
-}
-
-func (p *Player) GroupInvite(invite bool) {
-
+	for i := range p.Magics {
+		um := &p.Magics[i]
+		if um.Spell == spell {
+			um.Key = int(key)
+		} else if key != 0 && um.Key == int(key) {
+			um.Key = 0
+		}
+	}
 }
 
+// TownRevive 死亡后回到回城点复活，恢复满血满蓝
 func (p *Player) TownRevive() {
-
+	if !p.IsDead() {
+		return
+	}
+	m, bind := p.BindLocation()
+	if m == nil {
+		return
+	}
+	p.Dead = false
+	p.SetHP(uint32(p.MaxHP))
+	p.SetMP(uint32(p.MaxMP))
+	p.Enqueue(&server.Revived{})
+	pt, err := m.GetValidPoint(int(bind.X), int(bind.Y), 10)
+	if err != nil || !p.Teleport(m, pt) {
+		p.Broadcast(&server.ObjectRevived{ObjectID: p.GetID(), Effect: false})
+	}
 }
 
+// SpellToggle 客户端开关技能，双龙斩和烈火剑法开启时消耗魔法
 func (p *Player) SpellToggle(spell common.Spell, use bool) {
-
+	magic := p.GetMagic(spell)
+	if magic == nil {
+		return
+	}
+	switch spell {
+	case common.SpellThrusting, common.SpellHalfMoon, common.SpellCrossHalfMoon, common.SpellDoubleSlash:
+		p.setToggle(spell, use)
+	case common.SpellTwinDrakeBlade:
+		if p.Toggles.TwinDrakeBlade || !p.costMagic(magic) {
+			return
+		}
+		p.setToggle(spell, true)
+		p.Broadcast(ServerMessage{}.ObjectMagic(p, spell, 0, p.CurrentLocation, true, magic.Level))
+	case common.SpellFlamingSword:
+		now := time.Now()
+		if p.Toggles.FlamingSword || now.Before(p.Toggles.FlamingSwordTime) || !p.costMagic(magic) {
+			return
+		}
+		p.Toggles.FlamingSwordTime = now.Add(FlamingSwordDuration)
+		p.setToggle(spell, true)
+	}
 }
 
 func (p *Player) ConsignItem(id uint64, price uint32) {
@@ -1663,14 +2819,6 @@ func (p *Player) MarketGetBack(id uint64) {
 
 }
 
-func (p *Player) RequestUserName(id uint32) {
-
-}
-
-func (p *Player) RequestChatItem(id uint64) {
-
-}
-
 func (p *Player) EditGuildMember(name string, name2 string, index uint8, changeType uint8) {
 
 }
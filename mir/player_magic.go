@@ -4,14 +4,17 @@ import (
 	"time"
 
 	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
 )
 
+// SpellDelay 公共施法冷却，两次施法之间的最短间隔
+const SpellDelay = 1800 * time.Millisecond
+
 // GetMagic ...
 func (p *Player) GetMagic(spell common.Spell) *common.UserMagic {
 	for i := range p.Magics {
-		userMagic := p.Magics[i]
-		if userMagic.Spell == spell {
-			return &userMagic
+		if p.Magics[i].Spell == spell {
+			return &p.Magics[i]
 		}
 	}
 	return nil
@@ -29,13 +32,21 @@ func (p *Player) GetClientMagics() []common.ClientMagic {
 	return res
 }
 
-// LevelMagic ...
+// LevelMagic 技能增加 1~3 点熟练度，人物等级和熟练度都达到要求时技能升级
 func (p *Player) LevelMagic(userMagic *common.UserMagic) {
-
+	trained, leveled := userMagic.Train(int(p.Level), RandomNext(3)+1)
+	if !trained {
+		return
+	}
+	if leveled {
+		p.Enqueue(&server.MagicDelay{Spell: userMagic.Spell, Delay: int64(userMagic.GetDelay())})
+		p.RefreshStats()
+	}
+	p.Enqueue(&server.MagicLeveled{Spell: userMagic.Spell, Level: uint8(userMagic.Level), Experience: uint16(userMagic.Experience)})
 }
 
 // UseMagic ...
-func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IMapObject) (cast bool, targetID uint32) {
+func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IMapObject, location common.Point) (cast bool, targetID uint32) {
 	cast = true
 	switch spell {
 	case common.SpellFireBall, common.SpellGreatFireBall, common.SpellFrostCrunch:
@@ -72,7 +83,7 @@ func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IM
 		p.SummonSkeleton(magic)
 	case common.SpellTeleport, common.SpellBlink:
 		// ActionList.Add(new DelayedAction(DelayedType.Magic, Envir.Time + 200, magic, location));
-		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, p.GetPoint()))
+		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, location))
 		p.ActionList.Store(action.ID, action)
 	case common.SpellHiding:
 		p.Hiding(magic)
@@ -80,35 +91,35 @@ func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IM
 		// ActionList.Add(new DelayedAction(DelayedType.Magic, Envir.Time + 500, magic));
 		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
 		p.ActionList.Store(action.ID, action)
+	case common.SpellMoonLight, common.SpellDarkBody:
+		p.Stealth(magic)
+	case common.SpellPoisonSword:
+		p.PoisonSword(magic)
 	case common.SpellFury:
 		cast = p.FurySpell(magic)
 	case common.SpellImmortalSkin:
 		cast = p.ImmortalSkin(magic)
 	case common.SpellFireBang, common.SpellIceStorm:
 		// FireBang(magic, target == null ? location : target.CurrentLocation);
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		p.FireBang(magic, location)
 	case common.SpellMassHiding:
 		// MassHiding(magic, target == null ? location : target.CurrentLocation, out cast);
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.MassHiding(magic, location)
 	case common.SpellSoulShield, common.SpellBlessedArmour:
 		// SoulShield(magic, target == null ? location : target.CurrentLocation, out cast);
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.SoulShield(magic, location)
 	case common.SpellFireWall:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		p.FireWall(magic, location)
 	case common.SpellLightning:
@@ -116,22 +127,18 @@ func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IM
 	case common.SpellHeavenlySword:
 		p.HeavenlySword(magic)
 	case common.SpellMassHealing:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		p.MassHealing(magic, location)
 	case common.SpellShoulderDash:
 		p.ShoulderDash(magic)
 	case common.SpellThunderStorm, common.SpellFlameField, common.SpellStormEscape:
-		/*
-			ThunderStorm(magic);
-			if (spell == Spell.FlameField)
-				SpellTime = Envir.Time + 2500; //Spell Delay
-			if (spell == Spell.StormEscape)
-				//Start teleport.
-				ActionList.Add(new DelayedAction(DelayedType.Magic, Envir.Time + 750, magic, location));
-		*/
+		p.ThunderStorm(magic)
+		if spell == common.SpellStormEscape {
+			action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, location))
+			p.ActionList.Store(action.ID, action)
+		}
 	case common.SpellMagicShield:
 		// ActionList.Add(new DelayedAction(DelayedType.Magic, Envir.Time + 500, magic, magic.GetPower(GetAttackPower(MinMC, MaxMC) + 15)));
 		action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, magic.GetPower(p.GetAttackPower(int(p.MinMC), int(p.MaxMC))+15)))
@@ -147,74 +154,104 @@ func (p *Player) UseMagic(spell common.Spell, magic *common.UserMagic, target IM
 	case common.SpellSummonShinsu:
 		p.SummonShinsu(magic)
 	case common.SpellPurification:
-		/*
-			if (target == null)
-			{
-				target = this;
-				targetID = ObjectID;
-			}
-			Purification(target, magic);
-		*/
+		if target == nil {
+			target = p
+			targetID = p.GetID()
+		}
+		p.Purification(target, magic)
 	case common.SpellLionRoar, common.SpellBattleCry:
 		// CurrentMap.ActionList.Add(new DelayedAction(DelayedType.Magic, Envir.Time + 500, this, magic, CurrentLocation));
+		p.LionRoar(magic)
 	case common.SpellRevelation:
 		p.Revelation(target, magic)
 	case common.SpellPoisonCloud:
-		cast = p.PoisonCloud(magic, p.GetPoint())
+		cast = p.PoisonCloud(magic, location)
 	case common.SpellEntrapment:
-		p.Entrapment(target, magic)
+		cast = p.Entrapment(target, magic)
 	case common.SpellBladeAvalanche:
 		p.BladeAvalanche(magic)
 	case common.SpellSlashingBurst:
 		cast = p.SlashingBurst(magic)
 	case common.SpellRage:
-		p.Rage(magic)
+		cast = p.Rage(magic)
 	case common.SpellMirroring:
 		p.Mirroring(magic)
+	case common.SpellFastMove: // 被动技能，不能主动施放
+		cast = false
+	case common.SpellFlashDash:
+		p.FlashDash(magic)
+	case common.SpellTrap:
+		cast = p.Trap(target, magic)
+	case common.SpellSwiftFeet:
+		cast = p.SwiftFeet(magic)
+	case common.SpellCrescentSlash:
+		p.CrescentSlash(magic)
+	case common.SpellStraightShot, common.SpellElementalShot, common.SpellVampireShot, common.SpellPoisonShot, common.SpellCrippleShot, common.SpellDelayedExplosion:
+		if !p.shootMagic(target, magic, 1) {
+			targetID = 0
+			cast = false
+		}
+	case common.SpellDoubleShot:
+		if !p.shootMagic(target, magic, 2) {
+			targetID = 0
+			cast = false
+		}
+	case common.SpellBindingShot:
+		cast = p.BindingShot(target, magic)
+	case common.SpellExplosiveTrap:
+		cast = p.ExplosiveTrap(magic)
+	case common.SpellBackStep:
+		cast = p.BackStep(magic)
+	case common.SpellConcentration:
+		cast = p.Concentration(magic)
+	case common.SpellElementalBarrier:
+		cast = p.ElementalBarrier(magic)
+	case common.SpellMentalState:
+		p.MentalState(magic)
+	case common.SpellNapalmShot:
+		cast = p.NapalmShot(target, magic, location)
+	case common.SpellOneWithNature:
+		cast = p.OneWithNature(target, magic, location)
+	case common.SpellSummonVampire, common.SpellSummonToad, common.SpellSummonSnakes:
+		p.summonPet(magic)
 	case common.SpellBlizzard:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.Blizzard(magic, location)
 	case common.SpellMeteorStrike:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.MeteorStrike(magic, location)
 	case common.SpellIceThrust:
 		p.IceThrust(magic)
 	case common.SpellProtectionField:
-		p.ProtectionField(magic)
+		cast = p.ProtectionField(magic)
 	case common.SpellPetEnhancer:
 		cast = p.PetEnhancer(target, magic)
 	case common.SpellTrapHexagon:
 		cast = p.TrapHexagon(magic, target)
 	case common.SpellReincarnation:
 		// Reincarnation(magic, target == null ? null : target as PlayerObject, out cast);
-		if target != nil {
-			target = p
-		}
+		target, _ := target.(*Player)
 		cast = p.Reincarnation(magic, target)
 	case common.SpellCurse:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.Curse(magic, location)
 	case common.SpellSummonHolyDeva:
 		p.SummonHolyDeva(magic)
 	case common.SpellHallucination:
-		p.Hallucination(target, magic)
+		cast = p.Hallucination(target, magic)
 	case common.SpellEnergyShield:
 		cast = p.EnergyShield(target, magic)
 	case common.SpellUltimateEnhancer:
 		cast = p.UltimateEnhancer(target, magic)
 	case common.SpellPlague:
-		location := target.GetPoint()
-		if target == nil {
-			location = p.GetPoint()
+		if target != nil {
+			location = target.GetPoint()
 		}
 		cast = p.Plague(magic, location)
 	default:
@@ -233,70 +270,78 @@ func (p *Player) CompleteMagic(args ...interface{}) {
 		if target == nil || !target.IsAttackTarget(p) {
 			return
 		}
-		if target.GetRace() == common.ObjectTypePlayer {
-			target.(*Player).Attacked(p, value, common.DefenceTypeMAC, false)
-		} else if target.GetRace() == common.ObjectTypeMonster {
-			target.(*Monster).Attacked(p, value, common.DefenceTypeMAC, false)
+		if spellAttack(target, p, value, common.DefenceTypeMAC) > 0 {
+			p.LevelMagic(userMagic)
 		}
 		return
 	case common.SpellFrostCrunch:
+		value := args[1].(int)
+		target := args[2].(IMapObject)
+		if target == nil || !target.IsAttackTarget(p) {
+			return
+		}
+		if spellAttack(target, p, value, common.DefenceTypeMAC) > 0 {
+			p.LevelMagic(userMagic)
+			p.freeze(target, userMagic)
+		}
 	case common.SpellVampirism:
-		// value = args[1].(int)
-		// target = args[2].(IMapObject)
-		// if (target == null || !target.IsAttackTarget(this) || target.CurrentMap != CurrentMap || target.Node == null) return;
-		// value = target.Attacked(this, value, DefenceType.MAC, false);
-		// if (value == 0) return;
-		// LevelMagic(magic);
-		// if (VampAmount == 0) VampTime = Envir.Time + 1000;
-		// VampAmount += (ushort)(value * (magic.Level + 1) * 0.25F);
+		value := args[1].(int)
+		target := args[2].(IMapObject)
+		if target == nil || !target.IsAttackTarget(p) {
+			return
+		}
+		value = spellAttack(target, p, value, common.DefenceTypeMAC)
+		if value == 0 {
+			return
+		}
+		p.LevelMagic(userMagic)
+		p.ChangeHP(value * (userMagic.Level + 1) / 4)
 	case common.SpellHealing:
 		value := args[1].(int)
 		target := args[2].(IMapObject)
 		if target == nil || !target.IsFriendlyTarget(p) {
 			return
 		}
-		if target.GetRace() == common.ObjectTypePlayer {
-			obj := target.(*Player)
-			hp := int(obj.HP)
-			maxHP := int(obj.MaxHP)
-			if hp >= maxHP {
-				return
-			}
-			obj.HP += uint16(value)
-		} else if target.GetRace() == common.ObjectTypeMonster {
-			obj := target.(*Monster)
-			hp := int(obj.HP)
-			maxHP := int(obj.MaxHP)
-			if hp >= maxHP {
-				return
-			}
-			obj.HP += uint32(value)
+		if !healObject(target, value) {
+			return
 		}
 		p.LevelMagic(userMagic)
 	case common.SpellElectricShock:
+		if target, ok := args[1].(*Monster); ok && !target.IsDead() {
+			p.electricShock(target, userMagic)
+		}
 	case common.SpellPoisoning:
 		value := args[1].(int)
 		target := args[2].(IMapObject)
-		userItem := args[3].(*common.UserItem)
-		itemInfo := p.Map.Env.GameDB.GetItemInfoByID(int(userItem.ItemID))
-		if itemInfo == nil {
-			return
-		}
-		if target == nil || target.IsAttackTarget(p) {
+		shape := args[3].(int16)
+		if target == nil || !target.IsAttackTarget(p) {
 			return
 		}
 		duration := time.Duration(2000) * time.Millisecond
 		tickNum := (userMagic.Level + 1) * 7
-		switch itemInfo.Shape {
+		switch shape {
 		case 1:
 			target.ApplyPoison(NewPoison(p.NewObjectID(), p, value, common.PoisonTypeGreen, duration, tickNum), p)
 		case 2:
 			target.ApplyPoison(NewPoison(p.NewObjectID(), p, value, common.PoisonTypeRed, duration, tickNum), p)
 		}
 		p.LevelMagic(userMagic)
-	case common.SpellStormEscape:
 	case common.SpellTeleport:
-	case common.SpellBlink:
+		if p.Map.Info.NoTeleport != 0 {
+			p.ReceiveChat("此地图不能使用瞬息移动", common.ChatTypeSystem)
+			return
+		}
+		if p.TeleportRandom(p.Map, 200) {
+			p.LevelMagic(userMagic)
+		}
+	case common.SpellBlink, common.SpellStormEscape:
+		location := args[1].(common.Point)
+		if p.Map.Info.NoTeleport != 0 || userMagic.Info == nil || !InRange(p.CurrentLocation, location, userMagic.Info.MagicRange) {
+			return
+		}
+		if p.Teleport(p.Map, location) {
+			p.LevelMagic(userMagic)
+		}
 	case common.SpellHiding:
 		for i := range p.Buffs {
 			if p.Buffs[i].BuffType == common.BuffTypeHiding {
@@ -309,27 +354,79 @@ func (p *Player) CompleteMagic(args ...interface{}) {
 		p.AddBuff(buff)
 		p.LevelMagic(userMagic)
 	case common.SpellHaste:
+		expireTime := time.Now().Add(time.Duration((userMagic.Level+1)*30000) * time.Millisecond)
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeHaste, userMagic.Level*2+2, expireTime)
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
+	case common.SpellMoonLight:
+		p.completeStealth(userMagic, common.BuffTypeMoonLight)
+	case common.SpellDarkBody:
+		p.completeStealth(userMagic, common.BuffTypeDarkBody)
 	case common.SpellFury:
 		// p.AddBuff(new Buff { Type = BuffType.Fury, Caster = this, ExpireTime = Envir.Time + 60000 + magic.Level * 10000, Values = new int[] { 4 }, Visible = true });
-		expireTime := time.Now().Add(time.Duration(60000 + userMagic.Level*10000))
+		expireTime := time.Now().Add(time.Duration(60000+userMagic.Level*10000) * time.Millisecond)
 		buff := NewBuff(p.NewObjectID(), common.BuffTypeFury, 4, expireTime)
 		buff.Visible = true
 		p.AddBuff(buff)
 		p.LevelMagic(userMagic)
 	case common.SpellImmortalSkin:
+		if p.GetBuff(common.BuffTypeImmortalSkin) != nil {
+			return
+		}
+		// 提高防御的同时降低攻击
+		value := int(p.MaxAC) * (10 + userMagic.Level*7) / 100
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeImmortalSkin, value, time.Now().Add(60*time.Second))
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
+	case common.SpellRage:
+		if p.GetBuff(common.BuffTypeRage) != nil {
+			return
+		}
+		value := int(p.MaxDC) * (12 + userMagic.Level*3) / 100
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeRage, value, time.Now().Add(time.Duration(48+userMagic.Level*6)*time.Second))
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
+	case common.SpellProtectionField:
+		if p.GetBuff(common.BuffTypeProtectionField) != nil {
+			return
+		}
+		value := int(p.MaxAC) * (20 + userMagic.Level*3) / 100
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeProtectionField, value, time.Now().Add(time.Duration(45+userMagic.Level*15)*time.Second))
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
 	case common.SpellLightBody:
+		expireTime := time.Now().Add(time.Duration((userMagic.Level+1)*30000) * time.Millisecond)
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeLightBody, userMagic.Level*2+2, expireTime)
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
 	case common.SpellMagicShield:
+		if p.GetBuff(common.BuffTypeMagicShield) != nil {
+			return
+		}
+		value := args[1].(int)
+		p.AddBuff(NewBuff(p.NewObjectID(), common.BuffTypeMagicShield, userMagic.Level, time.Now().Add(time.Duration(value)*time.Second)))
+		msg := &server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectMagicShieldUp}
+		p.Enqueue(msg)
+		p.Broadcast(msg)
+		p.LevelMagic(userMagic)
 	case common.SpellTurnUndead:
+		target, ok := args[1].(*Monster)
+		if !ok || target.IsDead() || !target.IsAttackTarget(p) {
+			return
+		}
+		target.EXPOwner = p
+		target.Die()
+		p.LevelMagic(userMagic)
 	case common.SpellMagicBooster:
-		// buff := NewBuff { Type = BuffType.MagicBooster
-		// 	 Caster = this
-		// 	  ExpireTime = Envir.Time + 60000,
-		// 	   Values = new int[] { value, 6 + magic.Level }
-		// 	    Visible = true });
+		// 增加的魔法值为 value，施法额外消耗 6 + 技能等级 % 的魔法
 		value := args[1].(int)
-		values := value + 6 + int(userMagic.Level)
 		expireTime := time.Now().Add(time.Duration(60000) * time.Millisecond)
-		buff := NewBuff(p.NewObjectID(), common.BuffTypeMagicBooster, values, expireTime)
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeMagicBooster, value, expireTime)
 		buff.Visible = true
 		p.AddBuff(buff)
 		p.LevelMagic(userMagic)
@@ -338,27 +435,10 @@ func (p *Player) CompleteMagic(args ...interface{}) {
 		if target == nil || !target.IsFriendlyTarget(p) { // || target.CurrentMap != CurrentMap || target.Node == null) return;
 			return
 		}
-		// if (Envir.Random.Next(4) > magic.Level || target.PoisonList.Count == 0) return;
-		// target.ExplosionInflictedTime = 0;
-		// target.ExplosionInflictedStage = 0;
-
-		// for (int i = 0; i < target.Buffs.Count; i++)
-		// {
-		//     if (target.Buffs[i].Type == BuffType.Curse)
-		//     {
-		//         target.Buffs.RemoveAt(i);
-		//         break;
-		//     }
-		// }
-
-		// target.PoisonList.Clear();
-		// target.OperateTime = 0;
-
-		// if (target.ObjectID == ObjectID)
-		//     Enqueue(new S.RemoveDelayedExplosion { ObjectID = target.ObjectID });
-		// target.Broadcast(new S.RemoveDelayedExplosion { ObjectID = target.ObjectID });
-
-		// LevelMagic(magic);
+		if RandomNext(4) > userMagic.Level || !purify(target) {
+			return
+		}
+		p.LevelMagic(userMagic)
 	case common.SpellRevelation:
 		// value := args[1].(int)
 		target := args[2].(IMapObject)
@@ -374,12 +454,115 @@ func (p *Player) CompleteMagic(args ...interface{}) {
 		// target.BroadcastHealthChange()
 		p.LevelMagic(userMagic)
 	case common.SpellReincarnation:
+		target := args[1].(*Player)
+		if !target.IsDead() || target.Map != p.Map {
+			return
+		}
+		// 成功率随技能等级提高
+		if RandomNext(30) > (userMagic.Level+1)*10 {
+			return
+		}
+		target.Revive(int(target.MaxHP) * (userMagic.Level + 1) / 4)
+		p.LevelMagic(userMagic)
+	case common.SpellUltimateEnhancer, common.SpellEnergyShield:
+		value := args[1].(int)
+		target := args[2].(*Player)
+		duration := args[3].(time.Duration)
+		if target.IsDead() {
+			return
+		}
+		buffType := common.BuffTypeUltimateEnhancer
+		if userMagic.Spell == common.SpellEnergyShield {
+			buffType = common.BuffTypeEnergyShield
+		}
+		buff := NewBuff(p.NewObjectID(), buffType, value, time.Now().Add(duration))
+		buff.Visible = true
+		target.AddBuff(buff)
+		p.LevelMagic(userMagic)
 	case common.SpellEntrapment:
+		target := args[1].(IMapObject)
+		if target.IsDead() || !target.IsAttackTarget(p) || target.GetCell() == nil {
+			return
+		}
+		// 成功率随技能等级和等级差提高，对玩家更容易生效
+		gap := int(p.Level) - objectLevel(target) + 9
+		duration := (userMagic.Level + 1) * 8 / 10
+		if target.GetRace() == common.ObjectTypePlayer {
+			gap = int(p.Level) - objectLevel(target) + 4
+			duration = (userMagic.Level + 1) * 16 / 10
+		}
+		if RandomNext(30) >= (userMagic.Level+1)*3+gap {
+			return
+		}
+		if duration > 0 {
+			target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeParalysis, time.Second, duration), p)
+		}
+		p.Broadcast(&server.ObjectEffect{ObjectID: target.GetID(), Effect: common.SpellEffectEntrapment})
+		// 把目标拉到身前
+		distance := rangeDistance(p.CurrentLocation, target.GetPoint()) - 1
+		if pushObject(target, DirectionFromPoint(target.GetPoint(), p.CurrentLocation), distance) > 0 {
+			p.LevelMagic(userMagic)
+		}
 	case common.SpellHallucination:
+		value := args[1].(int)
+		target, ok := args[2].(*Monster)
+		if !ok || target.IsDead() || !target.IsAttackTarget(p) {
+			return
+		}
+		if n := 4 - userMagic.Level; n > 1 && RandomNext(n) > 0 {
+			return
+		}
+		target.Target = nil
+		target.HallucinationTime = time.Now().Add(time.Duration(value) * time.Second)
+		p.LevelMagic(userMagic)
 	case common.SpellPetEnhancer:
+		value := args[1].(int)
+		target := args[2].(*Monster)
+		duration := args[3].(time.Duration)
+		if target.IsDead() || target.Master != p {
+			return
+		}
+		target.AddBuff(NewBuff(p.NewObjectID(), common.BuffTypePetEnhancer, value, time.Now().Add(duration)))
+		p.LevelMagic(userMagic)
+	case common.SpellElementalShot, common.SpellVampireShot, common.SpellPoisonShot, common.SpellCrippleShot, common.SpellDelayedExplosion:
+		value := args[1].(int)
+		target := args[2].(IMapObject)
+		if target == nil || !target.IsAttackTarget(p) {
+			return
+		}
+		value = spellAttack(target, p, value, common.DefenceTypeMAC)
+		if value == 0 {
+			return
+		}
+		p.LevelMagic(userMagic)
+		p.shotEffect(target, userMagic, value)
+	case common.SpellBindingShot:
+		target := args[1].(*Monster)
+		if target.IsDead() || !target.IsAttackTarget(p) {
+			return
+		}
+		target.Target = nil
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeParalysis, time.Second, (userMagic.Level+1)*5), p)
+		p.LevelMagic(userMagic)
+	case common.SpellConcentration:
+		if p.GetBuff(common.BuffTypeConcentration) != nil {
+			return
+		}
+		buff := NewBuff(p.NewObjectID(), common.BuffTypeConcentration, (userMagic.Level+1)*10, time.Now().Add(time.Duration(30+userMagic.Level*10)*time.Second))
+		buff.Visible = true
+		p.AddBuff(buff)
+		p.LevelMagic(userMagic)
 	case common.SpellElementalBarrier:
-	case common.SpellElementalShot:
-	case common.SpellDelayedExplosion:
+		if time.Now().Before(p.BarrierTime) {
+			return
+		}
+		value := args[1].(int)
+		p.Barrier = (userMagic.Level + 1) * 10
+		p.BarrierTime = time.Now().Add(time.Duration(value) * time.Second)
+		msg := &server.ObjectEffect{ObjectID: p.GetID(), Effect: common.SpellEffectElementalBarrierUp}
+		p.Enqueue(msg)
+		p.Broadcast(msg)
+		p.LevelMagic(userMagic)
 	}
 }
 
@@ -407,28 +590,36 @@ func (p *Player) Healing(target IMapObject, magic *common.UserMagic) {
 
 // Repulsion 抗拒火环
 func (p *Player) Repulsion(magic *common.UserMagic) {
-
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, p.CurrentLocation))
+	p.Map.PushAction(action)
 }
 
 // Poisoning 施毒术
 func (p *Player) Poisoning(target IMapObject, magic *common.UserMagic) bool {
-	if target == nil || target.IsAttackTarget(p) {
+	if target == nil || !target.IsAttackTarget(p) {
 		return false
 	}
 	item := p.GetPoison(1)
 	if item == nil {
 		return false
 	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil {
+		return false
+	}
+	// 消耗后格子会被清空，这里先记下毒药的类型
 	power := magic.GetDamage(p.GetAttackPower(int(p.MinSC), int(p.MaxSC)))
-	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, power, target, item))
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, power, target, info.Shape))
 	p.ActionList.Store(action.ID, action)
 	p.ConsumeItem(item, 1)
 	return true
 }
 
-// HellFire 地狱火
+// HellFire 地狱火，向前方 4 格喷火
 func (p *Player) HellFire(magic *common.UserMagic) {
-
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, damage, p.CurrentLocation, p.CurrentDirection))
+	p.Map.PushAction(action)
 }
 
 // ThunderBolt 雷电术
@@ -437,7 +628,9 @@ func (p *Player) ThunderBolt(target IMapObject, magic *common.UserMagic) {
 		return
 	}
 	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
-	// if (target.Undead) damage = (int)(damage * 1.5F);
+	if target.IsUndead() {
+		damage = int(float32(damage) * 1.5)
+	}
 	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, damage, target))
 	p.ActionList.Store(action.ID, action)
 }
@@ -462,31 +655,45 @@ func (p *Player) SoulFireball(target IMapObject, magic *common.UserMagic) bool {
 
 // SummonSkeleton 召唤骷髅
 func (p *Player) SummonSkeleton(magic *common.UserMagic) {
-	skeletonName := "BoneFamiliar"
-	for i := range p.Pets {
-		if p.Pets[i].GetName() == skeletonName {
-			m := p.Pets[i].(*Monster)
-			action := NewDelayedAction(p.NewObjectID(), DelayedTypeRecall, NewTask(m.PetRecall))
-			m.ActionList.Store(action.ID, action)
-			return
+	p.summonPet(magic)
+}
+
+// summonPet 按 summonInfos 消耗护身符召唤宠物，同名宠物达到上限时召回到身边
+func (p *Player) summonPet(magic *common.UserMagic) {
+	info, ok := summonInfos[magic.Spell]
+	if !ok {
+		return
+	}
+	if p.countPets(info.name) >= info.limit {
+		for i := range p.Pets {
+			if p.Pets[i].GetName() == info.name {
+				m := p.Pets[i].(*Monster)
+				action := NewDelayedAction(p.NewObjectID(), DelayedTypeRecall, NewTask(m.PetRecall))
+				m.ActionList.Store(action.ID, action)
+			}
 		}
+		return
 	}
-	if len(p.Pets) > 1 {
+	if p.countPets("") >= MaxPets {
 		return
 	}
-	userItem := p.GetAmulet(1)
-	if userItem == nil {
+	var userItem *common.UserItem
+	if info.amulets > 0 {
+		if userItem = p.GetAmulet(info.amulets); userItem == nil {
+			return
+		}
+	}
+	monsterInfo := p.Map.Env.GameDB.GetMonsterInfoByName(info.name)
+	if monsterInfo == nil {
 		return
 	}
-	monsterInfo := p.Map.Env.GameDB.GetMonsterInfoByName(skeletonName)
 	p.LevelMagic(magic)
-	p.ConsumeItem(userItem, 1) // 减少物品数量
-	dir := int(p.CurrentDirection) + 4
-	if dir > 8 {
-		dir -= 8
+	if userItem != nil {
+		p.ConsumeItem(userItem, info.amulets) // 减少物品数量
 	}
-	monster := NewMonster(p.Map, p.GetPoint().NextPoint(common.MirDirection(dir), 1), monsterInfo)
-	monster.PetLevel = uint16(magic.Level)
+	monster := NewMonster(p.Map, p.petBack(), monsterInfo)
+	monster.SetPetLevel(uint16(magic.Level))
+	monster.MaxPetLevel = uint16(magic.Level + 4)
 	monster.Master = p
 	monster.ActionTime = time.Now().Add(time.Duration(1000) * time.Millisecond)
 	// monster.RefreshNameColour(false);
@@ -495,26 +702,32 @@ func (p *Player) SummonSkeleton(magic *common.UserMagic) {
 	p.Map.PushAction(action)
 }
 
-// GetAmulet 获取玩家身上装备的护身符
+// GetAmulet 获取玩家身上装备的护身符，返回的指针指向装备栏，可以直接 ConsumeItem
 func (p *Player) GetAmulet(count int) *common.UserItem {
 	for i := range p.Equipment {
-		userItem := p.Equipment[i]
+		userItem := &p.Equipment[i]
+		if userItem.ID == 0 {
+			continue
+		}
 		itemInfo := p.Map.Env.GameDB.GetItemInfoByID(int(userItem.ItemID))
-		if itemInfo != nil && itemInfo.Type == common.ItemTypeAmulet && int(userItem.Count) > count {
-			return &userItem
+		if itemInfo != nil && itemInfo.Type == common.ItemTypeAmulet && itemInfo.Shape == 0 && int(userItem.Count) >= count {
+			return userItem
 		}
 	}
 	return nil
 }
 
-// GetPoison 获取玩家身上装备的毒药
+// GetPoison 获取玩家身上装备的毒药(Shape 1 为绿毒，2 为红毒)
 func (p *Player) GetPoison(count int) *common.UserItem {
 	for i := range p.Equipment {
-		userItem := p.Equipment[i]
+		userItem := &p.Equipment[i]
+		if userItem.ID == 0 {
+			continue
+		}
 		itemInfo := p.Map.Env.GameDB.GetItemInfoByID(int(userItem.ItemID))
-		if itemInfo != nil && itemInfo.Type == common.ItemTypeAmulet && int(userItem.Count) > count {
+		if itemInfo != nil && itemInfo.Type == common.ItemTypeAmulet && int(userItem.Count) >= count {
 			if itemInfo.Shape == 1 || itemInfo.Shape == 2 {
-				return &userItem
+				return userItem
 			}
 		}
 	}
@@ -541,11 +754,22 @@ func (p *Player) FurySpell(magic *common.UserMagic) bool {
 	return true
 }
 
-// ImmortalSkin ...
-func (p *Player) ImmortalSkin(magic *common.UserMagic) bool { return true }
+// ImmortalSkin 金刚不坏，提高防御但降低攻击
+func (p *Player) ImmortalSkin(magic *common.UserMagic) bool {
+	if p.GetBuff(common.BuffTypeImmortalSkin) != nil {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
 
-// FireBang 爆裂火焰
-func (p *Player) FireBang(magic *common.UserMagic, location common.Point) {}
+// FireBang 爆裂火焰，冰咆哮也使用这个
+func (p *Player) FireBang(magic *common.UserMagic, location common.Point) {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, damage, location))
+	p.Map.PushAction(action)
+}
 
 // MassHiding 集体隐身术
 func (p *Player) MassHiding(magic *common.UserMagic, location common.Point) bool {
@@ -558,6 +782,7 @@ func (p *Player) MassHiding(magic *common.UserMagic, location common.Point) bool
 	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p.GetAttackPower(int(p.MinSC), int(p.MaxSC))/2+(magic.Level+1)*2, location, p))
 	// p.Map.Env.ActionList.Store(action.ID, action)
 	p.Map.PushAction(action)
+	p.ConsumeItem(userItem, 1)
 	return true
 }
 
@@ -592,8 +817,21 @@ func (p *Player) Lightning(magic *common.UserMagic) {
 	// p.Map.Env.ActionList.Store(action.ID, action)
 }
 
-// HeavenlySword ..
-func (p *Player) HeavenlySword(magic *common.UserMagic) {}
+// HeavenlySword 天务，攻击前方三格
+func (p *Player) HeavenlySword(magic *common.UserMagic) {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinDC), int(p.MaxDC)))
+	hit := false
+	loc := p.CurrentLocation
+	for i := 0; i < 3; i++ {
+		loc = loc.NextPoint(p.CurrentDirection, 1)
+		if p.attackCell(loc, damage) {
+			hit = true
+		}
+	}
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
 
 // MassHealing 群体治疗术
 func (p *Player) MassHealing(magic *common.UserMagic, location common.Point) {
@@ -603,8 +841,42 @@ func (p *Player) MassHealing(magic *common.UserMagic, location common.Point) {
 	// p.Map.Env.ActionList.Store(action.ID, action)
 }
 
-// ShoulderDash 野蛮冲撞
-func (p *Player) ShoulderDash(magic *common.UserMagic) {}
+// ShoulderDash 野蛮冲撞，向前冲撞并推开等级比自己低的目标
+func (p *Player) ShoulderDash(magic *common.UserMagic) {
+	if p.IsParalysed() {
+		return
+	}
+	distance := RandomNext(2) + magic.Level + 2
+	dir := p.CurrentDirection
+	moved := 0
+	for ; moved < distance; moved++ {
+		n := p.CurrentLocation.NextPoint(dir, 1)
+		if p.Map.UpdateObject(p, n) {
+			p.CurrentLocation = n
+			continue
+		}
+		// 前方有目标时尝试推开
+		pushed := false
+		p.Map.rangeAttackTargets(p, n, func(o IMapObject) {
+			if objectLevel(o) < int(p.Level) && pushObject(o, dir, 1) > 0 {
+				pushed = true
+			}
+		})
+		if !pushed || !p.Map.UpdateObject(p, n) {
+			break
+		}
+		p.CurrentLocation = n
+	}
+	if moved == 0 {
+		p.Enqueue(&server.UserDashFail{Location: p.CurrentLocation, Direction: dir})
+		p.Broadcast(&server.ObjectDashFail{ObjectID: p.GetID(), Location: p.CurrentLocation, Direction: dir})
+		return
+	}
+	p.Enqueue(&server.UserDash{Location: p.CurrentLocation, Direction: dir})
+	p.Broadcast(&server.ObjectDash{ObjectID: p.GetID(), Location: p.CurrentLocation, Direction: dir})
+	processSpells(p)
+	p.LevelMagic(magic)
+}
 
 // ThunderStorm 地狱雷光
 func (p *Player) ThunderStorm(magic *common.UserMagic) {
@@ -620,29 +892,30 @@ func (p *Player) FlameDisruptor(target IMapObject, magic *common.UserMagic) {
 		return
 	}
 	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
-	// if (!target.Undead) damage = (int)(damage * 1.5F);
+	if !target.IsUndead() {
+		damage = int(float32(damage) * 1.5)
+	}
 	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, damage, target))
 	p.ActionList.Store(action.ID, action)
 }
 
 // TurnUndead 圣言术
 func (p *Player) TurnUndead(target IMapObject, magic *common.UserMagic) {
-	if target == nil || target.GetRace() != common.ObjectTypeMonster || !target.IsUndead() || !target.IsAttackTarget(p) {
+	monster, ok := target.(*Monster)
+	if !ok || !monster.IsUndead() || !monster.IsAttackTarget(p) {
+		return
+	}
+	if RandomNext(2)+int(p.Level)-1 <= int(monster.Level) {
+		monster.Target = p
+		return
+	}
+	dif := int(p.Level) - int(monster.Level) + 15
+	if RandomNext(100) >= (magic.Level+1)<<3+dif {
+		monster.Target = p
 		return
 	}
-	// if (Envir.Random.Next(2) + Level - 1 <= target.Level)
-	// {
-	// 	target.Target = this;
-	// 	return;
-	// }
-	// int dif = Level - target.Level + 15;
-	// if (Envir.Random.Next(100) >= (magic.Level + 1 << 3) + dif)
-	// {
-	// 	target.Target = this;
-	// 	return;
-	// }
-	// DelayedAction action = new DelayedAction(DelayedType.Magic, Envir.Time + 500, magic, target);
-	// ActionList.Add(action);
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, monster))
+	p.ActionList.Store(action.ID, action)
 }
 
 // MagicBooster 深延术
@@ -664,38 +937,7 @@ func (p *Player) Vampirism(target IMapObject, magic *common.UserMagic) {
 
 // SummonShinsu 召唤神兽
 func (p *Player) SummonShinsu(magic *common.UserMagic) {
-	skeletonName := "Shinsu"
-	for i := range p.Pets {
-		if p.Pets[i].GetName() == skeletonName {
-			m := p.Pets[i].(*Monster)
-			action := NewDelayedAction(p.NewObjectID(), DelayedTypeRecall, NewTask(m.PetRecall))
-			m.ActionList.Store(action.ID, action)
-			return
-		}
-	}
-	if len(p.Pets) > 1 {
-		return
-	}
-	userItem := p.GetAmulet(5)
-	if userItem == nil {
-		return
-	}
-	monsterInfo := p.Map.Env.GameDB.GetMonsterInfoByName(skeletonName)
-	p.LevelMagic(magic)
-	p.ConsumeItem(userItem, 5) // 减少物品数量
-	dir := int(p.CurrentDirection) + 4
-	if dir > 8 {
-		dir -= 8
-	}
-	monster := NewMonster(p.Map, p.GetPoint().NextPoint(common.MirDirection(dir), 1), monsterInfo)
-	monster.PetLevel = uint16(magic.Level)
-	monster.Master = p
-	monster.ActionTime = time.Now().Add(time.Duration(1000) * time.Millisecond)
-	// monster.RefreshNameColour(false);
-	// DelayedAction action = new DelayedAction(DelayedType.Magic, Envir.Time + 500, this, magic, monster, Front);
-	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, monster, p.GetFrontPoint()))
-	p.Map.PushAction(action)
-	// p.Map.Env.ActionList.Store(action.ID, action)
+	p.summonPet(magic)
 }
 
 // Purification 净化术
@@ -718,58 +960,438 @@ func (p *Player) Revelation(target IMapObject, magic *common.UserMagic) {
 }
 
 // PoisonCloud 毒云
-func (p *Player) PoisonCloud(magic *common.UserMagic, location common.Point) bool { return true }
+func (p *Player) PoisonCloud(magic *common.UserMagic, location common.Point) bool {
+	amulet := p.GetAmulet(5)
+	if amulet == nil {
+		return false
+	}
+	poison := p.GetPoison(5)
+	if poison == nil {
+		return false
+	}
+	value := magic.GetDamage(p.GetAttackPower(int(p.MinSC), int(p.MaxSC)))
+	p.pushAreaSpell(magic, value, location)
+	p.ConsumeItem(amulet, 5)
+	p.ConsumeItem(poison, 5)
+	return true
+}
 
-// Entrapment 捕绳剑
-func (p *Player) Entrapment(target IMapObject, magic *common.UserMagic) {}
+// pushAreaSpell 延迟在地图上释放范围魔法
+func (p *Player) pushAreaSpell(magic *common.UserMagic, value int, location common.Point) {
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, value, location))
+	p.Map.PushAction(action)
+}
 
-// BladeAvalanche 攻破斩
-func (p *Player) BladeAvalanche(magic *common.UserMagic) {}
+// Entrapment 捕绳剑，把目标拉到身前并麻痹
+func (p *Player) Entrapment(target IMapObject, magic *common.UserMagic) bool {
+	if target == nil || !target.IsAttackTarget(p) {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, target))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
 
-// SlashingBurst 日闪
-func (p *Player) SlashingBurst(magic *common.UserMagic) bool { return true }
+// LionRoar 狮子吼，麻痹周围的怪物
+func (p *Player) LionRoar(magic *common.UserMagic) {
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, p.CurrentLocation))
+	p.Map.PushAction(action)
+}
 
-// Rage 剑气爆
-func (p *Player) Rage(magic *common.UserMagic) {}
+// BladeAvalanche 攻破斩，攻击前方三列三行共九格
+func (p *Player) BladeAvalanche(magic *common.UserMagic) {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinDC), int(p.MaxDC)))
+	dir := p.CurrentDirection
+	hit := false
+	for _, d := range []int{7, 0, 1} {
+		loc := p.CurrentLocation.NextPoint(common.MirDirection((int(dir)+d)%8), 1)
+		for i := 0; i < 3; i++ {
+			if p.attackCell(loc, damage) {
+				hit = true
+			}
+			loc = loc.NextPoint(dir, 1)
+		}
+	}
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
 
-// Mirroring 分身术
-func (p *Player) Mirroring(magic *common.UserMagic) {}
+// SlashingBurst 日闪，攻击前方两格后向前冲两格
+func (p *Player) SlashingBurst(magic *common.UserMagic) bool {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinDC), int(p.MaxDC)))
+	dir := p.CurrentDirection
+	hit := false
+	loc := p.CurrentLocation
+	for i := 0; i < 2; i++ {
+		loc = loc.NextPoint(dir, 1)
+		if p.attackCell(loc, damage) {
+			hit = true
+		}
+	}
+	if hit {
+		p.LevelMagic(magic)
+	}
+	moved := 0
+	for ; moved < 2; moved++ {
+		n := p.CurrentLocation.NextPoint(dir, 1)
+		if !p.Map.UpdateObject(p, n) {
+			break
+		}
+		p.CurrentLocation = n
+	}
+	if moved > 0 {
+		p.Enqueue(&server.UserDash{Location: p.CurrentLocation, Direction: dir})
+		p.Broadcast(&server.ObjectDash{ObjectID: p.GetID(), Location: p.CurrentLocation, Direction: dir})
+		processSpells(p)
+	}
+	return true
+}
+
+// Rage 剑气爆，一段时间内提高攻击
+func (p *Player) Rage(magic *common.UserMagic) bool {
+	if p.GetBuff(common.BuffTypeRage) != nil {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
+
+// Mirroring 分身术，召唤一个和自己外观一样的分身，已有分身时召回到身边
+func (p *Player) Mirroring(magic *common.UserMagic) {
+	p.summonPet(magic)
+}
 
 // Blizzard 天霜冰环
-func (p *Player) Blizzard(magic *common.UserMagic, location common.Point) bool { return true }
+func (p *Player) Blizzard(magic *common.UserMagic, location common.Point) bool {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	p.pushAreaSpell(magic, damage, location)
+	return true
+}
 
 // MeteorStrike 流星火雨
-func (p *Player) MeteorStrike(magic *common.UserMagic, location common.Point) bool { return true }
+func (p *Player) MeteorStrike(magic *common.UserMagic, location common.Point) bool {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	p.pushAreaSpell(magic, damage, location)
+	return true
+}
 
-// IceThrust 冰焰术
-func (p *Player) IceThrust(magic *common.UserMagic) {}
+// IceThrust 冰焰术，前方锥形范围伤害并冰冻
+func (p *Player) IceThrust(magic *common.UserMagic) {
+	damage := magic.GetDamage(p.GetAttackPower(int(p.MinMC), int(p.MaxMC)))
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, damage, p.GetFrontPoint(), p.CurrentDirection))
+	p.Map.PushAction(action)
+}
 
-// ProtectionField 护身气幕
-func (p *Player) ProtectionField(magic *common.UserMagic) {}
+// ProtectionField 护身气幕，一段时间内提高防御
+func (p *Player) ProtectionField(magic *common.UserMagic) bool {
+	if p.GetBuff(common.BuffTypeProtectionField) != nil {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic))
+	p.ActionList.Store(action.ID, action)
+	return true
+}
 
-// PetEnhancer 血龙水
-func (p *Player) PetEnhancer(target IMapObject, magic *common.UserMagic) bool { return true }
+// PetEnhancer 血龙水，提高自己宠物的攻击和防御
+func (p *Player) PetEnhancer(target IMapObject, magic *common.UserMagic) bool {
+	pet, ok := target.(*Monster)
+	if !ok || pet.Master != p || pet.IsDead() {
+		return false
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := p.GetAttackPower(int(p.MinSC), int(p.MaxSC))/10 + magic.Level + 1
+	duration := time.Duration(p.GetAttackPower(int(p.MinSC), int(p.MaxSC))*2+(magic.Level+1)*10) * time.Second
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, value, pet, duration))
+	p.ActionList.Store(action.ID, action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
-// TrapHexagon 困魔咒
-func (p *Player) TrapHexagon(magic *common.UserMagic, target IMapObject) bool { return true }
+// TrapHexagon 困魔咒，困住目标周围等级不超过自己两级的怪物
+func (p *Player) TrapHexagon(magic *common.UserMagic, target IMapObject) bool {
+	monster, ok := target.(*Monster)
+	if !ok || !monster.IsAttackTarget(p) || int(monster.Level) > int(p.Level)+2 {
+		return false
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := p.GetAttackPower(int(p.MinSC), int(p.MaxSC))/10 + (magic.Level+1)*5
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.Map.CompleteMagic, magic, p, value, monster.GetPoint()))
+	p.Map.PushAction(action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
-// Reincarnation 复活术
-func (p *Player) Reincarnation(magic *common.UserMagic, target IMapObject) bool { return true }
+// Reincarnation 复活术，复活死亡的其他玩家
+func (p *Player) Reincarnation(magic *common.UserMagic, target *Player) bool {
+	if target == nil || target == p || !target.IsDead() {
+		return false
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, target))
+	p.ActionList.Store(action.ID, action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
 // Curse 诅咒术
-func (p *Player) Curse(magic *common.UserMagic, location common.Point) bool { return true }
+func (p *Player) Curse(magic *common.UserMagic, location common.Point) bool {
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := magic.GetPower(p.GetAttackPower(int(p.MinSC), int(p.MaxSC)))
+	p.pushAreaSpell(magic, value, location)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
 // SummonHolyDeva 召唤月灵
-func (p *Player) SummonHolyDeva(magic *common.UserMagic) {}
+func (p *Player) SummonHolyDeva(magic *common.UserMagic) {
+	p.summonPet(magic)
+}
 
-// Hallucination 迷魂术
-func (p *Player) Hallucination(target IMapObject, magic *common.UserMagic) bool { return true }
+// Hallucination 迷魂术，让怪物在一段时间内攻击其它怪物
+func (p *Player) Hallucination(target IMapObject, magic *common.UserMagic) bool {
+	monster, ok := target.(*Monster)
+	if !ok || !monster.IsAttackTarget(p) || monster.Master != nil {
+		return false
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := p.GetAttackPower(int(p.MinSC), int(p.MaxSC))/10 + (magic.Level+1)*5
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, value, monster))
+	p.ActionList.Store(action.ID, action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
-// EnergyShield 阴阳盾
-func (p *Player) EnergyShield(target IMapObject, magic *common.UserMagic) bool { return true }
+// EnergyShield 阴阳盾，被击中时有几率回血，没有目标时对自己使用
+func (p *Player) EnergyShield(target IMapObject, magic *common.UserMagic) bool {
+	player, ok := target.(*Player)
+	if !ok || !player.IsFriendlyTarget(p) {
+		player = p
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := magic.GetPower(p.GetAttackPower(int(p.MinSC), int(p.MaxSC)))
+	duration := time.Duration(30+50*magic.Level) * time.Second
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, value, player, duration))
+	p.ActionList.Store(action.ID, action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
-// UltimateEnhancer 无极真气
-func (p *Player) UltimateEnhancer(target IMapObject, magic *common.UserMagic) bool { return true }
+// UltimateEnhancer 无极真气，按职业提高目标的攻击、魔法或道术上限
+func (p *Player) UltimateEnhancer(target IMapObject, magic *common.UserMagic) bool {
+	player, ok := target.(*Player)
+	if !ok || !player.IsFriendlyTarget(p) {
+		return false
+	}
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := 1
+	if p.MaxSC >= 5 {
+		value = int(p.MaxSC) / 5
+		if value > 8 {
+			value = 8
+		}
+	}
+	duration := time.Duration(p.GetAttackPower(int(p.MinSC), int(p.MaxSC))*2+(magic.Level+1)*10) * time.Second
+	action := NewDelayedAction(p.NewObjectID(), DelayedTypeMagic, NewTask(p.CompleteMagic, magic, value, player, duration))
+	p.ActionList.Store(action.ID, action)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
 
 // Plague 瘟疫
-func (p *Player) Plague(magic *common.UserMagic, location common.Point) bool { return true }
+func (p *Player) Plague(magic *common.UserMagic, location common.Point) bool {
+	amulet := p.GetAmulet(1)
+	if amulet == nil {
+		return false
+	}
+	value := magic.GetDamage(p.GetAttackPower(int(p.MinSC), int(p.MaxSC)))
+	p.pushAreaSpell(magic, value, location)
+	p.ConsumeItem(amulet, 1)
+	return true
+}
+
+// healObject 给玩家或怪物回血，已经满血时返回 false
+func healObject(o IMapObject, value int) bool {
+	switch t := o.(type) {
+	case *Player:
+		if t.IsDead() || t.HP >= t.MaxHP {
+			return false
+		}
+		t.ChangeHP(value)
+	case *Monster:
+		if t.IsDead() || t.HP >= t.MaxHP {
+			return false
+		}
+		if int(t.HP)+value > int(t.MaxHP) {
+			value = int(t.MaxHP) - int(t.HP)
+		}
+		t.ChangeHP(value)
+	default:
+		return false
+	}
+	return true
+}
+
+// purify 解除玩家或怪物身上的毒和诅咒，没有可解除的效果时返回 false
+func purify(o IMapObject) bool {
+	switch t := o.(type) {
+	case *Player:
+		curse := t.GetBuff(common.BuffTypeCurse) != nil
+		if len(t.Poisons) == 0 && !curse {
+			return false
+		}
+		t.Poisons = nil
+		t.sendPoisoned()
+		if curse {
+			buffs := t.Buffs[:0]
+			for _, b := range t.Buffs {
+				if b.BuffType != common.BuffTypeCurse {
+					buffs = append(buffs, b)
+				}
+			}
+			t.Buffs = buffs
+			t.Enqueue(&server.RemoveBuff{Type: common.BuffTypeCurse, ObjectID: t.GetID()})
+			t.RefreshStats()
+		}
+	case *Monster:
+		if len(t.Poisons) == 0 {
+			return false
+		}
+		t.Poisons = nil
+		t.Poison = common.PoisonTypeNone
+		t.Broadcast(&server.ObjectPoisoned{ObjectID: t.GetID(), Poison: t.Poison})
+	default:
+		return false
+	}
+	return true
+}
+
+// objectLevel 玩家或怪物的等级
+func objectLevel(o IMapObject) int {
+	switch t := o.(type) {
+	case *Player:
+		return int(t.Level)
+	case *Monster:
+		return int(t.Level)
+	}
+	return 0
+}
+
+// freeze 冰系魔法命中后按技能等级有几率减速和冰冻目标，对怪物的冰冻时间受 Freezing 影响
+func (p *Player) freeze(target IMapObject, magic *common.UserMagic) {
+	if target.IsDead() {
+		return
+	}
+	isPlayer := target.GetRace() == common.ObjectTypePlayer
+	levelGap, slowRate, freezeRate := 10, 20, 40
+	slow, frozen := 5+RandomNext(5), 5+RandomNext(int(p.Freezing)+1)
+	if isPlayer {
+		levelGap, slowRate, freezeRate = 2, 100, 100
+		slow, frozen = 4, 2
+	}
+	if int(p.Level)+levelGap < objectLevel(target) {
+		return
+	}
+	if RandomNext(slowRate) <= magic.Level {
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeSlow, time.Second, slow), p)
+	}
+	if RandomNext(freezeRate) <= magic.Level+1 {
+		target.ApplyPoison(NewPoison(p.NewObjectID(), p, 0, common.PoisonTypeFrozen, time.Second, frozen), p)
+	}
+}
+
+// pushObject 把对象向 dir 方向推开最多 distance 格，返回实际移动的格数
+func pushObject(o IMapObject, dir common.MirDirection, distance int) int {
+	moved := 0
+	switch t := o.(type) {
+	case *Player:
+		for ; moved < distance; moved++ {
+			n := t.CurrentLocation.NextPoint(dir, 1)
+			if !t.Map.UpdateObject(t, n) {
+				break
+			}
+			t.CurrentLocation = n
+		}
+		if moved > 0 {
+			t.Enqueue(&server.Pushed{Location: t.CurrentLocation, Direction: t.CurrentDirection})
+			t.Broadcast(&server.ObjectPushed{ObjectID: t.GetID(), Location: t.CurrentLocation, Direction: t.CurrentDirection})
+			processSpells(t)
+		}
+	case *Monster:
+		for ; moved < distance; moved++ {
+			n := t.CurrentLocation.NextPoint(dir, 1)
+			if !t.Map.UpdateObject(t, n) {
+				break
+			}
+			t.CurrentLocation = n
+		}
+		if moved > 0 {
+			t.Broadcast(&server.ObjectPushed{ObjectID: t.GetID(), Location: t.CurrentLocation, Direction: t.CurrentDirection})
+			processSpells(t)
+		}
+	}
+	return moved
+}
+
+// electricShock 诱惑之光，有几率让怪物停止攻击或成为宝宝
+func (p *Player) electricShock(target *Monster, magic *common.UserMagic) {
+	if n := 4 - magic.Level; n > 1 && RandomNext(n) > 0 {
+		if RandomNext(2) == 0 {
+			p.LevelMagic(magic)
+		}
+		return
+	}
+	p.LevelMagic(magic)
+	if target.Master == p || RandomNext(2) > 0 {
+		target.Target = nil
+		return
+	}
+	if target.Master != nil || !target.CanTame || int(target.Level) > int(p.Level)+2 {
+		return
+	}
+	if RandomNext(int(p.Level)+20+magic.Level*5) <= int(target.Level)+10 {
+		return
+	}
+	alive := 0
+	for _, pet := range p.Pets {
+		if !pet.IsDead() {
+			alive++
+		}
+	}
+	if alive >= magic.Level+2 {
+		return
+	}
+	rate := int(target.MaxHP / 100)
+	if rate <= 2 {
+		rate = 2
+	} else {
+		rate *= 2
+	}
+	if RandomNext(rate) != 0 {
+		return
+	}
+	target.MaxPetLevel = uint16(magic.Level + 1)
+	p.AddPet(target)
+}
@@ -0,0 +1,63 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+// addPoison 添加中毒效果，同类型的毒会被新的替换
+func (o *MapObject) addPoison(poison *Poison) {
+	for i := range o.Poisons {
+		if o.Poisons[i].PoisonType == poison.PoisonType {
+			o.Poisons[i] = poison
+			return
+		}
+	}
+	o.Poisons = append(o.Poisons, poison)
+}
+
+// CurrentPoison 当前所中的全部毒
+func (o *MapObject) CurrentPoison() common.PoisonType {
+	var res common.PoisonType
+	for _, po := range o.Poisons {
+		res |= po.PoisonType
+	}
+	return res
+}
+
+// tickPoisons 跳毒，返回本次的伤害，造成伤害的毒的释放者，以及是否有毒失效
+func (o *MapObject) tickPoisons(now time.Time) (damage int, owner IMapObject, changed bool) {
+	poisons := o.Poisons[:0]
+	for _, po := range o.Poisons {
+		if now.Before(po.NextTime) {
+			poisons = append(poisons, po)
+			continue
+		}
+		po.TickTime++
+		po.NextTime = now.Add(po.Duration)
+		if po.PoisonType == common.PoisonTypeGreen || po.PoisonType == common.PoisonTypeBleeding {
+			value := po.Value
+			if po.TickNum > 0 {
+				value /= po.TickNum
+			}
+			if value < 1 {
+				value = 1
+			}
+			damage += value
+			owner = po.Owner
+		}
+		if po.TickTime >= po.TickNum {
+			changed = true
+			continue
+		}
+		poisons = append(poisons, po)
+	}
+	o.Poisons = poisons
+	return
+}
+
+// IsParalysed 麻痹或冰冻时不能移动和攻击
+func (o *MapObject) IsParalysed() bool {
+	return o.CurrentPoison()&(common.PoisonTypeParalysis|common.PoisonTypeFrozen|common.PoisonTypeLRParalysis) != 0
+}
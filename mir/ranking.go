@@ -0,0 +1,153 @@
+package mir
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+const (
+	RankingMaxCount        = 100             // 每个排行榜保留的人数
+	RankingPageSize        = 20              // 每次发送给客户端的人数
+	RankingRefreshDuration = 5 * time.Minute // 排行榜刷新间隔
+	RankingTypeCount       = 6               // 总榜 + 5 个职业榜
+)
+
+// Ranking 排行榜缓存，下标 0 是总榜，1 以后是职业 + 1
+type Ranking struct {
+	lock       sync.RWMutex
+	Lists      [RankingTypeCount][]common.RankCharacterInfo // 前 RankingMaxCount 名
+	Ranks      [RankingTypeCount]map[int64]int32            // 角色 ID 对应的名次，从 1 开始
+	UpdateTime time.Time
+	progress   map[int64]rankProgress // 在线玩家最新的等级经验，由玩家自己的协程更新
+}
+
+type rankProgress struct {
+	Level      int32
+	Experience int64
+}
+
+// UpdateProgress 记录玩家最新的等级经验，刷新排行榜时使用，避免在别的协程读取玩家数据
+func (r *Ranking) UpdateProgress(id int64, level int32, exp int64) {
+	r.lock.Lock()
+	if r.progress == nil {
+		r.progress = make(map[int64]rankProgress)
+	}
+	r.progress[id] = rankProgress{Level: level, Experience: exp}
+	r.lock.Unlock()
+}
+
+// sortRankings 按等级、经验从高到低排序，相同时先创建的角色在前
+func sortRankings(list []common.RankCharacterInfo) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Level != b.Level {
+			return a.Level > b.Level
+		}
+		if a.Experience != b.Experience {
+			return a.Experience > b.Experience
+		}
+		return a.PlayerID < b.PlayerID
+	})
+}
+
+// RefreshRankings 从数据库和在线玩家重新计算排行榜
+func (e *Environ) RefreshRankings() {
+	chars := make([]common.Character, 0)
+	e.Game.DB.Table("character").Select("id, name, level, class, experience").Find(&chars)
+	all := make([]common.RankCharacterInfo, 0, len(chars))
+	index := make(map[int64]int)
+	for _, c := range chars {
+		index[int64(c.ID)] = len(all)
+		all = append(all, common.RankCharacterInfo{
+			PlayerID:   int64(c.ID),
+			Name:       c.Name,
+			Class:      c.Class,
+			Level:      int32(c.Level),
+			Experience: c.Experience,
+		})
+	}
+	// 玩家升级和获得经验时记录的等级经验比数据库新
+	e.Ranking.lock.RLock()
+	for id, pr := range e.Ranking.progress {
+		if i, ok := index[id]; ok {
+			all[i].Level = pr.Level
+			all[i].Experience = pr.Experience
+		}
+	}
+	e.Ranking.lock.RUnlock()
+	sortRankings(all)
+
+	var lists [RankingTypeCount][]common.RankCharacterInfo
+	var ranks [RankingTypeCount]map[int64]int32
+	for i := range ranks {
+		ranks[i] = make(map[int64]int32)
+	}
+	for _, r := range all {
+		for _, t := range []int{0, int(r.Class) + 1} {
+			if t >= RankingTypeCount {
+				continue
+			}
+			ranks[t][r.PlayerID] = int32(len(ranks[t]) + 1)
+			if len(lists[t]) < RankingMaxCount {
+				lists[t] = append(lists[t], r)
+			}
+		}
+	}
+
+	e.Ranking.lock.Lock()
+	e.Ranking.Lists = lists
+	e.Ranking.Ranks = ranks
+	e.Ranking.UpdateTime = time.Now()
+	e.Ranking.lock.Unlock()
+}
+
+// rankingLoop 定时刷新排行榜
+func (e *Environ) rankingLoop() {
+	e.RefreshRankings()
+	ticker := time.NewTicker(RankingRefreshDuration)
+	for range ticker.C {
+		e.RefreshRankings()
+	}
+}
+
+// GetRanking 发送排行榜，start 为分页起始位置，onlineOnly 只显示在线玩家
+func (p *Player) GetRanking(typ uint8, start int32, onlineOnly bool) {
+	if int(typ) >= RankingTypeCount || start < 0 {
+		return
+	}
+	env := p.Map.Env
+	env.Ranking.lock.RLock()
+	list := env.Ranking.Lists[typ]
+	myRank := env.Ranking.Ranks[typ][int64(p.ID)]
+	env.Ranking.lock.RUnlock()
+
+	if onlineOnly {
+		online := make([]common.RankCharacterInfo, 0, len(list))
+		myRank = 0
+		for _, r := range list {
+			if env.GetPlayer(uint32(r.PlayerID)) == nil {
+				continue
+			}
+			online = append(online, r)
+			if r.PlayerID == int64(p.ID) {
+				myRank = int32(len(online))
+			}
+		}
+		list = online
+	}
+
+	listings := make([]common.RankCharacterInfo, 0, RankingPageSize)
+	for i := int(start); i < len(list) && len(listings) < RankingPageSize; i++ {
+		listings = append(listings, list[i])
+	}
+	p.Enqueue(&server.Rankings{
+		RankType: typ,
+		MyRank:   myRank,
+		Listings: listings,
+		Count:    int32(len(list)),
+	})
+}
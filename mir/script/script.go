@@ -19,10 +19,11 @@ var EnvirPath = ""
 const argsSkip = 2
 
 type Script struct {
-	Types  []int
-	Quests []int
-	Goods  []string
-	Pages  map[string]*PageScript
+	Types   []int
+	Quests  []int
+	Goods   []string
+	Recipes []string
+	Pages   map[string]*PageScript
 }
 
 type PageScript struct {
@@ -55,6 +56,9 @@ func Load(r io.Reader) (*Script, error) {
 	if err := sc.parseGoods(obj.Take("[Trade]")); err != nil {
 		return nil, err
 	}
+	if err := sc.parseRecipes(obj.Take("[Recipe]")); err != nil {
+		return nil, err
+	}
 	if err := sc.parseTypes(obj.Take("[Types]")); err != nil {
 		return nil, err
 	}
@@ -120,6 +124,20 @@ func (sc *Script) parseGoods(p *PageSource) error {
 	return nil
 }
 
+func (sc *Script) parseRecipes(p *PageSource) error {
+	sc.Recipes = []string{}
+
+	if p == nil {
+		return nil
+	}
+
+	for _, v := range p.Lines {
+		sc.Recipes = append(sc.Recipes, strings.TrimSpace(v))
+	}
+
+	return nil
+}
+
 var (
 	regexSharp = regexp.MustCompile(`#(\w+)`)
 )
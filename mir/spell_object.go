@@ -0,0 +1,232 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// SpellObject 地面上持续生效的魔法，如火墙、毒云，每个格子一个对象
+type SpellObject struct {
+	MapObject
+	Spell      common.Spell
+	Value      int           // 伤害或毒的总量
+	Caster     IMapObject    // 释放者
+	Show       bool          // 多格魔法只显示中心的一个
+	ExpireTime time.Time     // 消失时间
+	TickSpeed  time.Duration // 两次生效的间隔
+	TickTime   time.Time     // 下次生效时间
+}
+
+// NewSpellObject 在 location 创建地面魔法，持续 duration，每 tick 生效一次
+func NewSpellObject(m *Map, caster IMapObject, spell common.Spell, value int, location common.Point, duration, tick time.Duration, show bool) *SpellObject {
+	now := time.Now()
+	s := &SpellObject{
+		Spell:      spell,
+		Value:      value,
+		Caster:     caster,
+		Show:       show,
+		ExpireTime: now.Add(duration),
+		TickSpeed:  tick,
+		TickTime:   now.Add(tick),
+	}
+	s.ID = m.Env.NewObjectID()
+	s.Map = m
+	s.CurrentLocation = location
+	s.CurrentDirection = caster.GetDirection()
+	return s
+}
+
+func (s *SpellObject) GetID() uint32 {
+	return s.ID
+}
+
+func (s *SpellObject) GetName() string {
+	return s.Name
+}
+
+func (s *SpellObject) AttackMode() common.AttackMode {
+	return common.AttackModePeace
+}
+
+func (s *SpellObject) IsDead() bool { return s.Dead }
+
+func (s *SpellObject) IsUndead() bool {
+	return false
+}
+
+func (s *SpellObject) GetRace() common.ObjectType {
+	return common.ObjectTypeSpell
+}
+
+func (s *SpellObject) IsBlocking() bool {
+	return false
+}
+
+func (s *SpellObject) GetPoint() common.Point {
+	return s.CurrentLocation
+}
+
+func (s *SpellObject) GetCell() *Cell {
+	return s.Map.GetCell(s.CurrentLocation)
+}
+
+func (s *SpellObject) Broadcast(msg interface{}) {
+	s.Map.BroadcastP(s.CurrentLocation, msg, nil)
+}
+
+func (s *SpellObject) GetDirection() common.MirDirection {
+	return s.CurrentDirection
+}
+
+func (s *SpellObject) GetInfo() interface{} {
+	return &server.ObjectSpell{
+		ObjectID:  s.GetID(),
+		Location:  s.GetPoint(),
+		Spell:     s.Spell,
+		Direction: s.GetDirection(),
+	}
+}
+
+func (s *SpellObject) IsAttackTarget(attacker IMapObject) bool {
+	return false
+}
+
+func (s *SpellObject) IsFriendlyTarget(attacker IMapObject) bool {
+	return true
+}
+
+func (s *SpellObject) GetBaseStats() BaseStats {
+	return s.Caster.GetBaseStats()
+}
+
+func (s *SpellObject) AddBuff(buff *Buff) {}
+
+func (s *SpellObject) ApplyPoison(poison *Poison, caster IMapObject) {}
+
+// Spawned 加入地图，显示给周围玩家
+func (s *SpellObject) Spawned() {
+	s.Map.AddObject(s)
+	if s.Show {
+		s.Broadcast(s.GetInfo())
+	}
+	s.GetCell().Objects.Range(func(_, v interface{}) bool {
+		s.ProcessSpell(v.(IMapObject))
+		return true
+	})
+}
+
+// Despawn 从地图上移除
+func (s *SpellObject) Despawn() {
+	s.Dead = true
+	s.Map.DeleteObject(s)
+	if s.Show {
+		s.Broadcast(&server.ObjectRemove{ObjectID: s.GetID()})
+	}
+}
+
+// Process 到期移除，否则每 tick 对格子上的对象生效
+func (s *SpellObject) Process(now time.Time) {
+	if s.Dead {
+		return
+	}
+	if !now.Before(s.ExpireTime) || s.casterGone() {
+		s.Despawn()
+		return
+	}
+	if now.Before(s.TickTime) {
+		return
+	}
+	s.TickTime = now.Add(s.TickSpeed)
+	s.GetCell().Objects.Range(func(_, v interface{}) bool {
+		s.ProcessSpell(v.(IMapObject))
+		return true
+	})
+}
+
+// casterGone 释放者死亡、下线或离开了地图
+func (s *SpellObject) casterGone() bool {
+	if s.Caster.IsDead() {
+		return true
+	}
+	c := s.Caster.GetCell()
+	if c == nil || c.Map != s.Map {
+		return true
+	}
+	_, ok := c.Objects.Load(s.Caster.GetID())
+	return !ok
+}
+
+// ProcessSpell 对站在格子上的对象生效
+func (s *SpellObject) ProcessSpell(o IMapObject) {
+	if s.Dead || o.IsDead() || !o.IsAttackTarget(s.Caster) {
+		return
+	}
+	switch o.GetRace() {
+	case common.ObjectTypePlayer, common.ObjectTypeMonster:
+	default:
+		return
+	}
+
+	switch s.Spell {
+	case common.SpellFireWall, common.SpellMeteorStrike, common.SpellNapalmShot:
+		spellAttack(o, s.Caster, s.Value, common.DefenceTypeMAC)
+	case common.SpellBlizzard:
+		spellAttack(o, s.Caster, s.Value, common.DefenceTypeMAC)
+		if !o.IsDead() && RandomNext(5) == 0 {
+			o.ApplyPoison(NewPoison(s.Map.Env.NewObjectID(), s.Caster, 0, common.PoisonTypeSlow, time.Second, 5), s.Caster)
+		}
+	case common.SpellPoisonCloud:
+		o.ApplyPoison(NewPoison(s.Map.Env.NewObjectID(), s.Caster, s.Value, common.PoisonTypeGreen, 2*time.Second, 6), s.Caster)
+	case common.SpellTrap: // 只困住怪物
+		if m, ok := o.(*Monster); ok {
+			m.Target = nil
+			m.ApplyPoison(NewPoison(s.Map.Env.NewObjectID(), s.Caster, 0, common.PoisonTypeLRParalysis, time.Second, 2), s.Caster)
+		}
+	case common.SpellExplosiveTrap: // 踩到后爆炸一次
+		s.Despawn()
+		s.Map.RangeCell(s.CurrentLocation, 1, func(c *Cell, x, y int) bool {
+			s.Map.rangeAttackTargets(s.Caster, common.NewPoint(x, y), func(t IMapObject) {
+				spellAttack(t, s.Caster, s.Value, common.DefenceTypeMAC)
+			})
+			return true
+		})
+	}
+}
+
+// spellAttack 魔法造成伤害，伤害算在释放者头上，返回造成的伤害
+func spellAttack(o, caster IMapObject, damage int, defenceType common.DefenceType) int {
+	return attackObject(o, caster, damage, defenceType, false)
+}
+
+// attackObject 攻击玩家或怪物，返回造成的伤害
+func attackObject(o, attacker IMapObject, damage int, defenceType common.DefenceType, damageWeapon bool) int {
+	switch t := o.(type) {
+	case *Player:
+		return t.Attacked(attacker, damage, defenceType, damageWeapon)
+	case *Monster:
+		return t.Attacked(attacker, damage, defenceType, damageWeapon)
+	}
+	return 0
+}
+
+// hiddenSpell 不显示给客户端的地面魔法
+func hiddenSpell(o IMapObject) bool {
+	s, ok := o.(*SpellObject)
+	return ok && !s.Show
+}
+
+// processSpells 对象进入或停留在格子上时，格子上的地面魔法对其生效
+func processSpells(o IMapObject) {
+	c := o.GetCell()
+	if c == nil {
+		return
+	}
+	c.Objects.Range(func(_, v interface{}) bool {
+		if s, ok := v.(*SpellObject); ok {
+			s.ProcessSpell(o)
+		}
+		return true
+	})
+}
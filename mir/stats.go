@@ -0,0 +1,471 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/setting"
+)
+
+// addUint16 属性加减，结果限制在类型范围内
+func addUint16(v uint16, n int) uint16 {
+	r := int(v) + n
+	if r < 0 {
+		return 0
+	}
+	if r > 0xFFFF {
+		return 0xFFFF
+	}
+	return uint16(r)
+}
+
+func addUint8(v uint8, n int) uint8 {
+	r := int(v) + n
+	if r < 0 {
+		return 0
+	}
+	if r > 0xFF {
+		return 0xFF
+	}
+	return uint8(r)
+}
+
+func addInt8(v int8, n int) int8 {
+	r := int(v) + n
+	if r < -128 {
+		return -128
+	}
+	if r > 127 {
+		return 127
+	}
+	return int8(r)
+}
+
+// 套装生效需要的件数
+var itemSetAmount = map[common.ItemSet]int{
+	common.ItemSetMundane:    2,
+	common.ItemSetNokChi:     2,
+	common.ItemSetTaoProtect: 2,
+	common.ItemSetWhisker1:   2,
+	common.ItemSetWhisker2:   2,
+	common.ItemSetWhisker3:   2,
+	common.ItemSetWhisker4:   2,
+	common.ItemSetWhisker5:   2,
+	common.ItemSetRedOrchid:  3,
+	common.ItemSetRedFlower:  3,
+	common.ItemSetSmash:      3,
+	common.ItemSetHwanDevil:  3,
+	common.ItemSetPurity:     3,
+	common.ItemSetBone:       3,
+	common.ItemSetBug:        3,
+	common.ItemSetWhiteGold:  3,
+	common.ItemSetWhiteGoldH: 3,
+	common.ItemSetRedJade:    3,
+	common.ItemSetRedJadeH:   3,
+	common.ItemSetNephrite:   3,
+	common.ItemSetNephriteH:  3,
+	common.ItemSetHyeolryong: 3,
+	common.ItemSetMonitor:    3,
+	common.ItemSetOppressive: 3,
+	common.ItemSetPaeok:      3,
+	common.ItemSetSulgwan:    3,
+	common.ItemSetSpirit:     4,
+	common.ItemSetRecall:     4,
+	common.ItemSetFiveString: 5,
+}
+
+// itemSet 身上穿戴的某个套装
+type itemSet struct {
+	count int
+	types map[common.ItemType]bool
+}
+
+func (s *itemSet) has(types ...common.ItemType) bool {
+	for _, t := range types {
+		if !s.types[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// equippedSets 统计穿戴的套装件数和部位，损坏的装备不算，key 为 ItemSet，Mir 套装另外按格子统计
+func (p *Player) equippedSets() (sets map[common.ItemSet]*itemSet, mirSet map[common.EquipmentSlot]bool) {
+	sets = make(map[common.ItemSet]*itemSet)
+	mirSet = make(map[common.EquipmentSlot]bool)
+	gdb := p.Map.Env.GameDB
+	for i := range p.Equipment {
+		ui := p.Equipment[i]
+		if ui.ID == 0 {
+			continue
+		}
+		info := gdb.GetItemInfoByID(int(ui.ItemID))
+		if info == nil || info.ItemSet == common.ItemSetNone || (ui.CurrentDura == 0 && info.Durability > 0) {
+			continue
+		}
+		if info.ItemSet == common.ItemSetMir {
+			mirSet[common.EquipmentSlot(i)] = true
+			continue
+		}
+		s, ok := sets[info.ItemSet]
+		if !ok {
+			s = &itemSet{types: make(map[common.ItemType]bool)}
+			sets[info.ItemSet] = s
+		}
+		s.count++
+		s.types[info.Type] = true
+	}
+	return
+}
+
+// RefreshItemSetStats 套装属性，部分套装戒指加手镯就有额外效果
+func (p *Player) RefreshItemSetStats() {
+	sets, _ := p.equippedSets()
+	for set, s := range sets {
+		if s.has(common.ItemTypeRing, common.ItemTypeBracelet) {
+			switch set {
+			case common.ItemSetSmash:
+				p.ASpeed = addInt8(p.ASpeed, 2)
+			case common.ItemSetPurity:
+				p.Holy = addUint8(p.Holy, 3)
+			case common.ItemSetHwanDevil:
+				p.MaxWearWeight = addUint16(p.MaxWearWeight, 5)
+				p.MaxBagWeight = addUint16(p.MaxBagWeight, 20)
+			}
+		}
+		if amount, ok := itemSetAmount[set]; !ok || s.count < amount {
+			continue
+		}
+		switch set {
+		case common.ItemSetMundane:
+			p.MaxHP = addUint16(p.MaxHP, 50)
+		case common.ItemSetNokChi:
+			p.MaxMP = addUint16(p.MaxMP, 50)
+		case common.ItemSetTaoProtect:
+			p.MaxHP = addUint16(p.MaxHP, 30)
+			p.MaxMP = addUint16(p.MaxMP, 30)
+		case common.ItemSetRedOrchid:
+			p.Accuracy = addUint8(p.Accuracy, 2)
+			p.HpDrainRate = addUint8(p.HpDrainRate, 10)
+		case common.ItemSetRedFlower:
+			p.MaxHP = addUint16(p.MaxHP, 50)
+			p.MaxMP = addUint16(p.MaxMP, -25)
+		case common.ItemSetSmash:
+			p.MinDC = addUint16(p.MinDC, 1)
+			p.MaxDC = addUint16(p.MaxDC, 3)
+		case common.ItemSetHwanDevil:
+			p.MinMC = addUint16(p.MinMC, 1)
+			p.MaxMC = addUint16(p.MaxMC, 2)
+		case common.ItemSetPurity:
+			p.MinSC = addUint16(p.MinSC, 1)
+			p.MaxSC = addUint16(p.MaxSC, 2)
+		case common.ItemSetFiveString:
+			p.MaxHP = addUint16(p.MaxHP, int(p.MaxHP)/100*30)
+			p.MinAC = addUint16(p.MinAC, 2)
+			p.MaxAC = addUint16(p.MaxAC, 2)
+		case common.ItemSetSpirit:
+			p.MinDC = addUint16(p.MinDC, 2)
+			p.MaxDC = addUint16(p.MaxDC, 5)
+			p.ASpeed = addInt8(p.ASpeed, 2)
+		case common.ItemSetBone:
+			p.MaxAC = addUint16(p.MaxAC, 2)
+			p.MaxMC = addUint16(p.MaxMC, 1)
+			p.MaxSC = addUint16(p.MaxSC, 1)
+		case common.ItemSetBug:
+			p.MaxDC = addUint16(p.MaxDC, 1)
+			p.MaxMC = addUint16(p.MaxMC, 1)
+			p.MaxSC = addUint16(p.MaxSC, 1)
+			p.MaxMAC = addUint16(p.MaxMAC, 1)
+			p.PoisonResist = addUint8(p.PoisonResist, 1)
+		case common.ItemSetWhiteGold:
+			p.MaxDC = addUint16(p.MaxDC, 2)
+			p.MaxAC = addUint16(p.MaxAC, 2)
+		case common.ItemSetWhiteGoldH:
+			p.MaxDC = addUint16(p.MaxDC, 3)
+			p.MaxHP = addUint16(p.MaxHP, 30)
+			p.ASpeed = addInt8(p.ASpeed, 2)
+		case common.ItemSetRedJade:
+			p.MaxMC = addUint16(p.MaxMC, 2)
+			p.MaxMAC = addUint16(p.MaxMAC, 2)
+		case common.ItemSetRedJadeH:
+			p.MaxMC = addUint16(p.MaxMC, 2)
+			p.MaxMP = addUint16(p.MaxMP, 40)
+			p.Agility = addUint8(p.Agility, 2)
+		case common.ItemSetNephrite:
+			p.MaxSC = addUint16(p.MaxSC, 2)
+			p.MaxAC = addUint16(p.MaxAC, 1)
+			p.MaxMAC = addUint16(p.MaxMAC, 1)
+		case common.ItemSetNephriteH, common.ItemSetHyeolryong:
+			p.MaxSC = addUint16(p.MaxSC, 2)
+			p.MaxHP = addUint16(p.MaxHP, 15)
+			p.MaxMP = addUint16(p.MaxMP, 20)
+			p.Holy = addUint8(p.Holy, 1)
+			p.Accuracy = addUint8(p.Accuracy, 1)
+		case common.ItemSetWhisker1:
+			p.MaxDC = addUint16(p.MaxDC, 1)
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, 25)
+		case common.ItemSetWhisker2:
+			p.MaxMC = addUint16(p.MaxMC, 1)
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, 17)
+		case common.ItemSetWhisker3:
+			p.MaxSC = addUint16(p.MaxSC, 1)
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, 17)
+		case common.ItemSetWhisker4:
+			p.MaxDC = addUint16(p.MaxDC, 1)
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, 20)
+		case common.ItemSetWhisker5:
+			p.MaxDC = addUint16(p.MaxDC, 1)
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, 17)
+		case common.ItemSetMonitor:
+			p.MagicResist = addUint8(p.MagicResist, 1)
+			p.PoisonResist = addUint8(p.PoisonResist, 1)
+		case common.ItemSetOppressive:
+			p.MaxAC = addUint16(p.MaxAC, 1)
+			p.Agility = addUint8(p.Agility, 1)
+		case common.ItemSetPaeok:
+			p.MaxMC = addUint16(p.MaxMC, 1)
+			p.MaxSC = addUint16(p.MaxSC, 1)
+		case common.ItemSetSulgwan:
+			p.MaxDC = addUint16(p.MaxDC, 1)
+			p.MaxAC = addUint16(p.MaxAC, 1)
+		}
+	}
+}
+
+// RefreshMirSetStats 圣战套装，按穿戴的部位组合加属性
+func (p *Player) RefreshMirSetStats() {
+	_, mir := p.equippedSets()
+	if len(mir) == 0 {
+		return
+	}
+	rings := mir[common.EquipmentSlotRingL] && mir[common.EquipmentSlotRingR]
+	bracelets := mir[common.EquipmentSlotBraceletL] && mir[common.EquipmentSlotBraceletR]
+	if len(mir) >= 10 {
+		p.MaxAC = addUint16(p.MaxAC, 1)
+		p.MaxMAC = addUint16(p.MaxMAC, 1)
+		p.MaxBagWeight = addUint16(p.MaxBagWeight, 70)
+		p.Luck = addInt8(p.Luck, 2)
+		p.ASpeed = addInt8(p.ASpeed, 2)
+		p.MaxHP = addUint16(p.MaxHP, 70)
+		p.MaxMP = addUint16(p.MaxMP, 80)
+		p.MagicResist = addUint8(p.MagicResist, 6)
+		p.PoisonResist = addUint8(p.PoisonResist, 6)
+	}
+	if rings {
+		p.MaxAC = addUint16(p.MaxAC, 1)
+		p.MaxMAC = addUint16(p.MaxMAC, 1)
+	}
+	if bracelets {
+		p.MinAC = addUint16(p.MinAC, 1)
+		p.MinMAC = addUint16(p.MinMAC, 1)
+	}
+	if (mir[common.EquipmentSlotRingL] || mir[common.EquipmentSlotRingR]) &&
+		(mir[common.EquipmentSlotBraceletL] || mir[common.EquipmentSlotBraceletR]) &&
+		mir[common.EquipmentSlotNecklace] {
+		p.MaxAC = addUint16(p.MaxAC, 1)
+		p.MaxMAC = addUint16(p.MaxMAC, 1)
+		p.MaxBagWeight = addUint16(p.MaxBagWeight, 30)
+		p.MaxWearWeight = addUint16(p.MaxWearWeight, 17)
+	}
+	if rings && bracelets && mir[common.EquipmentSlotNecklace] {
+		p.MaxAC = addUint16(p.MaxAC, 1)
+		p.MaxMAC = addUint16(p.MaxMAC, 1)
+		p.MaxBagWeight = addUint16(p.MaxBagWeight, 20)
+		p.MaxWearWeight = addUint16(p.MaxWearWeight, 10)
+	}
+	armour := mir[common.EquipmentSlotArmour]
+	if armour && mir[common.EquipmentSlotHelmet] && mir[common.EquipmentSlotWeapon] {
+		p.MaxDC = addUint16(p.MaxDC, 2)
+		p.MaxMC = addUint16(p.MaxMC, 1)
+		p.MaxSC = addUint16(p.MaxSC, 1)
+		p.Agility = addUint8(p.Agility, 1)
+	}
+	if armour && mir[common.EquipmentSlotBoots] && mir[common.EquipmentSlotBelt] {
+		p.MaxDC = addUint16(p.MaxDC, 1)
+		p.MaxMC = addUint16(p.MaxMC, 1)
+		p.MaxSC = addUint16(p.MaxSC, 1)
+		p.MaxHandWeight = addUint16(p.MaxHandWeight, 17)
+	}
+	if armour && mir[common.EquipmentSlotBoots] && mir[common.EquipmentSlotBelt] &&
+		mir[common.EquipmentSlotHelmet] && mir[common.EquipmentSlotWeapon] {
+		p.MinDC = addUint16(p.MinDC, 1)
+		p.MaxDC = addUint16(p.MaxDC, 1)
+		p.MinMC = addUint16(p.MinMC, 1)
+		p.MaxMC = addUint16(p.MaxMC, 1)
+		p.MinSC = addUint16(p.MinSC, 1)
+		p.MaxSC = addUint16(p.MaxSC, 1)
+		p.MaxHandWeight = addUint16(p.MaxHandWeight, 17)
+	}
+}
+
+// RefreshSkills 被动技能加成
+func (p *Player) RefreshSkills() {
+	for _, m := range p.Magics {
+		switch m.Spell {
+		case common.SpellFencing:
+			p.Accuracy = addUint8(p.Accuracy, m.Level*3)
+			p.MaxAC = addUint16(p.MaxAC, (m.Level+1)*3)
+		case common.SpellFatalSword, common.SpellFocus:
+			p.Accuracy = addUint8(p.Accuracy, m.Level)
+		case common.SpellSpiritSword:
+			p.Accuracy = addUint8(p.Accuracy, m.Level)
+			p.MaxDC = addUint16(p.MaxDC, int(float32(p.MaxSC)*float32(m.Level+1)*0.1))
+		}
+	}
+}
+
+// RefreshBuffs 增益效果加成，过期的 Buff 不计算
+func (p *Player) RefreshBuffs() {
+	now := time.Now()
+	for _, b := range p.Buffs {
+		if !b.Infinite && now.After(b.ExpireTime) {
+			continue
+		}
+		v := b.Values
+		switch b.BuffType {
+		case common.BuffTypeHaste, common.BuffTypeFury, common.BuffTypeStorm:
+			p.ASpeed = addInt8(p.ASpeed, v)
+		case common.BuffTypeLightBody:
+			p.Agility = addUint8(p.Agility, v)
+		case common.BuffTypeSoulShield, common.BuffTypeMagicDefence:
+			p.MaxMAC = addUint16(p.MaxMAC, v)
+		case common.BuffTypeBlessedArmour, common.BuffTypeProtectionField, common.BuffTypeDefence:
+			p.MaxAC = addUint16(p.MaxAC, v)
+		case common.BuffTypeImmortalSkin:
+			p.MaxAC = addUint16(p.MaxAC, v)
+			p.MaxDC = addUint16(p.MaxDC, -v)
+		case common.BuffTypeUltimateEnhancer:
+			switch p.Class {
+			case common.MirClassWizard, common.MirClassArcher:
+				p.MaxMC = addUint16(p.MaxMC, v)
+			case common.MirClassTaoist:
+				p.MaxSC = addUint16(p.MaxSC, v)
+			default:
+				p.MaxDC = addUint16(p.MaxDC, v)
+			}
+		case common.BuffTypeRage, common.BuffTypeImpact:
+			p.MaxDC = addUint16(p.MaxDC, v)
+		case common.BuffTypeCounterAttack:
+			p.MinAC = addUint16(p.MinAC, v)
+			p.MaxAC = addUint16(p.MaxAC, v)
+			p.MinMAC = addUint16(p.MinMAC, v)
+			p.MaxMAC = addUint16(p.MaxMAC, v)
+		case common.BuffTypeCurse:
+			// v 为百分比
+			p.MaxDC = addUint16(p.MaxDC, -int(p.MaxDC)*v/100)
+			p.MaxMC = addUint16(p.MaxMC, -int(p.MaxMC)*v/100)
+			p.MaxSC = addUint16(p.MaxSC, -int(p.MaxSC)*v/100)
+			p.ASpeed = addInt8(p.ASpeed, -int(p.ASpeed)*v/100)
+		case common.BuffTypeMagicBooster:
+			p.MinMC = addUint16(p.MinMC, v)
+			p.MaxMC = addUint16(p.MaxMC, v)
+		case common.BuffTypeMagic:
+			p.MaxMC = addUint16(p.MaxMC, v)
+		case common.BuffTypeTaoist:
+			p.MaxSC = addUint16(p.MaxSC, v)
+		case common.BuffTypeHealthAid:
+			p.MaxHP = addUint16(p.MaxHP, v)
+		case common.BuffTypeManaAid:
+			p.MaxMP = addUint16(p.MaxMP, v)
+		case common.BuffTypeBagWeight, common.BuffTypeKnapsack:
+			p.MaxBagWeight = addUint16(p.MaxBagWeight, v)
+		case common.BuffTypeExp:
+			p.ExpRateOffset += float32(v)
+		case common.BuffTypeDrop:
+			p.ItemDropRateOffset += float32(v)
+		case common.BuffTypeGold:
+			p.GoldDropRateOffset += float32(v)
+		case common.BuffTypeGeneral:
+			p.ExpRateOffset += float32(v)
+			p.ItemDropRateOffset += float32(v)
+			p.GoldDropRateOffset += float32(v)
+		}
+	}
+}
+
+// GuildBuffInfo 行会增益的属性
+type GuildBuffInfo struct {
+	AC, MAC, DC, MC, SC int
+	MaxHP, MaxMP        int
+	HealthRecovery      int
+	SpellRecovery       int
+	Attack              int
+	MineRate            int
+	GemRate             int
+	FishRate            int
+	CraftRate           int
+	ExpRate             float32
+	DropRate            float32
+	GoldRate            float32
+}
+
+// GuildBuff 行会增益，Active 为 false 时不生效
+type GuildBuff struct {
+	Info   *GuildBuffInfo
+	Active bool
+}
+
+// RefreshGuildBuffs 行会增益加成
+func (p *Player) RefreshGuildBuffs() {
+	for _, b := range p.GuildBuffs {
+		if !b.Active || b.Info == nil {
+			continue
+		}
+		info := b.Info
+		p.MaxAC = addUint16(p.MaxAC, info.AC)
+		p.MaxMAC = addUint16(p.MaxMAC, info.MAC)
+		p.MaxDC = addUint16(p.MaxDC, info.DC)
+		p.MaxMC = addUint16(p.MaxMC, info.MC)
+		p.MaxSC = addUint16(p.MaxSC, info.SC)
+		p.MaxHP = addUint16(p.MaxHP, info.MaxHP)
+		p.MaxMP = addUint16(p.MaxMP, info.MaxMP)
+		p.HealthRecovery = addUint8(p.HealthRecovery, info.HealthRecovery)
+		p.SpellRecovery = addUint8(p.SpellRecovery, info.SpellRecovery)
+		p.AttackBonus = addUint8(p.AttackBonus, info.Attack)
+		p.MineRate = addUint8(p.MineRate, info.MineRate)
+		p.GemRate = addUint8(p.GemRate, info.GemRate)
+		p.FishRate = addUint8(p.FishRate, info.FishRate)
+		p.CraftRate = addUint8(p.CraftRate, info.CraftRate)
+		p.ExpRateOffset += info.ExpRate
+		p.ItemDropRateOffset += info.DropRate
+		p.GoldDropRateOffset += info.GoldRate
+	}
+}
+
+// RefreshStatCaps 属性上限，见 setting.StatCaps，最小值不能超过最大值
+func (p *Player) RefreshStatCaps() {
+	caps := setting.StatCaps
+	minUint8 := func(v *uint8, max uint8) {
+		if *v > max {
+			*v = max
+		}
+	}
+	minUint8(&p.MagicResist, caps.MagicResist)
+	minUint8(&p.PoisonResist, caps.PoisonResist)
+	minUint8(&p.CriticalRate, caps.CriticalRate)
+	minUint8(&p.CriticalDamage, caps.CriticalDamage)
+	minUint8(&p.Freezing, caps.Freezing)
+	minUint8(&p.PoisonAttack, caps.PoisonAttack)
+	minUint8(&p.HealthRecovery, caps.HealthRegen)
+	minUint8(&p.SpellRecovery, caps.ManaRegen)
+	minUint8(&p.PoisonRecovery, caps.PoisonRecovery)
+	minUint8(&p.HpDrainRate, caps.HpDrainRate)
+
+	for _, s := range [][2]*uint16{
+		{&p.MinAC, &p.MaxAC},
+		{&p.MinMAC, &p.MaxMAC},
+		{&p.MinDC, &p.MaxDC},
+		{&p.MinMC, &p.MaxMC},
+		{&p.MinSC, &p.MaxSC},
+	} {
+		if *s[0] > *s[1] {
+			*s[0] = *s[1]
+		}
+	}
+	if p.HP > p.MaxHP {
+		p.HP = p.MaxHP
+	}
+	if p.MP > p.MaxMP {
+		p.MP = p.MaxMP
+	}
+}
@@ -0,0 +1,56 @@
+package mir
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/yenkeia/mirgo/common"
+)
+
+// newTestPlayer 创建只带物品表的玩家，用于计算属性
+func newTestPlayer(items ...common.ItemInfo) *Player {
+	gdb := &GameDB{ItemIDInfoMap: new(sync.Map), ExpList: []int64{100, 200, 300}}
+	for i := range items {
+		gdb.ItemIDInfoMap.Store(int(items[i].ID), &items[i])
+	}
+	m := NewMap(10, 10)
+	m.Env = &Environ{GameDB: gdb}
+	p := new(Player)
+	p.Map = m
+	p.Class = common.MirClassWarrior
+	p.Level = 2
+	p.Equipment = make([]common.UserItem, 14)
+	return p
+}
+
+func TestRefreshStatsTwice(t *testing.T) {
+	p := newTestPlayer()
+	p.Buffs = []*Buff{{BuffType: common.BuffTypeGeneral, Infinite: true, Values: 20}}
+	p.GuildBuffs = []GuildBuff{{Active: true, Info: &GuildBuffInfo{Attack: 3, CraftRate: 5, MineRate: 2, ExpRate: 10}}}
+
+	p.RefreshStats()
+	exp, drop, gold := p.ExpRateOffset, p.ItemDropRateOffset, p.GoldDropRateOffset
+	attack, craft, mine := p.AttackBonus, p.CraftRate, p.MineRate
+	if exp != 30 || drop != 20 || gold != 20 || attack != 3 || craft != 5 || mine != 2 {
+		t.Fatalf("exp=%v drop=%v gold=%v attack=%v craft=%v mine=%v", exp, drop, gold, attack, craft, mine)
+	}
+
+	p.RefreshStats()
+	if p.ExpRateOffset != exp || p.ItemDropRateOffset != drop || p.GoldDropRateOffset != gold ||
+		p.AttackBonus != attack || p.CraftRate != craft || p.MineRate != mine {
+		t.Fatalf("再次刷新后属性被重复累加: exp=%v drop=%v gold=%v attack=%v craft=%v mine=%v",
+			p.ExpRateOffset, p.ItemDropRateOffset, p.GoldDropRateOffset, p.AttackBonus, p.CraftRate, p.MineRate)
+	}
+}
+
+func TestEquipmentExpRate(t *testing.T) {
+	p := newTestPlayer(common.ItemInfo{ID: 1, Type: common.ItemTypeNecklace, ExpRate: 15})
+	p.Equipment[common.EquipmentSlotNecklace] = common.UserItem{ID: 1, ItemID: 1, Count: 1}
+	p.Buffs = []*Buff{{BuffType: common.BuffTypeExp, Infinite: true, Values: 10}}
+
+	p.RefreshStats()
+	p.RefreshStats()
+	if p.ExpRateOffset != 25 {
+		t.Fatalf("ExpRateOffset = %v", p.ExpRateOffset)
+	}
+}
@@ -0,0 +1,187 @@
+package mir
+
+import (
+	"fmt"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+const (
+	StorageSize         = 80      // 仓库格子数
+	ExpandedStorageSize = 160     // 扩展后的仓库格子数
+	ExpandStorageGold   = 1000000 // 扩展仓库花费
+)
+
+// SendStorage 打开仓库，发送仓库物品
+func (p *Player) SendStorage() {
+	for i := range p.Storage {
+		if p.Storage[i].ID != 0 {
+			p.EnqueueItemInfo(p.Storage[i].ItemID)
+		}
+	}
+	p.Enqueue(&server.UserStorage{Storage: p.Storage})
+}
+
+// ExpandStorage 扩展仓库
+func (p *Player) ExpandStorage() {
+	if p.HasExpandedStorage {
+		p.ReceiveChat("仓库已经扩展过了", common.ChatTypeSystem)
+		return
+	}
+	if p.Gold < ExpandStorageGold {
+		p.ReceiveChat(fmt.Sprintf("扩展仓库需要 %d 金币", ExpandStorageGold), common.ChatTypeSystem)
+		return
+	}
+	p.TakeGold(ExpandStorageGold)
+	storage := make([]common.UserItem, ExpandedStorageSize)
+	copy(storage, p.Storage)
+	p.Storage = storage
+	p.HasExpandedStorage = true
+	p.Enqueue(&server.ResizeStorage{Size: ExpandedStorageSize, HasExpandedStorage: true})
+	p.ReceiveChat("仓库扩展成功", common.ChatTypeSystem)
+}
+
+// isStorageOpen 是否在仓库 NPC 处
+func (p *Player) isStorageOpen() bool {
+	return p.CallingNPC != nil && p.CallingNPC.Map == p.Map &&
+		InRange(p.CallingNPC.GetPoint(), p.CurrentLocation, DataRange)
+}
+
+// mergeItem 把 from 叠加到 to 上，返回叠加的数量
+func (p *Player) mergeItem(from, to *common.UserItem) uint32 {
+	if from.ItemID != to.ItemID {
+		return 0
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(to.ItemID))
+	if info == nil || info.StackSize <= 1 || to.Count >= info.StackSize {
+		return 0
+	}
+	n := info.StackSize - to.Count
+	if n > from.Count {
+		n = from.Count
+	}
+	to.Count += n
+	from.Count -= n
+	return n
+}
+
+// StoreItem 背包物品放入仓库，目标格子是相同物品时叠加
+func (p *Player) StoreItem(from int32, to int32) {
+	msg := &server.StoreItem{
+		From:    from,
+		To:      to,
+		Success: false,
+	}
+	if !p.isStorageOpen() ||
+		from < 0 || int(from) >= len(p.Inventory) ||
+		to < 0 || int(to) >= len(p.Storage) {
+		p.Enqueue(msg)
+		return
+	}
+	item := &p.Inventory[from]
+	if item.ID == 0 {
+		p.Enqueue(msg)
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil || common.BindMode(info.Bind)&common.BindModeDontStore != 0 {
+		p.ReceiveChat("该物品不能存入仓库", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	target := &p.Storage[to]
+	if target.ID == 0 {
+		*target = *item
+		*item = common.UserItem{}
+		p.RefreshBagWeight()
+		msg.Success = true
+		p.Enqueue(msg)
+		return
+	}
+	id := item.ID
+	n := p.mergeItem(item, target)
+	msg.Success = n != 0
+	p.Enqueue(msg)
+	if n == 0 {
+		return
+	}
+	if item.Count == 0 {
+		*item = common.UserItem{}
+		p.Enqueue(&server.DeleteItem{UniqueID: id, Count: n})
+	} else {
+		p.Enqueue(&server.RefreshItem{Item: *item})
+	}
+	p.RefreshBagWeight()
+	p.SendStorage()
+}
+
+// TakeBackItem 仓库物品取回背包，目标格子是相同物品时叠加
+func (p *Player) TakeBackItem(from int32, to int32) {
+	msg := &server.TakeBackItem{
+		From:    from,
+		To:      to,
+		Success: false,
+	}
+	if !p.isStorageOpen() ||
+		from < 0 || int(from) >= len(p.Storage) ||
+		to < 0 || int(to) >= len(p.Inventory) {
+		p.Enqueue(msg)
+		return
+	}
+	item := &p.Storage[from]
+	if item.ID == 0 {
+		p.Enqueue(msg)
+		return
+	}
+	info := p.Map.Env.GameDB.GetItemInfoByID(int(item.ItemID))
+	if info == nil {
+		p.Enqueue(msg)
+		return
+	}
+	if p.CurrentBagWeight+int(info.Weight) > int(p.MaxBagWeight) {
+		p.ReceiveChat("负重不足，无法取回", common.ChatTypeSystem)
+		p.Enqueue(msg)
+		return
+	}
+	target := &p.Inventory[to]
+	if target.ID == 0 {
+		*target = *item
+		*item = common.UserItem{}
+		p.RefreshBagWeight()
+		msg.Success = true
+		p.Enqueue(msg)
+		return
+	}
+	n := p.mergeItem(item, target)
+	msg.Success = n != 0
+	p.Enqueue(msg)
+	if n == 0 {
+		return
+	}
+	if item.Count == 0 {
+		*item = common.UserItem{}
+	}
+	p.Enqueue(&server.RefreshItem{Item: *target})
+	p.RefreshBagWeight()
+	p.SendStorage()
+}
+
+// moveStorageItem 仓库内移动物品，目标格子是相同物品时叠加
+func (p *Player) moveStorageItem(from int32, to int32) bool {
+	if !p.isStorageOpen() || from == to ||
+		from < 0 || int(from) >= len(p.Storage) ||
+		to < 0 || int(to) >= len(p.Storage) {
+		return false
+	}
+	a, b := &p.Storage[from], &p.Storage[to]
+	if a.ID != 0 && b.ID != 0 && p.mergeItem(a, b) != 0 {
+		if a.Count == 0 {
+			*a = common.UserItem{}
+		}
+		p.SendStorage()
+		return false
+	}
+	*a, *b = *b, *a
+	return true
+}
@@ -0,0 +1,158 @@
+package mir
+
+import (
+	"time"
+
+	"github.com/yenkeia/mirgo/common"
+	"github.com/yenkeia/mirgo/proto/server"
+)
+
+// SpellToggles 攻击时生效的技能开关，和客户端保持同步
+type SpellToggles struct {
+	Slaying          bool      // 攻杀剑术，攻击后随机触发，下一次攻击生效
+	Thrusting        bool      // 刺杀剑术
+	HalfMoon         bool      // 半月弯刀
+	CrossHalfMoon    bool      // 圆月弯刀
+	DoubleSlash      bool      // 风剑术
+	TwinDrakeBlade   bool      // 双龙斩，开启时消耗魔法，下一次攻击生效
+	FlamingSword     bool      // 烈火剑法，开启时消耗魔法，下一次攻击生效
+	FlamingSwordTime time.Time // 烈火剑法失效时间，在此之前不能再次开启
+}
+
+// FlamingSwordDuration 烈火剑法开启后的有效时间，也是冷却时间
+const FlamingSwordDuration = 10 * time.Second
+
+// magicCost 技能消耗的魔法值
+func magicCost(magic *common.UserMagic) int {
+	if magic.Info == nil {
+		return 0
+	}
+	return magic.Info.BaseCost + magic.Info.LevelCost*magic.Level
+}
+
+// costMagic 扣除技能消耗的魔法值，魔法不足时返回 false
+func (p *Player) costMagic(magic *common.UserMagic) bool {
+	cost := magicCost(magic)
+	if cost > int(p.MP) {
+		return false
+	}
+	if cost > 0 {
+		p.ChangeMP(-cost)
+	}
+	return true
+}
+
+// setToggle 改变技能开关并通知客户端
+func (p *Player) setToggle(spell common.Spell, use bool) {
+	switch spell {
+	case common.SpellSlaying:
+		p.Toggles.Slaying = use
+	case common.SpellThrusting:
+		p.Toggles.Thrusting = use
+	case common.SpellHalfMoon:
+		p.Toggles.HalfMoon = use
+	case common.SpellCrossHalfMoon:
+		p.Toggles.CrossHalfMoon = use
+	case common.SpellDoubleSlash:
+		p.Toggles.DoubleSlash = use
+	case common.SpellTwinDrakeBlade:
+		p.Toggles.TwinDrakeBlade = use
+	case common.SpellFlamingSword:
+		p.Toggles.FlamingSword = use
+	default:
+		return
+	}
+	p.Enqueue(&server.SpellToggle{Spell: spell, CanUse: use})
+}
+
+// attackSpell 检查客户端攻击时使用的技能，没学会、没开启或魔法不足时返回 SpellNone
+func (p *Player) attackSpell(spell common.Spell) (common.Spell, *common.UserMagic) {
+	magic := p.GetMagic(spell)
+	if magic == nil {
+		return common.SpellNone, nil
+	}
+	t := &p.Toggles
+	ok := false
+	switch spell {
+	case common.SpellSlaying:
+		ok = t.Slaying
+	case common.SpellThrusting:
+		ok = t.Thrusting
+	case common.SpellHalfMoon:
+		ok = t.HalfMoon && p.costMagic(magic)
+	case common.SpellCrossHalfMoon:
+		ok = t.CrossHalfMoon && p.costMagic(magic)
+	case common.SpellDoubleSlash:
+		ok = t.DoubleSlash && p.costMagic(magic)
+	case common.SpellTwinDrakeBlade:
+		ok = t.TwinDrakeBlade
+	case common.SpellFlamingSword:
+		ok = t.FlamingSword
+	}
+	if !ok {
+		return common.SpellNone, nil
+	}
+	return spell, magic
+}
+
+// attackCell 近身攻击格子上的目标，返回是否造成了伤害
+func (p *Player) attackCell(location common.Point, damage int) bool {
+	hit := false
+	p.Map.rangeAttackTargets(p, location, func(o IMapObject) {
+		if attackObject(o, p, damage, common.DefenceTypeAgility, true) > 0 {
+			hit = true
+		}
+	})
+	return hit
+}
+
+// attackSkill 普通攻击之外技能造成的额外伤害
+func (p *Player) attackSkill(spell common.Spell, magic *common.UserMagic, damageBase int) {
+	dir := p.CurrentDirection
+	front := p.CurrentLocation.NextPoint(dir, 1)
+	var targets []common.Point
+	switch spell {
+	case common.SpellThrusting: // 刺杀穿透到第二格
+		targets = []common.Point{front.NextPoint(dir, 1)}
+	case common.SpellHalfMoon: // 半月攻击前方两侧
+		for _, d := range []int{7, 1, 2} {
+			targets = append(targets, p.CurrentLocation.NextPoint(common.MirDirection((int(dir)+d)%8), 1))
+		}
+	case common.SpellCrossHalfMoon: // 圆月攻击周围一圈
+		for d := 1; d < 8; d++ {
+			targets = append(targets, p.CurrentLocation.NextPoint(common.MirDirection((int(dir)+d)%8), 1))
+		}
+	case common.SpellTwinDrakeBlade, common.SpellDoubleSlash: // 对前方再砍一次
+		targets = []common.Point{front}
+	default:
+		return
+	}
+	damage := magic.GetDamage(damageBase)
+	hit := false
+	for _, pt := range targets {
+		if p.attackCell(pt, damage) {
+			hit = true
+		}
+	}
+	if hit {
+		p.LevelMagic(magic)
+	}
+}
+
+// rollSlaying 攻击后按攻杀剑术的等级随机触发下一次攻杀
+func (p *Player) rollSlaying() {
+	magic := p.GetMagic(common.SpellSlaying)
+	if magic == nil || p.Toggles.Slaying {
+		return
+	}
+	if RandomNext(12) <= magic.Level {
+		p.setToggle(common.SpellSlaying, true)
+	}
+}
+
+// ProcessToggles 烈火剑法开启后超时未使用则失效
+func (p *Player) ProcessToggles() {
+	if p.Toggles.FlamingSword && !time.Now().Before(p.Toggles.FlamingSwordTime) {
+		p.setToggle(common.SpellFlamingSword, false)
+	}
+}
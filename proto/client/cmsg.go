@@ -312,7 +312,7 @@ type ChangeAMode struct {
 }
 
 type ChangePMode struct {
-	Mode common.AttackMode
+	Mode common.PetMode
 }
 
 type ChangeTrade struct {
@@ -355,8 +355,10 @@ type SellItem struct {
 	Count    uint32
 }
 
-// TODO
 type CraftItem struct {
+	UniqueID uint64
+	Count    uint32
+	Slots    []int32
 }
 
 type RepairItem struct {
@@ -494,7 +496,6 @@ type AllowMentor struct{}
 // TODO
 type CancelMentor struct{}
 
-// TODO
 type TradeRequest struct{}
 
 // TODO
@@ -536,29 +537,41 @@ type AcceptReincarnation struct{}
 // TODO
 type CancelReincarnation struct{}
 
-// TODO
-type CombineItem struct{}
+type CombineItem struct {
+	IDFrom uint64
+	IDTo   uint64
+}
 
 // TODO
 type SetConcentration struct{}
 
-// TODO
-type AwakeningNeedMaterials struct{}
+type AwakeningNeedMaterials struct {
+	UniqueID uint64
+	Type     common.AwakeType
+}
 
-// TODO
-type AwakeningLockedItem struct{}
+type AwakeningLockedItem struct {
+	UniqueID uint64
+	Locked   bool
+}
 
-// TODO
-type Awakening struct{}
+type Awakening struct {
+	UniqueID    uint64
+	Type        common.AwakeType
+	PositionIdx uint32
+}
 
-// TODO
-type DisassembleItem struct{}
+type DisassembleItem struct {
+	UniqueID uint64
+}
 
-// TODO
-type DowngradeAwakening struct{}
+type DowngradeAwakening struct {
+	UniqueID uint64
+}
 
-// TODO
-type ResetAddedItem struct{}
+type ResetAddedItem struct {
+	UniqueID uint64
+}
 
 // TODO
 type SendMail struct{}
@@ -587,17 +600,21 @@ type UpdateIntelligentCreature struct{}
 // TODO
 type IntelligentCreaturePickup struct{}
 
-// TODO
-type AddFriend struct{}
+type AddFriend struct {
+	Name    string
+	Blocked bool
+}
 
-// TODO
-type RemoveFriend struct{}
+type RemoveFriend struct {
+	CharacterIndex int32
+}
 
-// TODO
 type RefreshFriends struct{}
 
-// TODO
-type AddMemo struct{}
+type AddMemo struct {
+	CharacterIndex int32
+	Memo           string
+}
 
 // TODO
 type GuildBuffUpdate struct{}
@@ -605,14 +622,19 @@ type GuildBuffUpdate struct{}
 // TODO
 type NPCConfirmInput struct{}
 
-// TODO
-type GameshopBuy struct{}
+type GameshopBuy struct {
+	GIndex   int32
+	Quantity uint8
+}
 
 // TODO
 type ReportIssue struct{}
 
-// TODO
-type GetRanking struct{}
+type GetRanking struct {
+	RankIndex  uint8 // 0 总榜，1 以后是职业 + 1
+	StartIndex int32
+	OnlineOnly bool
+}
 
 // TODO
 type Opendoor struct{}
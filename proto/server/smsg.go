@@ -1089,9 +1089,15 @@ type InTrapRock struct{}
 
 type BaseStatsInfo struct{}
 
-type UserName struct{}
+type UserName struct {
+	ID   uint32
+	Name string
+}
 
-type ChatItemStats struct{}
+type ChatItemStats struct {
+	ChatItemID uint64
+	Stats      common.UserItem
+}
 
 type GuildNoticeChange struct{}
 
@@ -1125,7 +1131,9 @@ type DivorceRequest struct{}
 
 type MentorRequest struct{}
 
-type TradeRequest struct{}
+type TradeRequest struct {
+	Name string
+}
 
 type TradeAccept struct{}
 
@@ -1169,9 +1177,16 @@ type ObjectDashAttack struct{}
 
 type UserAttackMove struct{}
 
-type CombineItem struct{}
+type CombineItem struct {
+	IDFrom  uint64
+	IDTo    uint64
+	Success bool
+	Destroy bool
+}
 
-type ItemUpgraded struct{}
+type ItemUpgraded struct {
+	Item common.UserItem
+}
 
 type SetConcentration struct {
 	ObjectID    uint32
@@ -1197,9 +1212,18 @@ type NPCAwakening struct{}
 type NPCDisassemble struct{}
 type NPCDowngrade struct{}
 type NPCReset struct{}
-type AwakeningNeedMaterials struct{}
-type AwakeningLockedItem struct{}
-type Awakening struct{}
+type AwakeningNeedMaterials struct {
+	Materials      []common.ItemInfo
+	MaterialsCount []int
+}
+type AwakeningLockedItem struct {
+	UniqueID uint64
+	Locked   bool
+}
+type Awakening struct {
+	Result   int32 // 1 成功, 0 失败并降级, 2 失败, -1 错误
+	RemoveID int64
+}
 type ReceiveMail struct{}
 type MailLockedItem struct{}
 type MailSendRequest struct{}
@@ -1207,21 +1231,42 @@ type MailSent struct{}
 type ParcelCollected struct{}
 type MailCost struct{}
 type ResizeInventory struct{}
-type ResizeStorage struct{}
+type ResizeStorage struct {
+	Size               int32
+	HasExpandedStorage bool
+	ExpiryTime         int64
+}
 type NewIntelligentCreature struct{}
 type UpdateIntelligentCreatureList struct{}
 type IntelligentCreatureEnableRename struct{}
 type IntelligentCreaturePickup struct{}
-type NPCPearlGoods struct{}
+type NPCPearlGoods struct {
+	Goods []common.UserItem
+	Rate  float32
+	Type  common.PanelType
+}
 type TransformUpdate struct{}
-type FriendUpdate struct{}
+type FriendUpdate struct {
+	Friends []common.ClientFriend
+}
 type LoverUpdate struct{}
 type MentorUpdate struct{}
 type GuildBuffList struct{}
 type NPCRequestInput struct{}
-type GameShopInfo struct{}
-type GameShopStock struct{}
-type Rankings struct{}
+type GameShopInfo struct {
+	Item       common.GameShopItem
+	StockLevel int32
+}
+type GameShopStock struct {
+	GIndex     int32
+	StockLevel int32
+}
+type Rankings struct {
+	RankType uint8
+	MyRank   int32 // 0 表示未上榜
+	Listings []common.RankCharacterInfo
+	Count    int32
+}
 type Opendoor struct{}
 type GetRentedItems struct{}
 type ItemRentalRequest struct{}
@@ -1235,5 +1280,7 @@ type ItemRentalLock struct{}
 type ItemRentalPartnerLock struct{}
 type CanConfirmItemRental struct{}
 type ConfirmItemRental struct{}
-type NewRecipeInfo struct{}
+type NewRecipeInfo struct {
+	Info common.ClientRecipeInfo
+}
 type OpenBrowser struct{}
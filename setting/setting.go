@@ -7,18 +7,49 @@ import "github.com/yenkeia/mirgo/common"
 var (
 	Conf      config
 	BaseStats map[common.MirClass]baseStats
+	StatCaps  statCaps
+	// RandomItemStats 物品附加属性随机规则，下标为 ItemInfo.RandomStatsId
+	RandomItemStats []common.RandomItemStat
+	// DefaultExpList 找不到 ExpList.ini 时使用的升级经验表
+	DefaultExpList = []int64{
+		100, 200, 300, 400, 600, 900, 1200, 1700, 2500, 6000,
+		8000, 10000, 15000, 30000, 40000, 50000, 70000, 100000, 120000, 140000,
+		250000, 300000, 350000, 400000, 500000, 700000, 1000000, 1400000, 1800000, 2000000,
+		2400000, 2800000, 3200000, 3600000, 4000000, 4800000, 5600000, 8200000, 9000000, 12000000,
+		16000000, 30000000, 50000000, 80000000, 120000000, 480000000, 1000000000, 3000000000, 3500000000, 4000000000,
+	}
 )
 
 func init() {
 	gopath := os.Getenv("GOPATH")
 	Conf = config{
-		Addr:          "0.0.0.0:7000",
-		DBPath:        gopath + "/src/github.com/yenkeia/mirgo/dotnettools/mir.sqlite",
-		MapDirPath:    gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Maps/",
-		ScriptDirPath: gopath + "/src/github.com/yenkeia/mirgo/script/",
-		DropDirPath:   gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Envir/Drops/",
-		NPCDirPath:    gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Envir/NPCs/",
+		Addr:                  "0.0.0.0:7000",
+		DBPath:                gopath + "/src/github.com/yenkeia/mirgo/dotnettools/mir.sqlite",
+		MapDirPath:            gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Maps/",
+		ScriptDirPath:         gopath + "/src/github.com/yenkeia/mirgo/script/",
+		DropDirPath:           gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Envir/Drops/",
+		NPCDirPath:            gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Envir/NPCs/",
+		RecipeDirPath:         gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Envir/Recipe/",
+		ExpListPath:           gopath + "/src/github.com/yenkeia/mirgo/dotnettools/database/Configs/ExpList.ini",
+		BehaviorDirPath:       gopath + "/src/github.com/yenkeia/mirgo/mir/behavior/trees/",
+		ExpRate:               1,
+		ExpMobLevelDifference: true,
+		AllowCreateAssassin:   true,
+		AllowCreateArcher:     true,
+	}
+	StatCaps = statCaps{
+		MagicResist:    6,
+		PoisonResist:   6,
+		CriticalRate:   18,
+		CriticalDamage: 10,
+		Freezing:       6,
+		PoisonAttack:   6,
+		HealthRegen:    8,
+		ManaRegen:      8,
+		PoisonRecovery: 6,
+		HpDrainRate:    100,
 	}
+	RandomItemStats = defaultRandomItemStats()
 	BaseStats = make(map[common.MirClass]baseStats)
 	BaseStats[common.MirClassWarrior] = baseStats{
 		HpGain:              4,
@@ -92,15 +123,70 @@ func init() {
 		CritialRateGain:     0,
 		CriticalDamageGain:  0,
 	}
+	BaseStats[common.MirClassAssassin] = baseStats{
+		HpGain:              12,
+		HpGainRate:          3.3,
+		MpGainRate:          0,
+		BagWeightGain:       3.5,
+		WearWeightGain:      33,
+		HandWeightGain:      30,
+		MinAc:               0,
+		MaxAc:               12,
+		MinMac:              0,
+		MaxMac:              15,
+		MinDc:               8,
+		MaxDc:               6,
+		MinMc:               0,
+		MaxMc:               0,
+		MinSc:               0,
+		MaxSc:               0,
+		StartAgility:        20,
+		StartAccuracy:       5,
+		StartCriticalRate:   0,
+		StartCriticalDamage: 0,
+		CritialRateGain:     0,
+		CriticalDamageGain:  0,
+	}
+	BaseStats[common.MirClassArcher] = baseStats{
+		HpGain:              9,
+		HpGainRate:          3.5,
+		MpGainRate:          0,
+		BagWeightGain:       4,
+		WearWeightGain:      33,
+		HandWeightGain:      30,
+		MinAc:               0,
+		MaxAc:               0,
+		MinMac:              0,
+		MaxMac:              0,
+		MinDc:               8,
+		MaxDc:               8,
+		MinMc:               8,
+		MaxMc:               8,
+		MinSc:               0,
+		MaxSc:               0,
+		StartAgility:        15,
+		StartAccuracy:       8,
+		StartCriticalRate:   0,
+		StartCriticalDamage: 0,
+		CritialRateGain:     0,
+		CriticalDamageGain:  0,
+	}
 }
 
 type config struct {
-	Addr          string
-	DBPath        string
-	MapDirPath    string
-	ScriptDirPath string
-	DropDirPath   string
-	NPCDirPath    string
+	Addr                  string
+	DBPath                string
+	MapDirPath            string
+	ScriptDirPath         string
+	DropDirPath           string
+	NPCDirPath            string
+	RecipeDirPath         string
+	ExpListPath           string
+	BehaviorDirPath       string  // 怪物行为树文件目录
+	ExpRate               float32 // 服务器经验倍率
+	ExpMobLevelDifference bool    // 玩家比怪物高 10 级以上时减少获得的经验
+	AllowCreateAssassin   bool    // 是否允许创建刺客
+	AllowCreateArcher     bool    // 是否允许创建弓箭手
 }
 
 type baseStats struct {
@@ -127,3 +213,84 @@ type baseStats struct {
 	CritialRateGain     float32
 	CriticalDamageGain  float32
 }
+
+// statCaps 玩家属性上限
+type statCaps struct {
+	MagicResist    uint8
+	PoisonResist   uint8
+	CriticalRate   uint8
+	CriticalDamage uint8
+	Freezing       uint8
+	PoisonAttack   uint8
+	HealthRegen    uint8
+	ManaRegen      uint8
+	PoisonRecovery uint8
+	HpDrainRate    uint8
+}
+
+// GetRandomItemStat 获取物品的附加属性随机规则，没有规则返回 nil
+func GetRandomItemStat(id uint8) *common.RandomItemStat {
+	if int(id) >= len(RandomItemStats) {
+		return nil
+	}
+	return &RandomItemStats[id]
+}
+
+// defaultRandomItemStats 默认的附加属性随机规则
+// 0 不随机, 1 武器, 2 衣服, 3 头盔, 4 项链, 5 手镯, 6 戒指, 7 腰带, 8 靴子
+func defaultRandomItemStats() []common.RandomItemStat {
+	rs := func(chance, statChance, maxStat int) common.RandomStat {
+		return common.RandomStat{Chance: chance, StatChance: statChance, MaxStat: maxStat}
+	}
+	weapon := common.RandomItemStat{
+		MaxDura:     rs(2, 13, 13),
+		DC:          rs(15, 15, 13),
+		MC:          rs(20, 15, 13),
+		SC:          rs(20, 15, 13),
+		AttackSpeed: rs(60, 30, 3),
+		Strong:      rs(24, 20, 2),
+		Accuracy:    rs(30, 20, 2),
+	}
+	armour := common.RandomItemStat{
+		MaxDura: rs(2, 10, 3),
+		AC:      rs(30, 15, 7),
+		MAC:     rs(30, 15, 7),
+		DC:      rs(40, 20, 7),
+		MC:      rs(40, 20, 7),
+		SC:      rs(40, 20, 7),
+	}
+	necklace := common.RandomItemStat{
+		MaxDura:  rs(13, 10, 3),
+		DC:       rs(15, 30, 7),
+		MC:       rs(15, 30, 7),
+		SC:       rs(15, 30, 7),
+		Accuracy: rs(60, 30, 7),
+		Agility:  rs(60, 30, 7),
+	}
+	bracelet := common.RandomItemStat{
+		MaxDura: rs(13, 10, 3),
+		AC:      rs(20, 30, 6),
+		MAC:     rs(20, 30, 6),
+		DC:      rs(30, 30, 6),
+		MC:      rs(30, 30, 6),
+		SC:      rs(30, 30, 6),
+	}
+	ring := common.RandomItemStat{
+		MaxDura: rs(13, 10, 3),
+		AC:      rs(30, 30, 6),
+		MAC:     rs(30, 30, 6),
+		DC:      rs(30, 30, 6),
+		MC:      rs(30, 30, 6),
+		SC:      rs(30, 30, 6),
+	}
+	beltBoots := common.RandomItemStat{
+		MaxDura: rs(2, 10, 3),
+		AC:      rs(30, 30, 3),
+		MAC:     rs(30, 30, 3),
+		DC:      rs(30, 30, 3),
+		MC:      rs(30, 30, 3),
+		SC:      rs(30, 30, 3),
+		Agility: rs(60, 30, 3),
+	}
+	return []common.RandomItemStat{{}, weapon, armour, armour, necklace, bracelet, ring, beltBoots, beltBoots}
+}